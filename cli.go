@@ -0,0 +1,488 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fingertip/internal/config"
+	"fingertip/internal/config/auto"
+	"fingertip/internal/control"
+	"fingertip/internal/resolvers"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// max time a command waits for
+// the running instance
+const commandTimeout = 30 * time.Second
+
+var errCheckFailed = errors.New("check failed")
+
+type command struct {
+	usage string
+	run   func(c *commandContext, args []string) error
+}
+
+var commands = map[string]command{
+	"resolve":       {"resolve [-secure] <name> [type]", runResolve},
+	"queries":       {"queries [name]", runQueries},
+	"tlsa":          {"tlsa <name>", runTLSA},
+	"status":        {"status", runStatus},
+	"start":         {"start", runControl(0, controlStart)},
+	"stop":          {"stop", runControl(0, controlStop)},
+	"backend":       {"backend <sane|letsdane>", runControl(1, controlBackend)},
+	"sync":          {"sync", runControl(0, controlSync)},
+	"regenerate-ca": {"regenerate-ca", runControl(0, controlRegenerateCA)},
+	"uninstall":     {"uninstall", runUninstall},
+}
+
+// commandContext options shared by commands
+type commandContext struct {
+	url    string
+	json   bool
+	secure bool
+	out    io.Writer
+}
+
+func commandUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: fingertip [-version] [-headless]\n")
+	fmt.Fprintf(os.Stderr, "       fingertip <command> [-addr host:port] [-json] ...\n\nCommands:\n")
+	for _, name := range []string{"resolve", "tlsa", "queries", "status", "start", "stop", "backend", "sync", "regenerate-ca", "uninstall"} {
+		fmt.Fprintf(os.Stderr, "  %s\n", commands[name].usage)
+	}
+}
+
+// defaultCommandAddr the proxy address
+// from the user config
+func defaultCommandAddr() string {
+	dir, err := config.GetOrCreateDir()
+	if err != nil {
+		return config.DefaultProxyAddr
+	}
+
+	usrConfig, _ := config.ReadUserConfig(dir)
+	if usrConfig.ProxyAddr == "" {
+		return config.DefaultProxyAddr
+	}
+
+	return usrConfig.ProxyAddr
+}
+
+// runCommand runs a subcommand against a running
+// fingertip instance returning the exit code
+func runCommand(args []string) int {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+		commandUsage()
+		return 2
+	}
+
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	addr := fs.String("addr", "", "Proxy address of the running fingertip (default from PROXY_ADDRESS)")
+	jsonOut := fs.Bool("json", false, "Print the raw JSON response")
+	secure := fs.Bool("secure", false, "Fail unless the answer is DNSSEC secure (resolve)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: fingertip %s\n", cmd.usage)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	if *addr == "" {
+		*addr = defaultCommandAddr()
+	}
+
+	c := &commandContext{
+		url:    config.GetProxyURL(*addr),
+		json:   *jsonOut,
+		secure: *secure,
+		out:    os.Stdout,
+	}
+
+	err := cmd.run(c, fs.Args())
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		fs.Usage()
+		return 2
+	case errors.Is(err, errCheckFailed):
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "fingertip %s: %v\n", args[0], err)
+	return 1
+}
+
+// get fetches a json endpoint of the running instance
+// into v printing the raw response if requested
+func (c *commandContext) get(path string, query url.Values, v interface{}) error {
+	client := &http.Client{Timeout: commandTimeout}
+	resp, err := client.Get(c.url + path + "?" + query.Encode())
+	if err != nil {
+		return fmt.Errorf("is fingertip running? %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	if c.json {
+		fmt.Fprintln(c.out, string(body))
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+// printJSON prints v as returned by the api
+func (c *commandContext) printJSON(v interface{}) {
+	data, _ := json.Marshal(v)
+	fmt.Fprintln(c.out, string(data))
+}
+
+// controlClient a client of the control
+// api of the running instance
+func controlClient() (*control.Client, error) {
+	dir, err := config.GetOrCreateDir()
+	if err != nil {
+		return nil, err
+	}
+
+	cl, err := control.NewClient(dir)
+	if err != nil {
+		return nil, fmt.Errorf("is fingertip running? %v", err)
+	}
+
+	return cl, nil
+}
+
+func hip5Path(extension string) string {
+	if extension == "" {
+		return "stub"
+	}
+
+	return "hip5 (" + extension + ")"
+}
+
+func dnssecStatus(secure bool) string {
+	if secure {
+		return "secure"
+	}
+
+	return "insecure"
+}
+
+func printTrace(out io.Writer, trace []resolvers.TraceStep) {
+	if len(trace) == 0 {
+		return
+	}
+
+	fmt.Fprintf(out, "\n;; TRACE:\n")
+	for _, step := range trace {
+		line := fmt.Sprintf(";; %-10s %s", step.Path, step.Detail)
+		if step.Error != "" {
+			line += " error: " + step.Error
+		}
+		fmt.Fprintln(out, line)
+	}
+}
+
+func runResolve(c *commandContext, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return flag.ErrHelp
+	}
+
+	qtype := "A"
+	if len(args) == 2 {
+		qtype = strings.ToUpper(args[1])
+	}
+
+	cl, err := controlClient()
+	if err != nil {
+		return err
+	}
+
+	a, err := cl.Resolve(args[0], qtype)
+	if err != nil {
+		return err
+	}
+
+	if c.json {
+		c.printJSON(a)
+	} else {
+		fmt.Fprintf(c.out, "; <<>> fingertip %s <<>> %s %s\n", Version, a.Name, a.Type)
+		fmt.Fprintf(c.out, ";; path: %s, dnssec: %s\n", hip5Path(a.Extension), dnssecStatus(a.Secure))
+		if a.Error != "" {
+			fmt.Fprintf(c.out, ";; error: %s\n", a.Error)
+		}
+
+		for _, cname := range a.CNAMEs {
+			fmt.Fprintf(c.out, ";; cname: %s\n", cname)
+		}
+
+		fmt.Fprintf(c.out, "\n;; ANSWER SECTION:\n")
+		for _, rr := range a.Records {
+			fmt.Fprintln(c.out, rr)
+		}
+
+		printTrace(c.out, a.Trace)
+	}
+
+	if a.Error != "" || (c.secure && !a.Secure) {
+		return errCheckFailed
+	}
+
+	return nil
+}
+
+func runTLSA(c *commandContext, args []string) error {
+	if len(args) != 1 {
+		return flag.ErrHelp
+	}
+
+	cl, err := controlClient()
+	if err != nil {
+		return err
+	}
+
+	res, err := cl.Lookup(args[0])
+	if err != nil {
+		return err
+	}
+
+	if res.Explanation == nil {
+		return errors.New("empty response")
+	}
+
+	if c.json {
+		c.printJSON(res)
+	} else {
+		fmt.Fprintf(c.out, "; <<>> fingertip %s <<>> _443._tcp.%s TLSA\n", Version, res.Name)
+		fmt.Fprintf(c.out, ";; path: %s, dnssec: %s\n", hip5Path(res.Extension), dnssecStatus(res.TLSASecure))
+		if res.TLSAError != "" {
+			fmt.Fprintf(c.out, ";; error: %s\n", res.TLSAError)
+		}
+
+		fmt.Fprintf(c.out, "\n;; ANSWER SECTION:\n")
+		for _, rr := range res.TLSA {
+			fmt.Fprintln(c.out, rr)
+		}
+
+		dane := "failed"
+		if res.DANE.Passed {
+			dane = "passed"
+		}
+		fmt.Fprintf(c.out, "\n;; DANE: %s, %s\n", dane, res.DANE.Detail)
+
+		printTrace(c.out, res.Trace)
+	}
+
+	// the certificate must pass
+	// the check the proxy makes
+	if !res.DANE.Passed {
+		return errCheckFailed
+	}
+
+	return nil
+}
+
+func runQueries(c *commandContext, args []string) error {
+	if len(args) > 1 {
+		return flag.ErrHelp
+	}
+
+	var name string
+	if len(args) == 1 {
+		name = args[0]
+	}
+
+	cl, err := controlClient()
+	if err != nil {
+		return err
+	}
+
+	records, err := cl.Queries(name, 100)
+	if err != nil {
+		return err
+	}
+
+	if c.json {
+		c.printJSON(records)
+		return nil
+	}
+
+	// oldest first like a log
+	for i := len(records) - 1; i >= 0; i-- {
+		r := records[i]
+		line := fmt.Sprintf("%s %s %s path: %s, dnssec: %s, records: %d, %.1fms",
+			r.Time.Format(time.RFC3339), r.Name, r.Type, hip5Path(r.Extension),
+			dnssecStatus(r.Secure), r.Records, r.LatencyMs)
+		if r.Error != "" {
+			line += " error: " + r.Error
+		}
+		fmt.Fprintln(c.out, line)
+	}
+
+	return nil
+}
+
+func runStatus(c *commandContext, args []string) error {
+	if len(args) != 0 {
+		return flag.ErrHelp
+	}
+
+	var info config.DebugInfo
+	if err := c.get("/info.json", url.Values{}, &info); err != nil {
+		return err
+	}
+
+	if c.json {
+		return nil
+	}
+
+	fmt.Fprintf(c.out, "proxy:          %s\n", c.url)
+	fmt.Fprintf(c.out, "backend:        %s\n", info.Backend)
+	fmt.Fprintf(c.out, "block height:   %d\n", info.BlockHeight)
+	fmt.Fprintf(c.out, "syncing:        %v\n", info.Syncing)
+	fmt.Fprintf(c.out, "cert installed: %v\n", info.CertInstalled)
+	if !info.CAExpires.IsZero() {
+		fmt.Fprintf(c.out, "cert expires:   %s\n", info.CAExpires.Format("2006-01-02"))
+	}
+	if info.CAWarning != "" {
+		fmt.Fprintf(c.out, "warning:        %s\n", info.CAWarning)
+	}
+
+	dns := "ok"
+	switch {
+	case info.DNSProbeInProgress:
+		dns = "in progress"
+	case info.DNSProbeErr != "":
+		dns = info.DNSProbeErr
+	}
+	fmt.Fprintf(c.out, "dns test:       %s\n", dns)
+
+	names := make([]string, 0, len(info.Extensions))
+	for name := range info.Extensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		err := info.Extensions[name]
+		if err == "" {
+			err = "ok"
+		}
+		fmt.Fprintf(c.out, "extension %s: %s\n", name, err)
+	}
+
+	return nil
+}
+
+// runControl a command calling the control api of
+// the running instance with nargs arguments
+func runControl(nargs int, op func(cl *control.Client, args []string) (control.Status, error)) func(c *commandContext, args []string) error {
+	return func(c *commandContext, args []string) error {
+		if len(args) != nargs {
+			return flag.ErrHelp
+		}
+
+		cl, err := controlClient()
+		if err != nil {
+			return err
+		}
+
+		st, err := op(cl, args)
+		if err != nil {
+			return err
+		}
+
+		if c.json {
+			c.printJSON(st)
+			return nil
+		}
+
+		fmt.Fprintf(c.out, "started:        %v\n", st.Started)
+		fmt.Fprintf(c.out, "backend:        %s\n", st.Backend)
+		fmt.Fprintf(c.out, "synced:         %v\n", st.Synced)
+		fmt.Fprintf(c.out, "block height:   %d\n", st.BlockHeight)
+		return nil
+	}
+}
+
+func controlStart(cl *control.Client, _ []string) (control.Status, error) {
+	return cl.Start()
+}
+
+func controlStop(cl *control.Client, _ []string) (control.Status, error) {
+	return cl.Stop()
+}
+
+func controlBackend(cl *control.Client, args []string) (control.Status, error) {
+	return cl.SetBackend(args[0])
+}
+
+func controlSync(cl *control.Client, _ []string) (control.Status, error) {
+	return cl.SyncRoots()
+}
+
+func controlRegenerateCA(cl *control.Client, _ []string) (control.Status, error) {
+	return cl.RegenerateCA()
+}
+
+// runUninstall removes the OS and browser configuration through
+// the running instance or with the journal if it isn't running
+func runUninstall(c *commandContext, args []string) error {
+	if len(args) != 0 {
+		return flag.ErrHelp
+	}
+
+	dir, err := config.GetOrCreateDir()
+	if err != nil {
+		return err
+	}
+
+	if cl, err := control.NewClient(dir); err == nil {
+		if _, err := cl.ConfigureOS(false); err == nil {
+			fmt.Fprintln(c.out, "fingertip configuration removed")
+			return nil
+		}
+	}
+
+	j, err := auto.OpenJournal(path.Join(dir, auto.JournalFileName))
+	if err != nil {
+		return err
+	}
+
+	// used by configurations made without a journal
+	autoURL := config.GetProxyURL(defaultCommandAddr()) + "/proxy.pac"
+	certPath := path.Join(dir, config.CertFileName)
+	if err := auto.Uninstall(j, autoURL, certPath); err != nil {
+		return err
+	}
+
+	if store, err := config.ReadStore(dir); err == nil && store.AutoConfig {
+		store.AutoConfig = false
+		if err := store.Save(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintln(c.out, "fingertip configuration removed")
+	return nil
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fingertip/internal/config/auto"
+	"fingertip/internal/control"
+	"fingertip/internal/resolvers"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+)
+
+// runState runtime state changed
+// through the control api
+type runState struct {
+	sync.Mutex
+	started bool
+	// ctx of the running proxy canceled on stop
+	ctx context.Context
+
+	serverErrCh chan error
+	hnsErrCh    chan error
+
+	// onError called when the proxy
+	// stops after a failure
+	onError func(err error)
+}
+
+// autoConfigState serializes auto configuration
+// changes and their journal
+type autoConfigState struct {
+	sync.Mutex
+}
+
+// serveControl serves the control api on a unix socket
+// in the config dir and on CONTROL_ADDRESS if set
+func (a *App) serveControl() (*control.Server, error) {
+	token, err := control.LoadOrCreateToken(path.Join(a.config.Path, control.TokenFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	s := control.NewServer(a, token)
+	if err := s.ListenUnix(path.Join(a.config.Path, control.SocketFileName)); err != nil {
+		return nil, err
+	}
+
+	if a.usrConfig.ControlAddr != "" {
+		if err := s.ListenTCP(a.usrConfig.ControlAddr); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (a *App) backend() string {
+	if a.config.Store.Backend == "" {
+		return "sane"
+	}
+
+	return a.config.Store.Backend
+}
+
+// supervise restarts hnsd if it crashes, stops the proxy
+// if it fails and updates the block height it returns
+// once hnsd keeps crashing for the caller to shut down
+func (a *App) supervise() error {
+	ticker := time.NewTicker(150 * time.Millisecond)
+	for {
+		select {
+		case err := <-a.run.serverErrCh:
+			if errors.Is(err, http.ErrServerClosed) {
+				continue
+			}
+
+			log.Printf("[ERR] app: proxy server failed: %v", err)
+			a.Stop()
+			a.fail(err)
+		case err := <-a.run.hnsErrCh:
+			// a.proc is replaced when
+			// the backend changes
+			a.run.Lock()
+			if a.proc.Started() {
+				err = a.restartHNSD(err, a.run.hnsErrCh)
+			} else {
+				err = nil
+			}
+			a.run.Unlock()
+
+			if err != nil {
+				a.Stop()
+				return err
+			}
+		case <-ticker.C:
+			a.run.Lock()
+			hnsProc := a.proc
+			a.run.Unlock()
+
+			if !hnsProc.Started() {
+				a.config.Debug.SetBlockHeight(0)
+				continue
+			}
+
+			a.config.Debug.SetBlockHeight(hnsProc.GetHeight())
+		}
+	}
+}
+
+func (a *App) fail(err error) {
+	a.run.Lock()
+	onError := a.run.onError
+	a.run.Unlock()
+
+	if onError != nil {
+		onError(err)
+	}
+}
+
+// setOnError sets the callback of failures
+// that stopped the proxy
+func (a *App) setOnError(f func(err error)) {
+	a.run.Lock()
+	defer a.run.Unlock()
+
+	a.run.onError = f
+}
+
+func (a *App) Start() error {
+	a.run.Lock()
+	defer a.run.Unlock()
+
+	if a.run.started {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.cancel = cancel
+	a.run.ctx = ctx
+
+	// letsdane and the built-in resolver
+	// need the hnsd root server
+	backend := a.backend()
+	if backend == "letsdane" || a.usrConfig.NativeRecursion {
+		a.proc.Start(a.run.hnsErrCh)
+	}
+
+	if backend == "letsdane" {
+		a.config.Debug.SetCheckSynced(a.proc.Synced)
+	} else {
+		go a.syncRoots(ctx)
+	}
+
+	server, dnsServer := a.server, a.dnsServer
+	go func() {
+		a.run.serverErrCh <- listen(server, dnsServer)
+	}()
+
+	a.run.started = true
+	return nil
+}
+
+func (a *App) Stop() error {
+	a.run.Lock()
+	defer a.run.Unlock()
+
+	if !a.run.started {
+		return nil
+	}
+
+	a.halt()
+	a.run.started = false
+
+	// create a new server to reset
+	// any state like old cache ... etc.
+	var err error
+	if a.server, err = a.newProxyServer(); err != nil {
+		return fmt.Errorf("error creating a new proxy server: %v", err)
+	}
+
+	return nil
+}
+
+func (a *App) SetBackend(backend string) error {
+	if backend != "sane" && backend != "letsdane" {
+		return fmt.Errorf("unknown backend %q", backend)
+	}
+
+	started := a.Status().Started
+	if err := a.Stop(); err != nil {
+		return err
+	}
+
+	a.run.Lock()
+	prev := a.config.Store.Backend
+	a.config.Store.Backend = backend
+	err := a.setRecursiveAddress()
+	if err == nil {
+		err = a.config.Store.Save()
+	}
+	if err != nil {
+		// keep the previous backend
+		a.config.Store.Backend = prev
+		if restoreErr := a.setRecursiveAddress(); restoreErr != nil {
+			err = errors.Join(err, restoreErr)
+		}
+	}
+	a.run.Unlock()
+
+	if err != nil {
+		if started {
+			return errors.Join(err, a.Start())
+		}
+		return err
+	}
+
+	if started {
+		return a.Start()
+	}
+
+	return nil
+}
+
+func (a *App) journal() (*auto.Journal, error) {
+	return auto.OpenJournal(path.Join(a.config.Path, auto.JournalFileName))
+}
+
+func (a *App) ConfigureOS(enable bool) error {
+	if !auto.Supported() {
+		return errors.New("automatic configuration isn't supported on this OS")
+	}
+
+	a.autoConfig.Lock()
+	defer a.autoConfig.Unlock()
+
+	j, err := a.journal()
+	if err != nil {
+		return err
+	}
+
+	autoURL := a.proxyURL + "/proxy.pac"
+	if !enable {
+		if err := auto.Uninstall(j, autoURL, a.config.CertPath); err != nil {
+			return fmt.Errorf("failed removing configuration: %v", err)
+		}
+		return a.setAutoConfig(false)
+	}
+
+	if err := auto.InstallAutoProxy(j, autoURL); err != nil {
+		_ = j.Undo()
+		return err
+	}
+
+	if err := auto.InstallCert(j, a.config.CertPath); err != nil {
+		// revert proxy settings
+		_ = j.Undo()
+		return err
+	}
+
+	if err := auto.ConfigureBrowsers(j, autoURL, a.config.CertPath); err != nil {
+		log.Printf("app: browser configuration: %v", err)
+	}
+
+	return a.setAutoConfig(true)
+}
+
+// recoverAutoConfig reverts steps left in the journal
+// by an auto configuration that didn't finish
+func (a *App) recoverAutoConfig() {
+	if !auto.Supported() || a.config.Store.AutoConfig {
+		return
+	}
+
+	a.autoConfig.Lock()
+	defer a.autoConfig.Unlock()
+
+	j, err := a.journal()
+	if err != nil || j.Empty() {
+		return
+	}
+
+	log.Printf("app: reverting unfinished auto configuration")
+	if err := j.Undo(); err != nil {
+		log.Printf("app: %v", err)
+	}
+}
+
+func (a *App) setAutoConfig(enabled bool) error {
+	a.run.Lock()
+	defer a.run.Unlock()
+
+	a.config.Store.AutoConfig = enabled
+	return a.config.Store.Save()
+}
+
+func (a *App) SyncRoots() error {
+	a.run.Lock()
+	defer a.run.Unlock()
+
+	if !a.run.started {
+		return errors.New("fingertip isn't started")
+	}
+
+	if a.backend() == "letsdane" {
+		return errors.New("the letsdane backend doesn't use tree roots")
+	}
+
+	go a.syncRootsOnce(a.run.ctx)
+	return nil
+}
+
+func (a *App) Status() control.Status {
+	a.run.Lock()
+	defer a.run.Unlock()
+
+	return control.Status{
+		Version:     Version,
+		Started:     a.run.started,
+		Backend:     a.backend(),
+		AutoConfig:  a.config.Store.AutoConfig,
+		ProxyURL:    a.proxyURL,
+		BlockHeight: a.config.Debug.BlockHeight(),
+		Synced:      a.config.Debug.Synced(),
+		CAExpires:   a.config.Debug.CAExpiry(),
+		CAWarning:   a.config.Debug.CAWarning(),
+	}
+}
+
+func (a *App) Queries(name string, limit int) ([]resolvers.QueryRecord, error) {
+	if a.config.QueryLog == nil {
+		return nil, errors.New("query log disabled")
+	}
+
+	return a.config.QueryLog.Recent(name, limit), nil
+}
+
+func (a *App) Resolve(ctx context.Context, name, qtype string) (*resolvers.Answer, error) {
+	if !a.Status().Started {
+		return nil, errors.New("fingertip isn't started")
+	}
+
+	return a.config.Resolve(ctx, name, qtype)
+}
+
+func (a *App) Lookup(ctx context.Context, name string) (*resolvers.LookupResult, error) {
+	if !a.Status().Started {
+		return nil, errors.New("fingertip isn't started")
+	}
+
+	return a.config.Lookup(ctx, name)
+}
+
+func (a *App) RegenerateCA() error {
+	return a.rotateCA()
+}
+
+// rotateCA replaces the CA installing the new one in place of
+// the previous one before the proxy switches to it the proxy
+// keeps the previous CA if it can't be installed
+func (a *App) rotateCA() error {
+	a.run.Lock()
+	err := a.config.RotateCA()
+	a.run.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("failed regenerating CA: %v", err)
+	}
+
+	if err := a.replaceInstalledCA(); err != nil {
+		a.run.Lock()
+		restoreErr := a.config.RestoreCA()
+		a.run.Unlock()
+
+		if restoreErr != nil {
+			return errors.Join(err, fmt.Errorf("failed restoring the previous CA: %v", restoreErr))
+		}
+		return err
+	}
+
+	// stop without the rebuild in Stop so the
+	// server is only created with the new CA
+	a.run.Lock()
+	started := a.run.started
+	if started {
+		a.halt()
+		a.run.started = false
+	}
+	err = a.config.UseCA()
+	if err == nil {
+		a.server, err = a.newProxyServer()
+	}
+	a.run.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("failed switching to the new CA: %v", err)
+	}
+
+	log.Printf("app: regenerated CA expires %s", a.config.Debug.CAExpiry().Format(time.RFC3339))
+	if started {
+		return a.Start()
+	}
+
+	return nil
+}
+
+// replaceInstalledCA installs the CA where auto configuration
+// installed the previous ones and removes them the previous
+// CAs are kept to retry on the next start if it fails
+func (a *App) replaceInstalledCA() error {
+	prevs, err := a.config.PreviousCAs()
+	if err != nil || len(prevs) == 0 {
+		return err
+	}
+
+	if a.config.Store.AutoConfig && auto.Supported() {
+		a.autoConfig.Lock()
+		defer a.autoConfig.Unlock()
+
+		j, err := a.journal()
+		if err != nil {
+			return err
+		}
+
+		for _, prev := range prevs {
+			if err := auto.RotateCert(j, prev.Raw, a.config.CertPath); err != nil {
+				return fmt.Errorf("failed replacing the installed CA: %v", err)
+			}
+		}
+	}
+
+	return a.config.RemovePreviousCAs()
+}
+
+// watchCA renews the CA before it expires
+func (a *App) watchCA() {
+	if err := a.replaceInstalledCA(); err != nil {
+		log.Printf("app: %v", err)
+	}
+
+	for {
+		if a.config.CANeedsRotation() {
+			if err := a.rotateCA(); err != nil {
+				log.Printf("app: %v", err)
+			}
+		}
+
+		time.Sleep(6 * time.Hour)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// runHeadless runs fingertip without the system tray
+// until interrupted or a fatal error e.g. as a shared
+// proxy on a server it's controlled through the control api
+func runHeadless(app *App, fatal <-chan error) {
+	log.SetOutput(os.Stdout)
+	fileLogger = log.New(os.Stdout, "", log.LstdFlags|log.Lshortfile)
+
+	app.setOnError(func(err error) {
+		app.closeStorage()
+		log.Fatalf("[ERR] app: %v", err)
+	})
+
+	log.Printf("app: starting %s backend on %s", app.backend(), app.proxyURL)
+	if err := app.Start(); err != nil {
+		log.Fatalf("[ERR] app: %v", err)
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+
+	var err error
+	select {
+	case sig := <-sigCh:
+		log.Printf("app: received %v shutting down", sig)
+	case err = <-fatal:
+		log.Printf("[ERR] app: %v shutting down", err)
+	}
+
+	// stop without creating a new proxy server
+	// like Stop does to start again
+	app.run.Lock()
+	app.halt()
+	app.run.Unlock()
+	app.closeStorage()
+
+	if err != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,70 @@
+package auto
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+)
+
+// ConfigureBrowsers configures firefox profiles and browsers
+// that don't follow the OS proxy and certificate settings
+func ConfigureBrowsers(j *Journal, autoURL, certPath string) error {
+	var lastErr error
+	if err := ConfigureFirefox(j); err != nil {
+		lastErr = err
+	}
+
+	if err := configureBrowsers(j, autoURL, certPath); err != nil {
+		lastErr = err
+	}
+
+	return lastErr
+}
+
+// UndoBrowserConfiguration undoes actions made by ConfigureBrowsers
+// for configurations made without a journal
+func UndoBrowserConfiguration() {
+	UndoFirefoxConfiguration()
+	undoBrowsers()
+}
+
+// firefoxProfiles lists the profile directories
+// in profiles.ini of a firefox root directory
+func firefoxProfiles(root string) ([]string, error) {
+	order, sections, err := readINI(path.Join(root, "profiles.ini"))
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var paths []string
+	for _, name := range order {
+		values := sections[name]
+		if !strings.HasPrefix(name, "Profile") || values["Path"] == "" {
+			continue
+		}
+
+		p := values["Path"]
+		if values["IsRelative"] != "0" {
+			p = path.Join(root, p)
+		}
+
+		if !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+
+	return paths, nil
+}
+
+// chromiumPolicy a managed policy making chromium
+// based browsers use the proxy auto-config url
+func chromiumPolicy(autoURL string) ([]byte, error) {
+	return json.MarshalIndent(map[string]interface{}{
+		"ProxySettings": map[string]string{
+			"ProxyMode":   "pac_script",
+			"ProxyPacUrl": autoURL,
+		},
+	}, "", "  ")
+}
@@ -0,0 +1,41 @@
+package auto
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestFirefoxProfiles(t *testing.T) {
+	root := t.TempDir()
+	ini := `[General]
+StartWithLastProfile=1
+
+[Profile1]
+Name=work
+IsRelative=1
+Path=xyz.work
+
+[Profile0]
+Name=default
+IsRelative=0
+Path=/data/firefox/abc.default
+
+[Install4F96D1932A9F858E]
+Default=xyz.work
+`
+	if err := os.WriteFile(path.Join(root, "profiles.ini"), []byte(ini), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := firefoxProfiles(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{path.Join(root, "xyz.work"), "/data/firefox/abc.default"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got profiles = %v, want %v", got, want)
+	}
+}
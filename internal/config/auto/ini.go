@@ -0,0 +1,142 @@
+package auto
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// readINI reads the keys of each section in an ini file
+// sections are returned in the order they appear
+func readINI(file string) ([]string, map[string]map[string]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	var order []string
+	sections := make(map[string]map[string]string)
+	var values map[string]string
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := line[1 : len(line)-1]
+			if _, ok := sections[name]; !ok {
+				order = append(order, name)
+				sections[name] = make(map[string]string)
+			}
+			values = sections[name]
+			continue
+		}
+
+		if values == nil {
+			continue
+		}
+
+		if key, value, ok := strings.Cut(line, "="); ok {
+			values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+
+	return order, sections, sc.Err()
+}
+
+// readINISection reads the keys of section in an ini file
+func readINISection(file, section string) (map[string]string, error) {
+	_, sections, err := readINI(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if values, ok := sections[section]; ok {
+		return values, nil
+	}
+
+	return make(map[string]string), nil
+}
+
+// writeINISection sets keys in section of an ini file
+// keeping other sections and keys as is empty values
+// remove the key
+func writeINISection(file, section string, values map[string]string) error {
+	b, err := os.ReadFile(file)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	var lines []string
+	if len(b) > 0 {
+		lines = strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+	}
+
+	written := make(map[string]bool)
+	var out []string
+	in, found := false, false
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	flush := func() {
+		for _, key := range keys {
+			if !written[key] && values[key] != "" {
+				out = append(out, key+"="+values[key])
+			}
+		}
+	}
+
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			if in {
+				flush()
+			}
+			in = trimmed == "["+section+"]"
+			found = found || in
+			out = append(out, line)
+			continue
+		}
+
+		if in {
+			if key, _, ok := strings.Cut(trimmed, "="); ok {
+				key = strings.TrimSpace(key)
+				if value, ok := values[key]; ok {
+					written[key] = true
+					if value != "" {
+						out = append(out, key+"="+value)
+					}
+					continue
+				}
+			}
+		}
+
+		out = append(out, line)
+	}
+
+	if in {
+		flush()
+	}
+
+	if !found {
+		if len(out) > 0 {
+			out = append(out, "")
+		}
+		out = append(out, "["+section+"]")
+		flush()
+	}
+
+	if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(file, []byte(strings.Join(out, "\n")+"\n"), 0644)
+}
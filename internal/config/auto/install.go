@@ -2,6 +2,7 @@ package auto
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
@@ -30,6 +31,14 @@ user_pref("network.proxy.type", 5);
 `
 )
 
+// UseSystemTrustStore also install the CA in the distro trust
+// store on linux asking for elevation with pkexec
+var UseSystemTrustStore = false
+
+// UseBrowserPolicies also install a managed proxy policy for
+// chromium based browsers on linux asking for elevation
+var UseBrowserPolicies = false
+
 func equalURL(a, b string) bool {
 	a = strings.TrimSuffix(strings.TrimSpace(a), "/")
 	b = strings.TrimSuffix(strings.TrimSpace(b), "/")
@@ -38,7 +47,7 @@ func equalURL(a, b string) bool {
 
 // ConfigureFirefox instructs firefox to read system certs and proxy
 // settings
-func ConfigureFirefox() error {
+func ConfigureFirefox(j *Journal) error {
 	profiles, err := getProfilePaths()
 	if err != nil {
 		return err
@@ -46,14 +55,15 @@ func ConfigureFirefox() error {
 
 	var lastErr error
 	for _, profilePath := range profiles {
-		if err := writeUserConfig(profilePath); err != nil {
+		if err := writeUserConfig(j, profilePath); err != nil {
 			lastErr = err
 		}
 	}
 	return lastErr
 }
 
-// UndoFirefoxConfiguration undoes all actions made by ConfigureFirefox
+// UndoFirefoxConfiguration removes the prefs added by ConfigureFirefox
+// for configurations made without a journal
 func UndoFirefoxConfiguration() {
 	profiles, err := getProfilePaths()
 	if err != nil {
@@ -62,13 +72,34 @@ func UndoFirefoxConfiguration() {
 
 	for _, profilePath := range profiles {
 		userjs := path.Join(profilePath, "user.js")
-		if ok, _, _ := fileLineContains(userjs, userProfileHeader); ok {
+		b, err := os.ReadFile(userjs)
+		if err != nil || !bytes.Contains(b, []byte(userPref)) {
+			continue
+		}
+
+		rest := bytes.Replace(b, []byte(userPref), nil, 1)
+		if len(bytes.TrimSpace(rest)) == 0 {
 			_ = os.Remove(userjs)
+			continue
 		}
+		_ = os.WriteFile(userjs, rest, 0644)
+	}
+}
+
+// Uninstall reverts auto configuration with the journal or
+// on a best effort basis if it was made without one
+func Uninstall(j *Journal, autoURL, certPath string) error {
+	if !j.Empty() {
+		return j.Undo()
 	}
+
+	UninstallAutoProxy(autoURL)
+	UndoBrowserConfiguration()
+	_ = UninstallCert(certPath)
+	return nil
 }
 
-func writeUserConfig(profilePath string) (err error) {
+func writeUserConfig(j *Journal, profilePath string) (err error) {
 	prefs := path.Join(profilePath, "prefs.js")
 	// if user has existing proxy configuration
 	// ignore this profile
@@ -80,17 +111,25 @@ func writeUserConfig(profilePath string) (err error) {
 	}
 
 	userjs := path.Join(profilePath, "user.js")
-	if _, err = os.Stat(userjs); err == nil {
-		if ok, _, _ := fileLineContains(userjs, userProfileHeader); !ok {
-			return nil
-		}
+	b, err := os.ReadFile(userjs)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed reading user.js: %v", err)
 	}
 
-	if err != nil && !errors.Is(err, fs.ErrNotExist) {
-		return fmt.Errorf("failed checking whether file exists: %v", err)
+	if bytes.Contains(b, []byte(userProfileHeader)) {
+		return nil
+	}
+
+	if err := j.recordFile(userjs); err != nil {
+		return err
 	}
 
-	return os.WriteFile(userjs, []byte(userPref), 0644)
+	// keep the user's own prefs
+	if len(b) > 0 && !bytes.HasSuffix(b, []byte("\n")) {
+		b = append(b, '\n')
+	}
+
+	return os.WriteFile(userjs, append(b, userPref...), 0644)
 }
 
 func fileLineContains(file, substr string) (bool, string, error) {
@@ -111,27 +150,43 @@ func fileLineContains(file, substr string) (bool, string, error) {
 }
 
 func getProfilePaths() ([]string, error) {
-	c, err := os.UserConfigDir()
+	roots, err := firefoxRoots()
 	if err != nil {
 		return nil, fmt.Errorf("failed reading user config dir: %v", err)
 	}
 
-	pp := path.Join(c, relativeProfilesPath)
-	dirs, err := os.ReadDir(pp)
-	if err != nil {
-		return nil, fmt.Errorf("failed listing profiles: %v", err)
-	}
-
 	var paths []string
-	for _, dir := range dirs {
-		if strings.Contains(dir.Name(), "default") {
-			paths = append(paths, path.Join(pp, dir.Name()))
+	for _, root := range roots {
+		profiles, err := firefoxProfiles(root)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("failed listing profiles: %v", err)
 		}
+		paths = append(paths, profiles...)
 	}
 
 	return paths, nil
 }
 
+// writeTempPEM writes a DER cert to a
+// temp PEM file returning its path
+func writeTempPEM(der []byte) (string, error) {
+	f, err := os.CreateTemp("", "fingertip-*.crt")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if err := pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	return f.Name(), nil
+}
+
 func readPEM(certPath string) ([]byte, error) {
 	cert, err := os.ReadFile(certPath)
 	if err != nil {
@@ -3,6 +3,8 @@
 package auto
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"os/exec"
@@ -12,7 +14,12 @@ import (
 )
 
 var re = regexp.MustCompile(`(?m)^\([0-9]+\)(.+)`)
-var relativeProfilesPath = "Firefox/Profiles"
+
+// journal steps
+const (
+	stepAutoProxy = "autoproxy"
+	stepKeychain  = "keychain"
+)
 
 func VerifyCert(certPath string) (err error) {
 	// TODO: use Go API once supported
@@ -68,7 +75,19 @@ func UninstallAutoProxy(autoURL string) {
 	}
 }
 
-func InstallAutoProxy(autoURL string) error {
+// recordAutoProxy records the auto proxy
+// url and state of a network service
+func recordAutoProxy(j *Journal, service string) error {
+	out, err := runCommand("networksetup", "-getautoproxyurl", service)
+	if err != nil {
+		return err
+	}
+
+	url, enabled := parseGetAutoURL(string(out))
+	return j.record(Step{Kind: stepAutoProxy, Target: service, Existed: enabled, Prior: []byte(url)})
+}
+
+func InstallAutoProxy(j *Journal, autoURL string) error {
 	services, err := getNetworkServices()
 	if err != nil {
 		return fmt.Errorf("failed reading network services")
@@ -89,6 +108,10 @@ func InstallAutoProxy(autoURL string) error {
 		if status != ProxyStatusNone {
 			continue
 		}
+		if err = recordAutoProxy(j, service); err != nil {
+			lastErr = fmt.Errorf("failed recording proxy settings for service %s", service)
+			continue
+		}
 		if _, err = runCommand("networksetup", "-setautoproxyurl", service, autoURL); err != nil {
 			lastErr = fmt.Errorf("failed configuring proxy make sure your user account has permissions to change proxy settings")
 			continue
@@ -131,13 +154,22 @@ func getNetworkServices() ([]string, error) {
 	return services, nil
 }
 
-func InstallCert(certPath string) error {
+func InstallCert(j *Journal, certPath string) error {
 	dir, err := os.UserHomeDir()
 	if err != nil {
 		return err
 	}
 
+	der, err := readPEM(certPath)
+	if err != nil {
+		return err
+	}
+
 	kp := path.Join(dir, "Library/Keychains/login.keychain")
+	if err := j.record(Step{Kind: stepKeychain, Target: kp, Existed: VerifyCert(certPath) == nil, Value: der}); err != nil {
+		return err
+	}
+
 	out, err := runCommand("security", "add-trusted-cert",
 		"-p", "basic", "-p", "ssl", "-k", kp, certPath)
 
@@ -152,11 +184,82 @@ func InstallCert(certPath string) error {
 	return fmt.Errorf("failed installing cert: %v", err)
 }
 
+// RotateCert installs the CA at certPath and
+// removes the previous one prev from the keychain
+func RotateCert(j *Journal, prev []byte, certPath string) error {
+	if err := InstallCert(j, certPath); err != nil {
+		return err
+	}
+
+	dir, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+
+	der, err := readPEM(certPath)
+	if err != nil {
+		return err
+	}
+
+	kp := path.Join(dir, "Library/Keychains/login.keychain")
+	if err := removeKeychainCert(kp, prev); err != nil {
+		return err
+	}
+
+	return j.updateValue(stepKeychain, kp, der)
+}
+
+// removeKeychainCert removes the trust settings of a
+// DER cert and deletes it from the keychain kp
+func removeKeychainCert(kp string, der []byte) error {
+	certPath, err := writeTempPEM(der)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(certPath)
+
+	if out, err := runCommand("security", "remove-trusted-cert", certPath); err != nil {
+		return fmt.Errorf("failed removing cert: %s", string(out))
+	}
+
+	sum := sha1.Sum(der)
+	_, _ = runCommand("security", "delete-certificate", "-Z", hex.EncodeToString(sum[:]), kp)
+	return nil
+}
+
 func UninstallCert(certPath string) error {
 	_, err := runCommand("security", "remove-trusted-cert", certPath)
 	return err
 }
 
+func undoStep(s Step) error {
+	switch s.Kind {
+	case stepAutoProxy:
+		if url := string(s.Prior); url != "" && url != "(null)" {
+			if _, err := runCommand("networksetup", "-setautoproxyurl", s.Target, url); err != nil {
+				return fmt.Errorf("failed restoring proxy for service %s", s.Target)
+			}
+		}
+
+		state := "off"
+		if s.Existed {
+			state = "on"
+		}
+		if _, err := runCommand("networksetup", "-setautoproxystate", s.Target, state); err != nil {
+			return fmt.Errorf("failed restoring proxy state for service %s", s.Target)
+		}
+		return nil
+	case stepKeychain:
+		if s.Existed {
+			return nil
+		}
+
+		return removeKeychainCert(s.Target, s.Value)
+	}
+
+	return undoCommonStep(s)
+}
+
 // parses networksetup -getautoproxyurl <service>
 func parseGetAutoURL(txt string) (url string, enabled bool) {
 	lines := strings.Split(strings.TrimSpace(txt), "\n")
@@ -175,3 +278,19 @@ func parseGetAutoURL(txt string) (url string, enabled bool) {
 
 	return
 }
+
+func firefoxRoots() ([]string, error) {
+	c, err := os.UserConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{path.Join(c, "Firefox")}, nil
+}
+
+// browsers use the OS proxy and certificate settings
+func configureBrowsers(j *Journal, autoURL, certPath string) error {
+	return nil
+}
+
+func undoBrowsers() {}
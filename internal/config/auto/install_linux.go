@@ -1,42 +1,827 @@
-//+build linux
+//go:build linux
+// +build linux
 
 package auto
 
 import (
+	"bytes"
 	"crypto/x509"
 	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
 )
 
-var relativeProfilesPath = "Mozilla/Firefox/Profiles"
+const (
+	nssNickname      = "Fingertip"
+	envSnippetName   = "60-fingertip.conf"
+	gnomeProxySchema = "org.gnome.system.proxy"
+)
+
+// journal steps
+const (
+	stepGSettings = "gsettings"
+	stepNSS       = "nss"
+	// a file written as root
+	stepRootFile = "root-file"
+)
+
+// trustStore a distro CA trust store and
+// the command rebuilding its bundle
+type trustStore struct {
+	anchors string
+	name    string
+	update  []string
+}
+
+var trustStores = []trustStore{
+	// debian, ubuntu
+	{"/usr/local/share/ca-certificates", "fingertip.crt", []string{"update-ca-certificates"}},
+	// fedora, rhel
+	{"/etc/pki/ca-trust/source/anchors", "fingertip.pem", []string{"update-ca-trust", "extract"}},
+	// arch
+	{"/etc/ca-certificates/trust-source/anchors", "fingertip.crt", []string{"update-ca-trust"}},
+}
+
+// snapNSSDBs snap packaged chromium based
+// browsers have their own copy of the shared db
+var snapNSSDBs = []string{
+	"snap/chromium/current/.pki/nssdb",
+	"snap/brave/current/.pki/nssdb",
+}
+
+const policyFileName = "fingertip.json"
+
+// chromiumPolicyDirs managed policy dirs of
+// chromium based browsers and their binaries
+var chromiumPolicyDirs = []struct {
+	dir      string
+	binaries []string
+}{
+	{"/etc/opt/chrome/policies/managed", []string{"google-chrome", "google-chrome-stable"}},
+	{"/etc/chromium/policies/managed", []string{"chromium", "chromium-browser"}},
+	{"/etc/brave/policies/managed", []string{"brave-browser", "brave"}},
+	{"/etc/opt/edge/policies/managed", []string{"microsoft-edge", "microsoft-edge-stable"}},
+}
+
+// linuxSystem the files and commands used to configure
+// a linux desktop paths are relative to root and home
+// so they can be replaced in tests
+type linuxSystem struct {
+	root      string
+	home      string
+	configDir string
+	desktop   string
+	euid      int
+
+	run      func(name string, args ...string) ([]byte, error)
+	lookPath func(name string) (string, error)
+}
+
+func newLinuxSystem() (*linuxSystem, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	return &linuxSystem{
+		root:      "/",
+		home:      home,
+		configDir: configDir,
+		desktop:   os.Getenv("XDG_CURRENT_DESKTOP"),
+		euid:      os.Geteuid(),
+		run:       runCommand,
+		lookPath:  exec.LookPath,
+	}, nil
+}
+
+func runCommand(name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	return cmd.CombinedOutput()
+}
+
+func (l *linuxSystem) has(name string) bool {
+	_, err := l.lookPath(name)
+	return err == nil
+}
+
+// gnome settings also used by cinnamon, budgie, mate ...
+func (l *linuxSystem) gsettingsGet(key string) (string, error) {
+	out, err := l.run("gsettings", "get", gnomeProxySchema, key)
+	if err != nil {
+		return "", fmt.Errorf("gsettings: %s", strings.TrimSpace(string(out)))
+	}
+
+	return strings.Trim(strings.TrimSpace(string(out)), "'"), nil
+}
+
+// recordGSettings records proxy keys
+// before they're changed
+func (l *linuxSystem) recordGSettings(j *Journal, keys ...string) error {
+	for _, key := range keys {
+		value, err := l.gsettingsGet(key)
+		if err != nil {
+			return err
+		}
+
+		if err := j.record(Step{
+			Kind:    stepGSettings,
+			Target:  gnomeProxySchema,
+			Key:     key,
+			Existed: true,
+			Prior:   []byte(value),
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (l *linuxSystem) gnomeProxyStatus(autoURL string) (ProxyStatus, error) {
+	mode, err := l.gsettingsGet("mode")
+	if err != nil {
+		return ProxyStatusConflict, err
+	}
+
+	switch mode {
+	case "none", "":
+		return ProxyStatusNone, nil
+	case "auto":
+		url, err := l.gsettingsGet("autoconfig-url")
+		if err != nil {
+			return ProxyStatusConflict, err
+		}
+
+		if url == "" {
+			return ProxyStatusNone, nil
+		}
+
+		if equalURL(url, autoURL) {
+			return ProxyStatusInstalled, nil
+		}
+	}
+
+	return ProxyStatusConflict, nil
+}
+
+func (l *linuxSystem) kioslavercPath() string {
+	return path.Join(l.configDir, "kioslaverc")
+}
+
+func (l *linuxSystem) hasKDE() bool {
+	if strings.Contains(strings.ToUpper(l.desktop), "KDE") {
+		return true
+	}
+
+	_, err := os.Stat(l.kioslavercPath())
+	return err == nil
+}
+
+// kde proxy types 0 none, 1 manual, 2 pac url, 3 wpad, 4 env
+func (l *linuxSystem) kdeProxyStatus(autoURL string) (ProxyStatus, error) {
+	values, err := readINISection(l.kioslavercPath(), "Proxy Settings")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return ProxyStatusConflict, err
+	}
+
+	switch values["ProxyType"] {
+	case "", "0":
+		return ProxyStatusNone, nil
+	case "2":
+		if equalURL(values["Proxy Config Script"], autoURL) {
+			return ProxyStatusInstalled, nil
+		}
+	}
+
+	return ProxyStatusConflict, nil
+}
+
+// recordKDE records the proxy keys of kioslaverc
+// or that it didn't exist
+func (l *linuxSystem) recordKDE(j *Journal) error {
+	file := l.kioslavercPath()
+	if _, err := os.Stat(file); errors.Is(err, fs.ErrNotExist) {
+		return j.recordFile(file)
+	}
+
+	return j.recordINI(file, "Proxy Settings", "ProxyType", "Proxy Config Script")
+}
+
+// envSnippetPath a systemd environment.d snippet read by user
+// sessions auto_proxy is used by chromium without a desktop
+func (l *linuxSystem) envSnippetPath() string {
+	return path.Join(l.configDir, "environment.d", envSnippetName)
+}
+
+func (l *linuxSystem) installAutoProxy(j *Journal, autoURL string) error {
+	var lastErr error
+	installed := 0
+
+	if l.has("gsettings") {
+		status, err := l.gnomeProxyStatus(autoURL)
+		switch {
+		case err != nil:
+			lastErr = fmt.Errorf("failed checking proxy status: %v", err)
+		case status == ProxyStatusConflict:
+			lastErr = fmt.Errorf("auto configuration failed your OS has existing proxy settings")
+		case status == ProxyStatusInstalled:
+			installed++
+		default:
+			if err := l.recordGSettings(j, "autoconfig-url", "mode"); err != nil {
+				lastErr = fmt.Errorf("failed recording proxy settings: %v", err)
+				break
+			}
+			if out, err := l.run("gsettings", "set", gnomeProxySchema, "autoconfig-url", autoURL); err != nil {
+				lastErr = fmt.Errorf("failed configuring proxy: %s", strings.TrimSpace(string(out)))
+				break
+			}
+			if out, err := l.run("gsettings", "set", gnomeProxySchema, "mode", "auto"); err != nil {
+				lastErr = fmt.Errorf("failed changing proxy mode: %s", strings.TrimSpace(string(out)))
+				break
+			}
+			installed++
+		}
+	}
+
+	if l.hasKDE() {
+		status, err := l.kdeProxyStatus(autoURL)
+		switch {
+		case err != nil:
+			lastErr = fmt.Errorf("failed checking proxy status: %v", err)
+		case status == ProxyStatusConflict:
+			lastErr = fmt.Errorf("auto configuration failed your OS has existing proxy settings")
+		case status == ProxyStatusInstalled:
+			installed++
+		default:
+			if err := l.recordKDE(j); err != nil {
+				lastErr = fmt.Errorf("failed recording proxy settings: %v", err)
+				break
+			}
+			if err := writeINISection(l.kioslavercPath(), "Proxy Settings", map[string]string{
+				"ProxyType":           "2",
+				"Proxy Config Script": autoURL,
+			}); err != nil {
+				lastErr = fmt.Errorf("failed configuring proxy: %v", err)
+				break
+			}
+			installed++
+		}
+	}
+
+	if installed == 0 {
+		if lastErr != nil {
+			return lastErr
+		}
+		return errors.New("no supported desktop proxy settings found")
+	}
+
+	snippet := l.envSnippetPath()
+	if err := os.MkdirAll(path.Dir(snippet), 0755); err != nil {
+		return err
+	}
+
+	if err := j.recordFile(snippet); err != nil {
+		return err
+	}
+
+	return os.WriteFile(snippet, []byte("# autogenerated by fingertip\nauto_proxy="+autoURL+"\n"), 0644)
+}
+
+func (l *linuxSystem) uninstallAutoProxy(autoURL string) {
+	if l.has("gsettings") {
+		if status, _ := l.gnomeProxyStatus(autoURL); status == ProxyStatusInstalled {
+			_, _ = l.run("gsettings", "set", gnomeProxySchema, "mode", "none")
+			_, _ = l.run("gsettings", "reset", gnomeProxySchema, "autoconfig-url")
+		}
+	}
+
+	if status, _ := l.kdeProxyStatus(autoURL); status == ProxyStatusInstalled {
+		_ = writeINISection(l.kioslavercPath(), "Proxy Settings", map[string]string{
+			"ProxyType":           "0",
+			"Proxy Config Script": "",
+		})
+	}
+
+	snippet := l.envSnippetPath()
+	if ok, _, _ := fileLineContains(snippet, "auto_proxy="+autoURL); ok {
+		_ = os.Remove(snippet)
+	}
+}
+
+// nssDB the shared NSS database used
+// by chromium and other NSS clients
+func (l *linuxSystem) nssDB() string {
+	return "sql:" + path.Join(l.home, ".pki/nssdb")
+}
+
+// addNSSCert adds the CA to db replacing
+// an older CA with the same nickname
+func (l *linuxSystem) addNSSCert(j *Journal, db, certPath string) error {
+	s := Step{Kind: stepNSS, Target: db, Key: nssNickname}
+	if out, err := l.run("certutil", "-L", "-d", db, "-n", nssNickname, "-r"); err == nil {
+		s.Existed = true
+		s.Prior = out
+	}
+
+	if err := j.record(s); err != nil {
+		return err
+	}
+
+	_, _ = l.run("certutil", "-D", "-d", db, "-n", nssNickname)
+	if out, err := l.run("certutil", "-A", "-d", db, "-n", nssNickname, "-t", "C,,", "-i", certPath); err != nil {
+		return fmt.Errorf("failed installing cert: %s", strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+func (l *linuxSystem) removeNSSCert(db string) error {
+	if out, err := l.run("certutil", "-D", "-d", db, "-n", nssNickname); err != nil {
+		return fmt.Errorf("failed removing cert: %s", strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+func (l *linuxSystem) installNSS(j *Journal, certPath string) error {
+	if !l.has("certutil") {
+		return errors.New("certutil not found install libnss3-tools or nss-tools")
+	}
+
+	dir := path.Join(l.home, ".pki/nssdb")
+	if _, err := os.Stat(path.Join(dir, "cert9.db")); errors.Is(err, fs.ErrNotExist) {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+		for _, name := range []string{"cert9.db", "key4.db", "pkcs11.txt"} {
+			if err := j.recordFile(path.Join(dir, name)); err != nil {
+				return err
+			}
+		}
+		if out, err := l.run("certutil", "-N", "-d", l.nssDB(), "--empty-password"); err != nil {
+			return fmt.Errorf("failed creating nss db: %s", strings.TrimSpace(string(out)))
+		}
+	}
+
+	return l.addNSSCert(j, l.nssDB(), certPath)
+}
+
+func (l *linuxSystem) uninstallNSS() error {
+	if !l.has("certutil") {
+		return nil
+	}
+
+	return l.removeNSSCert(l.nssDB())
+}
+
+// verifyNSS checks the NSS db has cert
+func (l *linuxSystem) verifyNSS(cert *x509.Certificate) error {
+	if !l.has("certutil") {
+		return errors.New("certutil not found")
+	}
+
+	out, err := l.run("certutil", "-L", "-d", l.nssDB(), "-n", nssNickname, "-r")
+	if err != nil {
+		return fmt.Errorf("cert not found in nss db")
+	}
+
+	if !bytes.Equal(out, cert.Raw) {
+		return fmt.Errorf("nss db has a different cert")
+	}
+
+	return nil
+}
+
+func (l *linuxSystem) firefoxRoots() []string {
+	return []string{
+		path.Join(l.home, ".mozilla/firefox"),
+		// snap and flatpak
+		path.Join(l.home, "snap/firefox/common/.mozilla/firefox"),
+		path.Join(l.home, ".var/app/org.mozilla.firefox/.mozilla/firefox"),
+	}
+}
+
+// browserNSSDBs NSS dbs of browsers not using the shared
+// one firefox profiles and snap packaged chromium browsers
+func (l *linuxSystem) browserNSSDBs() []string {
+	var dirs []string
+	for _, dir := range snapNSSDBs {
+		dirs = append(dirs, path.Join(l.home, dir))
+	}
+
+	for _, root := range l.firefoxRoots() {
+		profiles, _ := firefoxProfiles(root)
+		dirs = append(dirs, profiles...)
+	}
+
+	var dbs []string
+	for _, dir := range dirs {
+		if _, err := os.Stat(path.Join(dir, "cert9.db")); err == nil {
+			dbs = append(dbs, "sql:"+dir)
+		}
+	}
+
+	return dbs
+}
+
+// policyFiles managed policy files of installed
+// chromium based browsers or only existing ones
+func (l *linuxSystem) policyFiles(existing bool) []string {
+	var files []string
+	for _, p := range chromiumPolicyDirs {
+		file := path.Join(l.root, p.dir, policyFileName)
+		if existing {
+			if _, err := os.Stat(file); err == nil {
+				files = append(files, file)
+			}
+			continue
+		}
+
+		for _, bin := range p.binaries {
+			if l.has(bin) {
+				files = append(files, file)
+				break
+			}
+		}
+	}
+
+	return files
+}
+
+func (l *linuxSystem) installPolicies(j *Journal, autoURL string) error {
+	files := l.policyFiles(false)
+	if len(files) == 0 {
+		return nil
+	}
+
+	policy, err := chromiumPolicy(autoURL)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := j.recordFileStep(Step{Kind: stepRootFile, Target: file}); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.CreateTemp("", "fingertip-policy-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(policy)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	args := append([]string{f.Name()}, files...)
+	if out, err := l.elevated(`src=$1; shift; for dst; do install -D -m 0644 "$src" "$dst" || exit 1; done`, args...); err != nil {
+		return fmt.Errorf("failed installing browser policy: %s", strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+func (l *linuxSystem) uninstallPolicies() error {
+	files := l.policyFiles(true)
+	if len(files) == 0 {
+		return nil
+	}
+
+	if out, err := l.elevated(`rm -f "$@"`, files...); err != nil {
+		return fmt.Errorf("failed removing browser policy: %s", strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+func (l *linuxSystem) configureBrowsers(j *Journal, autoURL, certPath string) error {
+	var lastErr error
+	if l.has("certutil") {
+		for _, db := range l.browserNSSDBs() {
+			if err := l.addNSSCert(j, db, certPath); err != nil {
+				lastErr = err
+			}
+		}
+	}
+
+	if UseBrowserPolicies {
+		if err := l.installPolicies(j, autoURL); err != nil {
+			lastErr = err
+		}
+	}
+
+	return lastErr
+}
+
+func (l *linuxSystem) undoBrowsers() {
+	if l.has("certutil") {
+		for _, db := range l.browserNSSDBs() {
+			_ = l.removeNSSCert(db)
+		}
+	}
+
+	_ = l.uninstallPolicies()
+}
+
+func (l *linuxSystem) trustStore() (*trustStore, error) {
+	for _, s := range trustStores {
+		if _, err := os.Stat(path.Join(l.root, s.anchors)); err != nil {
+			continue
+		}
+
+		if l.has(s.update[0]) {
+			return &s, nil
+		}
+	}
+
+	return nil, errors.New("no supported distro trust store found")
+}
+
+// elevated runs a shell script as root
+// with pkexec unless already root
+func (l *linuxSystem) elevated(script string, args ...string) ([]byte, error) {
+	args = append([]string{"-c", script, "sh"}, args...)
+	if l.euid == 0 {
+		return l.run("sh", args...)
+	}
+
+	return l.run("pkexec", append([]string{"sh"}, args...)...)
+}
+
+func (l *linuxSystem) installTrustStore(j *Journal, certPath string) error {
+	s, err := l.trustStore()
+	if err != nil {
+		return err
+	}
+
+	dst := path.Join(l.root, s.anchors, s.name)
+	if err := j.recordFileStep(Step{Kind: stepRootFile, Target: dst, Command: s.update}); err != nil {
+		return err
+	}
+
+	args := append([]string{certPath, dst}, s.update...)
+	if out, err := l.elevated(`install -m 0644 "$1" "$2" && shift 2 && exec "$@"`, args...); err != nil {
+		return fmt.Errorf("failed installing cert in the system trust store: %s", strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+func (l *linuxSystem) uninstallTrustStore() error {
+	s, err := l.trustStore()
+	if err != nil {
+		return nil
+	}
+
+	dst := path.Join(l.root, s.anchors, s.name)
+	if _, err := os.Stat(dst); err != nil {
+		return nil
+	}
+
+	args := append([]string{dst}, s.update...)
+	if out, err := l.elevated(`rm -f "$1" && shift && exec "$@"`, args...); err != nil {
+		return fmt.Errorf("failed removing cert from the system trust store: %s", strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// verifyTrustStore checks the distro
+// trust store anchors has cert
+func (l *linuxSystem) verifyTrustStore(cert *x509.Certificate) error {
+	s, err := l.trustStore()
+	if err != nil {
+		return err
+	}
+
+	installed, err := readX509Cert(path.Join(l.root, s.anchors, s.name))
+	if err != nil {
+		return err
+	}
+
+	if !installed.Equal(cert) {
+		return errors.New("system trust store has a different cert")
+	}
+
+	return nil
+}
+
+func (l *linuxSystem) installCert(j *Journal, certPath string) error {
+	if err := l.installNSS(j, certPath); err != nil {
+		return err
+	}
+
+	if !UseSystemTrustStore {
+		return nil
+	}
+
+	return l.installTrustStore(j, certPath)
+}
+
+func (l *linuxSystem) uninstallCert() error {
+	err := l.uninstallNSS()
+	if storeErr := l.uninstallTrustStore(); storeErr != nil {
+		err = storeErr
+	}
+
+	return err
+}
+
+func (l *linuxSystem) rotateCert(j *Journal, certPath string) error {
+	if err := l.installCert(j, certPath); err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, db := range l.browserNSSDBs() {
+		if err := l.addNSSCert(j, db, certPath); err != nil {
+			lastErr = err
+		}
+	}
+
+	return lastErr
+}
+
+// undo reverts a journal step
+func (l *linuxSystem) undo(s Step) error {
+	switch s.Kind {
+	case stepGSettings:
+		if out, err := l.run("gsettings", "set", s.Target, s.Key, string(s.Prior)); err != nil {
+			return fmt.Errorf("failed restoring %s: %s", s.Key, strings.TrimSpace(string(out)))
+		}
+		return nil
+	case stepNSS:
+		if !l.has("certutil") {
+			return errors.New("certutil not found")
+		}
+
+		_, _ = l.run("certutil", "-D", "-d", s.Target, "-n", s.Key)
+		if !s.Existed {
+			return nil
+		}
+
+		prior, err := writeTempPEM(s.Prior)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(prior)
+
+		if out, err := l.run("certutil", "-A", "-d", s.Target, "-n", s.Key, "-t", "C,,", "-i", prior); err != nil {
+			return fmt.Errorf("failed restoring cert: %s", strings.TrimSpace(string(out)))
+		}
+		return nil
+	case stepRootFile:
+		src := ""
+		if s.Existed {
+			f, err := os.CreateTemp("", "fingertip-restore-*")
+			if err != nil {
+				return err
+			}
+			defer os.Remove(f.Name())
+
+			_, err = f.Write(s.Prior)
+			f.Close()
+			if err != nil {
+				return err
+			}
+			src = f.Name()
+		}
+
+		args := append([]string{src, s.Target, fmt.Sprintf("%o", s.Mode)}, s.Command...)
+		if out, err := l.elevated(`if [ -n "$1" ]; then install -m "$3" "$1" "$2"; else rm -f "$2"; fi && shift 3 && if [ $# -gt 0 ]; then exec "$@"; fi`, args...); err != nil {
+			return fmt.Errorf("failed restoring %s: %s", s.Target, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+
+	return undoCommonStep(s)
+}
+
+func (l *linuxSystem) verifyCert(certPath string) error {
+	cert, err := readX509Cert(certPath)
+	if err != nil {
+		return err
+	}
+
+	if err := l.verifyNSS(cert); err == nil {
+		return nil
+	}
+
+	if UseSystemTrustStore {
+		return l.verifyTrustStore(cert)
+	}
+
+	return errors.New("cert isn't installed")
+}
 
 func VerifyCert(certPath string) (err error) {
-	var cert *x509.Certificate
-	if cert, err = readX509Cert(certPath); err != nil {
-		return
+	l, err := newLinuxSystem()
+	if err != nil {
+		return err
 	}
 
-	_, err = cert.Verify(x509.VerifyOptions{})
-	return
+	return l.verifyCert(certPath)
 }
 
 // Supported whether auto configuration
 // is supported for this build
 func Supported() bool {
-	return false
+	return true
 }
 
 func UninstallAutoProxy(autoURL string) {
-	return
+	l, err := newLinuxSystem()
+	if err != nil {
+		return
+	}
+
+	l.uninstallAutoProxy(autoURL)
+}
+
+func InstallAutoProxy(j *Journal, autoURL string) error {
+	l, err := newLinuxSystem()
+	if err != nil {
+		return err
+	}
+
+	return l.installAutoProxy(j, autoURL)
 }
 
-func InstallAutoProxy(autoURL string) error {
-	return errors.New("not supported")
+func InstallCert(j *Journal, certPath string) error {
+	l, err := newLinuxSystem()
+	if err != nil {
+		return err
+	}
+
+	return l.installCert(j, certPath)
 }
 
-func InstallCert(certPath string) error {
-	return errors.New("not supported")
+// RotateCert installs the CA at certPath in place of the
+// previous one certs with the same nickname and files
+// are replaced so prev isn't needed on linux
+func RotateCert(j *Journal, prev []byte, certPath string) error {
+	l, err := newLinuxSystem()
+	if err != nil {
+		return err
+	}
+
+	return l.rotateCert(j, certPath)
 }
 
 func UninstallCert(certPath string) error {
-	return errors.New("not supported")
+	l, err := newLinuxSystem()
+	if err != nil {
+		return err
+	}
+
+	return l.uninstallCert()
+}
+
+func firefoxRoots() ([]string, error) {
+	l, err := newLinuxSystem()
+	if err != nil {
+		return nil, err
+	}
+
+	return l.firefoxRoots(), nil
+}
+
+func configureBrowsers(j *Journal, autoURL, certPath string) error {
+	l, err := newLinuxSystem()
+	if err != nil {
+		return err
+	}
+
+	return l.configureBrowsers(j, autoURL, certPath)
+}
+
+func undoBrowsers() {
+	l, err := newLinuxSystem()
+	if err != nil {
+		return
+	}
+
+	l.undoBrowsers()
+}
+
+func undoStep(s Step) error {
+	l, err := newLinuxSystem()
+	if err != nil {
+		return err
+	}
+
+	return l.undo(s)
 }
@@ -0,0 +1,351 @@
+//go:build linux
+
+package auto
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSystem emulates gsettings and certutil
+type fakeSystem struct {
+	gsettings map[string]string
+	nss       map[string][]byte
+	root      string
+	commands  []string
+}
+
+func (f *fakeSystem) run(name string, args ...string) ([]byte, error) {
+	f.commands = append(f.commands, name+" "+strings.Join(args, " "))
+
+	switch name {
+	case "gsettings":
+		switch args[0] {
+		case "get":
+			return []byte("'" + f.gsettings[args[2]] + "'\n"), nil
+		case "set":
+			f.gsettings[args[2]] = args[3]
+		case "reset":
+			delete(f.gsettings, args[2])
+		}
+		return nil, nil
+	case "certutil":
+		// certs are keyed by db and nickname
+		var db, nick string
+		for i, arg := range args {
+			switch arg {
+			case "-d":
+				db = args[i+1]
+			case "-n":
+				nick = args[i+1]
+			}
+		}
+		nick = db + " " + nick
+
+		switch args[0] {
+		case "-A":
+			cert, err := readPEM(args[len(args)-1])
+			if err != nil {
+				return nil, err
+			}
+			f.nss[nick] = cert
+		case "-D":
+			if _, ok := f.nss[nick]; !ok {
+				return []byte("could not find certificate"), errors.New("exit status 255")
+			}
+			delete(f.nss, nick)
+		case "-L":
+			cert, ok := f.nss[nick]
+			if !ok {
+				return []byte("could not find certificate"), errors.New("exit status 255")
+			}
+			return cert, nil
+		}
+		return nil, nil
+	case "pkexec":
+		// paths are in a temp root
+		return runCommand(args[0], args[1:]...)
+	case "sh":
+		return runCommand(name, args...)
+	}
+
+	return nil, errors.New("unknown command " + name)
+}
+
+func (f *fakeSystem) lookPath(name string) (string, error) {
+	return "/usr/bin/" + name, nil
+}
+
+func writeTestCert(t *testing.T, certPath string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fingertip test"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestSystem(t *testing.T) (*linuxSystem, *fakeSystem) {
+	dir := t.TempDir()
+	f := &fakeSystem{
+		gsettings: map[string]string{"mode": "none"},
+		nss:       make(map[string][]byte),
+		root:      path.Join(dir, "root"),
+	}
+
+	if err := os.MkdirAll(path.Join(f.root, "usr/local/share/ca-certificates"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	stores := trustStores
+	trustStores = []trustStore{{"/usr/local/share/ca-certificates", "fingertip.crt", []string{"true"}}}
+	t.Cleanup(func() { trustStores = stores })
+
+	return &linuxSystem{
+		root:      f.root,
+		home:      path.Join(dir, "home"),
+		configDir: path.Join(dir, "home/.config"),
+		desktop:   "KDE",
+		euid:      1000,
+		run:       f.run,
+		lookPath:  f.lookPath,
+	}, f
+}
+
+func openTestJournal(t *testing.T) *Journal {
+	j, err := OpenJournal(path.Join(t.TempDir(), JournalFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return j
+}
+
+func TestLinuxAutoProxy(t *testing.T) {
+	l, f := newTestSystem(t)
+	j := openTestJournal(t)
+	autoURL := "http://127.0.0.1:9590/proxy.pac"
+	f.gsettings["autoconfig-url"] = "http://old.example/proxy.pac"
+
+	if err := os.MkdirAll(l.configDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(l.kioslavercPath(), []byte("[Other]\nkey=value\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.installAutoProxy(j, autoURL); err != nil {
+		t.Fatal(err)
+	}
+
+	if f.gsettings["mode"] != "auto" || f.gsettings["autoconfig-url"] != autoURL {
+		t.Fatalf("got gsettings = %v, want auto %s", f.gsettings, autoURL)
+	}
+
+	values, err := readINISection(l.kioslavercPath(), "Proxy Settings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["ProxyType"] != "2" || values["Proxy Config Script"] != autoURL {
+		t.Fatalf("got kioslaverc = %v, want pac url %s", values, autoURL)
+	}
+
+	if ok, _, _ := fileLineContains(l.envSnippetPath(), "auto_proxy="+autoURL); !ok {
+		t.Fatalf("got no auto_proxy in %s", l.envSnippetPath())
+	}
+
+	// installing twice is a no-op
+	if err := l.installAutoProxy(j, autoURL); err != nil {
+		t.Fatal(err)
+	}
+
+	// and doesn't record fingertip's own settings
+	again := openTestJournal(t)
+	if err := l.installAutoProxy(again, autoURL); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range again.steps {
+		if s.Target == l.kioslavercPath() || s.Kind == stepGSettings {
+			t.Fatalf("got step %v recorded, want installed settings skipped", s)
+		}
+	}
+
+	// revert from another process
+	j, err = OpenJournal(j.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := j.undo(l.undo); err != nil {
+		t.Fatal(err)
+	}
+
+	if f.gsettings["mode"] != "none" || f.gsettings["autoconfig-url"] != "http://old.example/proxy.pac" {
+		t.Fatalf("got gsettings = %v, want prior values", f.gsettings)
+	}
+
+	if values, _ = readINISection(l.kioslavercPath(), "Proxy Settings"); len(values) != 0 {
+		t.Fatalf("got kioslaverc = %v, want no proxy keys", values)
+	}
+
+	if values, _ = readINISection(l.kioslavercPath(), "Other"); values["key"] != "value" {
+		t.Fatalf("got other section = %v, want key=value", values)
+	}
+
+	for _, file := range []string{l.envSnippetPath(), j.path} {
+		if _, err := os.Stat(file); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("got %s err = %v, want removed", file, err)
+		}
+	}
+
+	// keep user settings
+	f.gsettings["mode"] = "manual"
+	if err := writeINISection(l.kioslavercPath(), "Proxy Settings", map[string]string{"ProxyType": "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.installAutoProxy(j, autoURL); err == nil {
+		t.Fatal("got no error, want existing proxy settings conflict")
+	}
+}
+
+func TestLinuxCert(t *testing.T) {
+	l, f := newTestSystem(t)
+	j := openTestJournal(t)
+	certPath := path.Join(t.TempDir(), "cert.crt")
+	writeTestCert(t, certPath)
+
+	if err := l.verifyCert(certPath); err == nil {
+		t.Fatal("got cert verified, want not installed")
+	}
+
+	// an older CA with the same nickname
+	prior := path.Join(t.TempDir(), "prior.crt")
+	writeTestCert(t, prior)
+	if err := l.addNSSCert(nil, l.nssDB(), prior); err != nil {
+		t.Fatal(err)
+	}
+	priorDER := f.nss[l.nssDB()+" "+nssNickname]
+
+	UseSystemTrustStore = true
+	defer func() { UseSystemTrustStore = false }()
+
+	if err := l.installCert(j, certPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.verifyCert(certPath); err != nil {
+		t.Fatalf("got err = %v, want cert verified", err)
+	}
+
+	cert, _ := readX509Cert(certPath)
+	if err := l.verifyTrustStore(cert); err != nil {
+		t.Fatalf("got trust store err = %v, want installed", err)
+	}
+
+	elevated := false
+	for _, cmd := range f.commands {
+		elevated = elevated || strings.HasPrefix(cmd, "pkexec sh -c install")
+	}
+	if !elevated {
+		t.Fatalf("got commands = %v, want pkexec install", f.commands)
+	}
+
+	if err := j.undo(l.undo); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.verifyCert(certPath); err == nil {
+		t.Fatal("got cert verified, want removed")
+	}
+
+	if got := f.nss[l.nssDB()+" "+nssNickname]; !bytes.Equal(got, priorDER) {
+		t.Fatal("got prior cert replaced, want restored")
+	}
+}
+
+func TestLinuxBrowsers(t *testing.T) {
+	l, f := newTestSystem(t)
+	j := openTestJournal(t)
+	autoURL := "http://127.0.0.1:9590/proxy.pac"
+	certPath := path.Join(t.TempDir(), "cert.crt")
+	writeTestCert(t, certPath)
+
+	root := path.Join(l.home, ".mozilla/firefox")
+	for _, dir := range []string{path.Join(root, "abc.dev-edition"), path.Join(l.home, "snap/chromium/current/.pki/nssdb")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path.Join(dir, "cert9.db"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ini := "[Profile0]\nName=dev\nIsRelative=1\nPath=abc.dev-edition\n"
+	if err := os.WriteFile(path.Join(root, "profiles.ini"), []byte(ini), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	UseBrowserPolicies = true
+	defer func() { UseBrowserPolicies = false }()
+
+	if err := l.configureBrowsers(j, autoURL, certPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := len(l.browserNSSDBs()); got != 2 {
+		t.Fatalf("got %d nss dbs, want 2", got)
+	}
+
+	if len(f.nss) != 2 {
+		t.Fatalf("got %d certs imported, want 2", len(f.nss))
+	}
+
+	files := l.policyFiles(true)
+	if len(files) != len(chromiumPolicyDirs) {
+		t.Fatalf("got %d policy files, want %d", len(files), len(chromiumPolicyDirs))
+	}
+
+	if ok, _, _ := fileLineContains(files[0], autoURL); !ok {
+		t.Fatalf("got no pac url in %s", files[0])
+	}
+
+	if err := j.undo(l.undo); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(f.nss) != 0 {
+		t.Fatalf("got %d certs imported, want removed", len(f.nss))
+	}
+
+	if files = l.policyFiles(true); len(files) != 0 {
+		t.Fatalf("got policy files = %v, want removed", files)
+	}
+}
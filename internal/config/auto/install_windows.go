@@ -9,12 +9,12 @@ import (
 	"fmt"
 	"golang.org/x/sys/windows/registry"
 	"math/big"
+	"os"
+	"path"
 	"syscall"
 	"unsafe"
 )
 
-var relativeProfilesPath = "Mozilla/Firefox/Profiles"
-
 func VerifyCert(certPath string) (err error) {
 	var cert *x509.Certificate
 	if cert, err = readX509Cert(certPath); err != nil {
@@ -37,6 +37,14 @@ var (
 
 type windowsRootStore uintptr
 
+const internetSettings = `SOFTWARE\Microsoft\Windows\CurrentVersion\Internet Settings`
+
+// journal steps
+const (
+	stepRegistry  = "registry"
+	stepCertStore = "certstore"
+)
+
 // Supported whether auto configuration
 // is supported for this build
 func Supported() bool {
@@ -79,7 +87,7 @@ func UninstallAutoProxy(autoURL string) {
 	return
 }
 
-func InstallAutoProxy(autoURL string) error {
+func InstallAutoProxy(j *Journal, autoURL string) error {
 	status, err := getProxyStatus(autoURL)
 	if err != nil {
 		return fmt.Errorf("failed reading proxy status")
@@ -98,19 +106,34 @@ func InstallAutoProxy(autoURL string) error {
 	}
 	defer k.Close()
 
+	prior, _, err := k.GetStringValue("AutoConfigURL")
+	if err := j.record(Step{
+		Kind:    stepRegistry,
+		Target:  internetSettings,
+		Key:     "AutoConfigURL",
+		Existed: err == nil,
+		Prior:   []byte(prior),
+	}); err != nil {
+		return err
+	}
+
 	if err = k.SetStringValue("AutoConfigURL", autoURL); err != nil {
 		return fmt.Errorf("failed setting AutoConfigURL: %v", err)
 	}
 	return nil
 }
 
-func InstallCert(certPath string) error {
+func InstallCert(j *Journal, certPath string) error {
 	// Load cert
 	cert, err := readPEM(certPath)
 	if err != nil {
 		return err
 	}
 
+	if err := j.record(Step{Kind: stepCertStore, Target: "ROOT", Existed: VerifyCert(certPath) == nil, Value: cert}); err != nil {
+		return err
+	}
+
 	// Open root store
 	store, err := openWindowsRootStore()
 	if err != nil {
@@ -125,6 +148,46 @@ func InstallCert(certPath string) error {
 	return nil
 }
 
+// RotateCert installs the CA at certPath and removes
+// the previous one prev from the root store by serial
+func RotateCert(j *Journal, prev []byte, certPath string) error {
+	if err := InstallCert(j, certPath); err != nil {
+		return err
+	}
+
+	cert, err := readPEM(certPath)
+	if err != nil {
+		return err
+	}
+
+	if err := deleteRootCert(prev); err != nil {
+		return err
+	}
+
+	return j.updateValue(stepCertStore, "ROOT", cert)
+}
+
+// deleteRootCert deletes certs with the serial
+// of a DER cert from the root store
+func deleteRootCert(der []byte) error {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return err
+	}
+
+	store, err := openWindowsRootStore()
+	if err != nil {
+		return err
+	}
+	defer store.close()
+
+	if _, err := store.deleteCertsWithSerial(cert.SerialNumber); err != nil {
+		return fmt.Errorf("failed deleting cert: %v", err)
+	}
+
+	return nil
+}
+
 func UninstallCert(certPath string) error {
 	cert, err := readX509Cert(certPath)
 	if err != nil {
@@ -152,6 +215,34 @@ func UninstallCert(certPath string) error {
 	return nil
 }
 
+func undoStep(s Step) error {
+	switch s.Kind {
+	case stepRegistry:
+		k, err := registry.OpenKey(registry.CURRENT_USER, s.Target, registry.ALL_ACCESS)
+		if err != nil {
+			return fmt.Errorf("failed reading from registry: %v", err)
+		}
+		defer k.Close()
+
+		if s.Existed {
+			return k.SetStringValue(s.Key, string(s.Prior))
+		}
+
+		if err := k.DeleteValue(s.Key); err != nil && err != registry.ErrNotExist {
+			return fmt.Errorf("failed deleting %s: %v", s.Key, err)
+		}
+		return nil
+	case stepCertStore:
+		if s.Existed {
+			return nil
+		}
+
+		return deleteRootCert(s.Value)
+	}
+
+	return undoCommonStep(s)
+}
+
 func openWindowsRootStore() (windowsRootStore, error) {
 	rootStr, err := syscall.UTF16PtrFromString("ROOT")
 	if err != nil {
@@ -218,3 +309,19 @@ func (w windowsRootStore) deleteCertsWithSerial(serial *big.Int) (bool, error) {
 	}
 	return deletedAny, nil
 }
+
+func firefoxRoots() ([]string, error) {
+	c, err := os.UserConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{path.Join(c, "Mozilla/Firefox")}, nil
+}
+
+// browsers use the OS proxy and certificate settings
+func configureBrowsers(j *Journal, autoURL, certPath string) error {
+	return nil
+}
+
+func undoBrowsers() {}
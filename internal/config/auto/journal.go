@@ -0,0 +1,263 @@
+package auto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// JournalFileName the journal of auto configuration
+// steps kept in the app config directory
+const JournalFileName = "autoconfig.journal"
+
+const (
+	stepFile = "file"
+	stepINI  = "ini"
+)
+
+// Step a change made by auto configuration
+// with the exact value it replaced
+type Step struct {
+	Kind    string `json:"kind"`
+	Target  string `json:"target"`
+	Section string `json:"section,omitempty"`
+	Key     string `json:"key,omitempty"`
+	// Existed whether there was a prior value
+	Existed bool        `json:"existed"`
+	Prior   []byte      `json:"prior,omitempty"`
+	Mode    fs.FileMode `json:"mode,omitempty"`
+	// Value what was installed if needed
+	// to remove it such as a cert
+	Value []byte `json:"value,omitempty"`
+	// Command run after reverting
+	Command []string `json:"command,omitempty"`
+}
+
+func (s Step) id() string {
+	return s.Kind + "|" + s.Target + "|" + s.Section + "|" + s.Key
+}
+
+// Journal records each auto configuration step before
+// it's made so it can be reverted after a crash or
+// from another process
+type Journal struct {
+	path  string
+	steps []Step
+}
+
+// OpenJournal reads the journal at path
+// a missing journal has no steps
+func OpenJournal(path string) (*Journal, error) {
+	j := &Journal{path: path}
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed reading journal: %v", err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 4<<20)
+	for sc.Scan() {
+		var s Step
+		// a step cut short by a crash
+		// was never made
+		if err := json.Unmarshal(sc.Bytes(), &s); err != nil {
+			continue
+		}
+		j.steps = append(j.steps, s)
+	}
+
+	return j, sc.Err()
+}
+
+// Empty whether the journal has no steps
+func (j *Journal) Empty() bool {
+	return j == nil || len(j.steps) == 0
+}
+
+// record appends s unless the same setting was
+// already recorded keeping its original value
+func (j *Journal) record(s Step) error {
+	if j == nil {
+		return nil
+	}
+
+	for _, recorded := range j.steps {
+		if recorded.id() == s.id() {
+			return nil
+		}
+	}
+
+	line, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(j.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed writing journal: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed writing journal: %v", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed writing journal: %v", err)
+	}
+
+	j.steps = append(j.steps, s)
+	return nil
+}
+
+// Undo reverts recorded steps newest first steps
+// that fail are kept to be retried
+func (j *Journal) Undo() error {
+	return j.undo(undoStep)
+}
+
+func (j *Journal) undo(undoStep func(Step) error) error {
+	if j.Empty() {
+		return nil
+	}
+
+	var failed []Step
+	var errs []error
+	for i := len(j.steps) - 1; i >= 0; i-- {
+		if err := undoStep(j.steps[i]); err != nil {
+			failed = append([]Step{j.steps[i]}, failed...)
+			errs = append(errs, err)
+		}
+	}
+
+	j.steps = failed
+	if err := j.rewrite(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// rewrite writes the journal with its
+// current steps removing it if empty
+func (j *Journal) rewrite() error {
+	if len(j.steps) == 0 {
+		if err := os.Remove(j.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	var buf bytes.Buffer
+	for _, s := range j.steps {
+		line, _ := json.Marshal(s)
+		buf.Write(append(line, '\n'))
+	}
+
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed writing journal: %v", err)
+	}
+
+	return os.Rename(tmp, j.path)
+}
+
+// updateValue sets the installed value of a recorded
+// step after it's replaced such as a rotated cert
+func (j *Journal) updateValue(kind, target string, value []byte) error {
+	if j == nil {
+		return nil
+	}
+
+	for i, s := range j.steps {
+		if s.Kind == kind && s.Target == target {
+			j.steps[i].Value = value
+			return j.rewrite()
+		}
+	}
+
+	return nil
+}
+
+// recordFile records the content of file
+// before it's written or removed
+func (j *Journal) recordFile(file string) error {
+	return j.recordFileStep(Step{Kind: stepFile, Target: file})
+}
+
+// recordFileStep records the content of
+// the file s targets as its prior value
+func (j *Journal) recordFileStep(s Step) error {
+	file := s.Target
+	info, err := os.Stat(file)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	if err == nil {
+		if s.Prior, err = os.ReadFile(file); err != nil {
+			return err
+		}
+		s.Existed = true
+		s.Mode = info.Mode().Perm()
+	}
+
+	return j.record(s)
+}
+
+// recordINI records keys of section in
+// an ini file before they're changed
+func (j *Journal) recordINI(file, section string, keys ...string) error {
+	values, err := readINISection(file, section)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	for _, key := range keys {
+		value, ok := values[key]
+		if err := j.record(Step{
+			Kind:    stepINI,
+			Target:  file,
+			Section: section,
+			Key:     key,
+			Existed: ok,
+			Prior:   []byte(value),
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// undoCommonStep reverts steps made
+// the same way on all platforms
+func undoCommonStep(s Step) error {
+	switch s.Kind {
+	case stepFile:
+		if !s.Existed {
+			if err := os.Remove(s.Target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			return nil
+		}
+
+		if err := os.WriteFile(s.Target, s.Prior, s.Mode); err != nil {
+			return err
+		}
+		return os.Chmod(s.Target, s.Mode)
+	case stepINI:
+		return writeINISection(s.Target, s.Section, map[string]string{s.Key: string(s.Prior)})
+	}
+
+	return fmt.Errorf("unknown journal step %s", s.Kind)
+}
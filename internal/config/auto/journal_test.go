@@ -0,0 +1,94 @@
+package auto
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	dir := t.TempDir()
+	userjs := path.Join(dir, "user.js")
+	created := path.Join(dir, "created.txt")
+	ini := path.Join(dir, "settings.ini")
+
+	if err := os.WriteFile(userjs, []byte("user_pref(\"a\", 1);\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(ini, []byte("[Proxy]\nType=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := OpenJournal(path.Join(dir, JournalFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range []string{userjs, created} {
+		if err := j.recordFile(file); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte("changed"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(file, 0644); err != nil {
+			t.Fatal(err)
+		}
+		// the first prior value is kept
+		if err := j.recordFile(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := j.recordINI(ini, "Proxy", "Type", "URL"); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeINISection(ini, "Proxy", map[string]string{"Type": "2", "URL": "http://a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a step cut short by a crash
+	f, err := os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"kind":"file","tar`)
+	f.Close()
+
+	if j, err = OpenJournal(j.path); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := len(j.steps); got != 4 {
+		t.Fatalf("got %d steps, want 4", got)
+	}
+
+	if err := j.Undo(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := os.ReadFile(userjs)
+	if string(b) != "user_pref(\"a\", 1);\n" {
+		t.Fatalf("got user.js = %q, want prior content", b)
+	}
+
+	if info, _ := os.Stat(userjs); info.Mode().Perm() != 0600 {
+		t.Fatalf("got user.js mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	values, _ := readINISection(ini, "Proxy")
+	if len(values) != 1 || values["Type"] != "1" {
+		t.Fatalf("got ini = %v, want Type=1", values)
+	}
+
+	for _, file := range []string{created, j.path} {
+		if _, err := os.Stat(file); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("got %s err = %v, want removed", file, err)
+		}
+	}
+
+	if !j.Empty() {
+		t.Fatal("got steps, want empty journal")
+	}
+}
@@ -0,0 +1,246 @@
+package config
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/randomlogin/sane"
+	"github.com/randomlogin/sane/tld"
+)
+
+const (
+	// CAValidity lifetime of a generated CA
+	CAValidity = 365 * 24 * time.Hour
+	// CARenewBefore a successor CA is generated
+	// this long before the current one expires
+	CARenewBefore = 30 * 24 * time.Hour
+	// CAWarnBefore expiry is reported in the debug
+	// info and the tray this long before
+	CAWarnBefore = 14 * 24 * time.Hour
+)
+
+// PrevCertFileName the CAs replaced by a new one kept until
+// they're removed from the trust stores they were installed in
+const PrevCertFileName = "fingertip.prev.crt"
+
+// writeCA generates a new CA at certPath
+// with its private key in keys
+func writeCA(certPath string, keys keyStore) error {
+	ca, priv, err := sane.NewAuthority(CertName, CertName, CAValidity, tld.NameConstraints)
+	if err != nil {
+		return fmt.Errorf("couldn't generate CA: %v", err)
+	}
+
+	return storeCA(certPath, keys, ca, priv)
+}
+
+// storeCA writes cert to certPath
+// and its private key to keys
+func storeCA(certPath string, keys keyStore, cert *x509.Certificate, priv interface{}) error {
+	var keyPEM []byte
+	switch k := priv.(type) {
+	case *rsa.PrivateKey:
+		keyPEM = pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(k),
+		})
+	default:
+		der, err := x509.MarshalPKCS8PrivateKey(priv)
+		if err != nil {
+			return fmt.Errorf("couldn't encode CA private key: %v", err)
+		}
+		keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	}
+
+	if err := keys.store(keyPEM); err != nil {
+		return fmt.Errorf("couldn't store CA private key in %s: %v", keys, err)
+	}
+
+	if err := writeFileAtomic(certPath, encodeCert(cert), 0644); err != nil {
+		return fmt.Errorf("couldn't create CA file: %v", err)
+	}
+
+	return nil
+}
+
+func encodeCert(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: cert.Raw,
+	})
+}
+
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, name)
+}
+
+func readCert(certPath string) (*x509.Certificate, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read certificate file: %v", err)
+	}
+
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, fmt.Errorf("couldn't parse certificate PEM")
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse certificate: %v", err)
+	}
+
+	return cert, nil
+}
+
+// keepPreviousCA adds the current cert to the previous
+// CAs so it can be removed from trust stores
+func (c *App) keepPreviousCA(certPath string) error {
+	cert, err := readCert(certPath)
+	if err != nil {
+		return nil
+	}
+
+	prevs, err := c.PreviousCAs()
+	if err != nil {
+		return err
+	}
+
+	return c.writePreviousCAs(append(prevs, cert))
+}
+
+func (c *App) writePreviousCAs(certs []*x509.Certificate) error {
+	if len(certs) == 0 {
+		return c.RemovePreviousCAs()
+	}
+
+	var b []byte
+	for _, cert := range certs {
+		b = append(b, encodeCert(cert)...)
+	}
+
+	return writeFileAtomic(path.Join(c.Path, PrevCertFileName), b, 0644)
+}
+
+// PreviousCAs the CAs replaced by a new one that
+// may still be installed in trust stores
+func (c *App) PreviousCAs() ([]*x509.Certificate, error) {
+	b, err := os.ReadFile(path.Join(c.Path, PrevCertFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read previous CAs: %v", err)
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		if block, b = pem.Decode(b); block == nil {
+			break
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse previous CA: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+
+	return certs, nil
+}
+
+// RemovePreviousCAs forgets the previous CAs
+// once they're removed from the trust stores
+func (c *App) RemovePreviousCAs() error {
+	err := os.Remove(path.Join(c.Path, PrevCertFileName))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// RotateCA replaces the CA on disk with a new one keeping the
+// replaced cert in PreviousCAs the proxy keeps using the
+// current CA until UseCA is called
+func (c *App) RotateCA() error {
+	if err := c.keepPreviousCA(c.CertPath); err != nil {
+		return fmt.Errorf("couldn't keep previous CA: %v", err)
+	}
+
+	return writeCA(c.CertPath, c.keys)
+}
+
+// UseCA switches the proxy to the CA on disk
+// the proxy handler must be recreated to use it
+func (c *App) UseCA() error {
+	cert, priv, err := c.loadCA()
+	if err != nil {
+		return err
+	}
+
+	c.Proxy.Certificate, c.Proxy.PrivateKey = cert, priv
+	c.Debug.SetCAExpiry(cert.NotAfter)
+	return nil
+}
+
+// RestoreCA puts back the CA the proxy uses in place of
+// the one created by RotateCA if it couldn't be installed
+func (c *App) RestoreCA() error {
+	if err := storeCA(c.CertPath, c.keys, c.Proxy.Certificate, c.Proxy.PrivateKey); err != nil {
+		return err
+	}
+
+	prevs, err := c.PreviousCAs()
+	if err != nil {
+		return err
+	}
+
+	// the restored CA isn't a previous one anymore
+	var kept []*x509.Certificate
+	for _, cert := range prevs {
+		if !bytes.Equal(cert.Raw, c.Proxy.Certificate.Raw) {
+			kept = append(kept, cert)
+		}
+	}
+
+	return c.writePreviousCAs(kept)
+}
+
+// CANeedsRotation whether the CA expires
+// within CARenewBefore
+func (c *App) CANeedsRotation() bool {
+	expiry := c.Debug.CAExpiry()
+	return !expiry.IsZero() && time.Until(expiry) < CARenewBefore
+}
+
+// caWarning a warning shown if the CA
+// expires within CAWarnBefore
+func caWarning(expiry time.Time) string {
+	if expiry.IsZero() {
+		return ""
+	}
+
+	left := time.Until(expiry)
+	switch {
+	case left <= 0:
+		return fmt.Sprintf("The Fingertip certificate expired on %s, regenerate it to keep browsing Handshake sites", expiry.Format("2006-01-02"))
+	case left < CAWarnBefore:
+		return fmt.Sprintf("The Fingertip certificate expires on %s and couldn't be renewed, regenerate it", expiry.Format("2006-01-02"))
+	}
+
+	return ""
+}
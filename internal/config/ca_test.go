@@ -0,0 +1,164 @@
+package config
+
+import (
+	"bytes"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestCAApp(t *testing.T) *App {
+	t.Helper()
+
+	dir := t.TempDir()
+	c := &App{
+		Path: dir,
+		keys: &fileKeys{path.Join(dir, CertKeyFileName)},
+	}
+
+	if err := c.UseCA(); err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func TestRotateCA(t *testing.T) {
+	c := newTestCAApp(t)
+	first := c.Proxy.Certificate
+
+	if err := c.RotateCA(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the proxy keeps the current CA until
+	// the new one is used
+	if !bytes.Equal(c.Proxy.Certificate.Raw, first.Raw) {
+		t.Fatal("got proxy using the new CA before UseCA")
+	}
+
+	onDisk, err := readCert(c.CertPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(onDisk.Raw, first.Raw) {
+		t.Fatal("got the same CA after rotation, want a new one")
+	}
+
+	if err := c.UseCA(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(c.Proxy.Certificate.Raw, onDisk.Raw) {
+		t.Fatal("got proxy using the previous CA after UseCA")
+	}
+	if !c.Debug.CAExpiry().Equal(onDisk.NotAfter) {
+		t.Fatalf("got ca expiry = %v, want %v", c.Debug.CAExpiry(), onDisk.NotAfter)
+	}
+
+	second := c.Proxy.Certificate
+	if err := c.RotateCA(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.UseCA(); err != nil {
+		t.Fatal(err)
+	}
+
+	// every replaced CA is kept until removed
+	prevs, err := c.PreviousCAs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prevs) != 2 || !bytes.Equal(prevs[0].Raw, first.Raw) || !bytes.Equal(prevs[1].Raw, second.Raw) {
+		t.Fatalf("got %d previous CAs, want the first and second", len(prevs))
+	}
+
+	if err := c.RemovePreviousCAs(); err != nil {
+		t.Fatal(err)
+	}
+	if prevs, err = c.PreviousCAs(); err != nil || len(prevs) != 0 {
+		t.Fatalf("got %d previous CAs, err = %v, want none", len(prevs), err)
+	}
+
+	// removing again is fine
+	if err := c.RemovePreviousCAs(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRestoreCA(t *testing.T) {
+	c := newTestCAApp(t)
+	first := c.Proxy.Certificate
+
+	if err := c.RotateCA(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.UseCA(); err != nil {
+		t.Fatal(err)
+	}
+	second := c.Proxy.Certificate
+
+	if err := c.RotateCA(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RestoreCA(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the CA the proxy uses is back on disk
+	// with its key and not a previous one
+	if err := c.UseCA(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(c.Proxy.Certificate.Raw, second.Raw) {
+		t.Fatal("got a new CA after restore, want the one in use")
+	}
+
+	prevs, err := c.PreviousCAs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prevs) != 1 || !bytes.Equal(prevs[0].Raw, first.Raw) {
+		t.Fatalf("got %d previous CAs, want the first only", len(prevs))
+	}
+}
+
+func TestCANeedsRotation(t *testing.T) {
+	tests := []struct {
+		expiry time.Time
+		want   bool
+	}{
+		{time.Time{}, false},
+		{time.Now().Add(CARenewBefore + time.Hour), false},
+		{time.Now().Add(CARenewBefore - time.Hour), true},
+		{time.Now().Add(-time.Hour), true},
+	}
+
+	c := &App{}
+	for _, test := range tests {
+		c.Debug.SetCAExpiry(test.expiry)
+		if got := c.CANeedsRotation(); got != test.want {
+			t.Fatalf("got needs rotation = %v for expiry %v, want %v", got, test.expiry, test.want)
+		}
+	}
+}
+
+func TestCAWarning(t *testing.T) {
+	tests := []struct {
+		expiry time.Time
+		want   string
+	}{
+		{time.Time{}, ""},
+		{time.Now().Add(CARenewBefore), ""},
+		{time.Now().Add(CAWarnBefore + time.Hour), ""},
+		{time.Now().Add(CAWarnBefore - time.Hour), "couldn't be renewed"},
+		{time.Now().Add(-time.Hour), "expired"},
+	}
+
+	for _, test := range tests {
+		got := caWarning(test.expiry)
+		if test.want == "" && got != "" || !strings.Contains(got, test.want) {
+			t.Fatalf("got warning = %q for expiry %v, want %q", got, test.expiry, test.want)
+		}
+	}
+}
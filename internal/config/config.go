@@ -1,11 +1,12 @@
 package config
 
 import (
-	"bytes"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
+	"fingertip/internal/resolvers"
 	"fmt"
 	"math/rand"
 	"net/http"
@@ -27,17 +28,30 @@ const CertName = "DNSSEC"
 type App struct {
 	Path        string
 	CertPath    string
-	keyPath     string
 	DNSProcPath string
 	Proxy       sane.Config
 	ProxyAddr   string
 	Version     string
 
+	// keys stores the CA private key
+	// otherKeys are read to migrate it
+	keys      keyStore
+	otherKeys []keyStore
+
+	// DNSHandler answers DNS-over-HTTPS requests
+	// set along with Proxy.Resolver
+	DNSHandler *resolvers.DNSHandler
+
+	// QueryLog recent queries served by
+	// the control api nil if disabled
+	QueryLog *resolvers.QueryLog
+
 	Store *Store
 	Debug Debugger
 }
 
-func getOrCreateDir() (string, error) {
+// GetOrCreateDir returns the app config directory
+func GetOrCreateDir() (string, error) {
 	home, err := os.UserConfigDir()
 	if err != nil {
 		return "", err
@@ -53,76 +67,60 @@ func getOrCreateDir() (string, error) {
 	return p, nil
 }
 
-func (c *App) getOrCreateCA() (string, string, error) {
+func (c *App) getOrCreateCA() (string, tls.Certificate, error) {
 	certPath := path.Join(c.Path, CertFileName)
-	keyPath := path.Join(c.Path, CertKeyFileName)
 
-	_, keyErr := os.Stat(keyPath)
-	_, certErr := os.Stat(certPath)
-	if keyErr == nil && certErr == nil {
-		certPEM, err := os.ReadFile(certPath)
+	cert, err := c.loadX509KeyPair(certPath)
+	if err == nil {
+		x509c, err := readCert(certPath)
 		if err != nil {
-			return "", "", fmt.Errorf("couldn't read certificate file: %v\n", err)
+			return "", tls.Certificate{}, err
 		}
 
-		block, _ := pem.Decode(certPEM)
-		if block == nil {
-			return "", "", fmt.Errorf("couldn't parse certificate PEM\n")
-		}
-
-		cert, err := x509.ParseCertificate(block.Bytes)
-		if err != nil {
-			return "", "", fmt.Errorf("couldn't parse certificate: %v\n", err)
-		}
-
-		if cert.NotAfter.After(time.Now()) {
-			return certPath, keyPath, nil
+		if x509c.NotAfter.After(time.Now()) {
+			return certPath, cert, nil
 		}
 	}
-	ca, priv, err := sane.NewAuthority(CertName, CertName, 365*24*time.Hour, tld.NameConstraints)
-	if err != nil {
-		return "", "", fmt.Errorf("couldn't generate CA: %v", err)
-	}
 
-	certOut, err := os.OpenFile(certPath, os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return "", "", fmt.Errorf("couldn't create CA file: %v", err)
+	// don't replace the CA if its key is there
+	// but can't be read e.g. a wrong passphrase
+	if err != nil && !errors.Is(err, os.ErrNotExist) && !errors.Is(err, errKeyMismatch) {
+		return "", tls.Certificate{}, err
 	}
-	defer certOut.Close()
 
-	pem.Encode(certOut, &pem.Block{
-		Type:  "CERTIFICATE",
-		Bytes: ca.Raw,
-	})
-
-	privOut := bytes.NewBuffer([]byte{})
-	pem.Encode(privOut, &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(priv),
-	})
+	// the old CA is removed from trust stores
+	// after the new one is installed
+	if err := c.keepPreviousCA(certPath); err != nil {
+		return "", tls.Certificate{}, fmt.Errorf("couldn't keep previous CA: %v", err)
+	}
 
-	kOut, err := os.OpenFile(keyPath, os.O_CREATE|os.O_WRONLY, 0600)
-	if err != nil {
-		return "", "", fmt.Errorf("couldn't create CA private key file: %v", err)
+	if err := writeCA(certPath, c.keys); err != nil {
+		return "", tls.Certificate{}, err
 	}
-	defer kOut.Close()
 
-	kOut.Write(privOut.Bytes())
-	return certPath, keyPath, nil
+	cert, err = c.loadX509KeyPair(certPath)
+	return certPath, cert, err
 }
 
-func loadX509KeyPair(certFile, keyFile string) (tls.Certificate, error) {
+var errKeyMismatch = errors.New("CA key doesn't match certificate")
+
+func (c *App) loadX509KeyPair(certFile string) (tls.Certificate, error) {
 	certPEMBlock, err := os.ReadFile(certFile)
 	if err != nil {
 		return tls.Certificate{}, err
 	}
 
-	keyPEMBlock, err := os.ReadFile(keyFile)
+	keyPEMBlock, err := loadKey(c.keys, c.otherKeys)
 	if err != nil {
 		return tls.Certificate{}, err
 	}
 
-	return tls.X509KeyPair(certPEMBlock, keyPEMBlock)
+	cert, err := tls.X509KeyPair(certPEMBlock, keyPEMBlock)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("%w: %v", errKeyMismatch, err)
+	}
+
+	return cert, nil
 }
 
 func (c *App) loadCA() (*x509.Certificate, interface{}, error) {
@@ -130,13 +128,9 @@ func (c *App) loadCA() (*x509.Certificate, interface{}, error) {
 	var priv interface{}
 	var err error
 
-	c.CertPath, c.keyPath, err = c.getOrCreateCA()
-	if err != nil {
-		return nil, nil, err
-	}
-
 	var cert tls.Certificate
-	if cert, err = loadX509KeyPair(c.CertPath, c.keyPath); err != nil {
+	c.CertPath, cert, err = c.getOrCreateCA()
+	if err != nil {
 		return nil, nil, err
 	}
 
@@ -188,7 +182,7 @@ function FindProxyForURL(url, host) {
 func NewConfig() (*App, error) {
 	var err error
 	c := &App{}
-	if c.Path, err = getOrCreateDir(); err != nil {
+	if c.Path, err = GetOrCreateDir(); err != nil {
 		return nil, fmt.Errorf("failed creating config: %v", err)
 	}
 
@@ -205,11 +199,24 @@ func NewConfig() (*App, error) {
 	c.Proxy.Verbose = false
 	c.Proxy.ExternalService = DefaultExternalService
 	c.Proxy.RootsPath = path.Join(c.Path, "roots.json")
+
+	usrConfig, err := ReadUserConfig(c.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating config: %v", err)
+	}
+
+	c.keys, c.otherKeys, err = newKeyStore(c.Path, usrConfig.KeyStorage, usrConfig.KeyPassphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating config: %v", err)
+	}
+
 	if c.Proxy.Certificate, c.Proxy.PrivateKey, err = c.loadCA(); err != nil {
 		return nil, fmt.Errorf("failed creating config: %v", err)
 	}
 
+	c.Debug.SetCAExpiry(c.Proxy.Certificate.NotAfter)
 	c.Debug.NewProbe()
+	c.registerMetrics()
 	c.Store, _ = readStore(path.Join(c.Path, "init"), c.Version, nil)
 
 	return c, nil
@@ -230,6 +237,7 @@ func (c *contentHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 			Version:       c.config.Version,
 			NavSetupLink:  url + "/setup",
 			NavStatusLink: url,
+			NavLookupLink: url + "/lookup",
 		})
 		return
 	}
@@ -243,10 +251,16 @@ func (c *contentHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 			Version:       c.config.Version,
 			NavSetupLink:  url + "/setup",
 			NavStatusLink: url,
+			NavLookupLink: url + "/lookup",
 		})
 		return
 	}
 
+	if req.URL.Path == "/lookup" {
+		c.serveLookup(rw, req)
+		return
+	}
+
 	if req.URL.Path == "/"+CertFileName {
 		rw.Header().Set("Content-Type", "application/x-x509-ca-cert")
 		rw.Write(pem.EncodeToMemory(&pem.Block{
@@ -269,6 +283,21 @@ func (c *contentHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if req.URL.Path == "/metrics" {
+		c.serveMetrics(rw, req)
+		return
+	}
+
+	if req.URL.Path == "/dns-query" {
+		if c.config.DNSHandler == nil {
+			http.Error(rw, "resolver not available", http.StatusServiceUnavailable)
+			return
+		}
+
+		c.config.DNSHandler.ServeHTTP(rw, req)
+		return
+	}
+
 	if req.URL.Path == "/proxy.pac" {
 		rw.Header().Set("Content-Type", "application/x-ns-proxy-autoconfig")
 		var names []string
@@ -0,0 +1,273 @@
+package config
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fingertip/internal/resolvers"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxContentCerts certificates kept for content
+// names expired ones are dropped first
+const maxContentCerts = 500
+
+// ContentLookupFunc returns the content served for
+// host by a hip-5 content extension if any
+type ContentLookupFunc func(ctx context.Context, host string) (*resolvers.Content, bool)
+
+// contentProxy serves names answered by content extensions
+// from their gateway and passes other requests to the proxy
+type contentProxy struct {
+	next   http.Handler
+	lookup ContentLookupFunc
+
+	ca       *x509.Certificate
+	caPriv   interface{}
+	priv     *ecdsa.PrivateKey
+	validity time.Duration
+	roots    *x509.CertPool
+
+	certs map[string]*tls.Certificate
+	sync.RWMutex
+}
+
+// NewContentProxy wraps the proxy handler next serving
+// content addressed names found by lookup
+func (c *App) NewContentProxy(next http.Handler, lookup ContentLookupFunc) (http.Handler, error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating content proxy: %v", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(c.Proxy.Certificate)
+
+	return &contentProxy{
+		next:     next,
+		lookup:   lookup,
+		ca:       c.Proxy.Certificate,
+		caPriv:   c.Proxy.PrivateKey,
+		priv:     priv,
+		validity: c.Proxy.Validity,
+		roots:    roots,
+		certs:    make(map[string]*tls.Certificate),
+	}, nil
+}
+
+func (p *contentProxy) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	// relative requests are handled by contentHandler
+	if req.Method != http.MethodConnect && !req.URL.IsAbs() {
+		p.next.ServeHTTP(rw, req)
+		return
+	}
+
+	host := req.URL.Hostname()
+	content, ok := p.lookup(req.Context(), host)
+	if !ok {
+		if req.Method == http.MethodConnect {
+			proxiedTotal.Inc("connect")
+		} else {
+			proxiedTotal.Inc("http")
+		}
+
+		p.next.ServeHTTP(rw, req)
+		return
+	}
+
+	proxiedTotal.Inc("content")
+	if req.Method == http.MethodConnect {
+		p.serveTLS(rw, host, content)
+		return
+	}
+
+	newGatewayProxy(content).ServeHTTP(rw, req)
+}
+
+// serveTLS terminates the tunnel to host with a
+// certificate issued by the proxy CA
+func (p *contentProxy) serveTLS(rw http.ResponseWriter, host string, content *resolvers.Content) {
+	hj, ok := rw.(http.Hijacker)
+	if !ok {
+		http.Error(rw, "hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		log.Printf("[WARN] content: %s hijack failed: %v", host, err)
+		return
+	}
+
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 OK\r\n\r\n"); err != nil {
+		conn.Close()
+		return
+	}
+
+	tlsConn := tls.Server(conn, &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if !strings.EqualFold(hello.ServerName, host) {
+				return nil, fmt.Errorf("server name `%s` does not match `%s`", hello.ServerName, host)
+			}
+
+			return p.cert(host)
+		},
+		NextProtos: []string{"http/1.1"},
+	})
+
+	srv := &http.Server{
+		Handler:     newGatewayProxy(content),
+		ReadTimeout: 30 * time.Second,
+	}
+	srv.Serve(&connListener{conn: tlsConn})
+}
+
+func (p *contentProxy) cert(host string) (*tls.Certificate, error) {
+	p.RLock()
+	tlsc, ok := p.certs[host]
+	p.RUnlock()
+
+	if ok {
+		if _, err := tlsc.Leaf.Verify(x509.VerifyOptions{
+			DNSName: host,
+			Roots:   p.roots,
+		}); err == nil {
+			return tlsc, nil
+		}
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   host,
+			Organization: []string{AppName},
+		},
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		NotBefore:             time.Now().Add(-p.validity),
+		NotAfter:              time.Now().Add(p.validity),
+		DNSNames:              []string{host},
+	}
+
+	raw, err := x509.CreateCertificate(rand.Reader, tmpl, p.ca, &p.priv.PublicKey, p.caPriv)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, err := x509.ParseCertificate(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsc = &tls.Certificate{
+		Certificate: [][]byte{raw, p.ca.Raw},
+		PrivateKey:  p.priv,
+		Leaf:        leaf,
+	}
+
+	p.Lock()
+	p.evictCerts()
+	p.certs[host] = tlsc
+	p.Unlock()
+
+	return tlsc, nil
+}
+
+// evictCerts makes room for a certificate removing
+// expired ones or any if none expired
+func (p *contentProxy) evictCerts() {
+	if len(p.certs) < maxContentCerts {
+		return
+	}
+
+	now := time.Now()
+	for host, tlsc := range p.certs {
+		if now.After(tlsc.Leaf.NotAfter) {
+			delete(p.certs, host)
+		}
+	}
+
+	for host := range p.certs {
+		if len(p.certs) < maxContentCerts {
+			break
+		}
+		delete(p.certs, host)
+	}
+}
+
+// newGatewayProxy forwards requests to the content url
+// hiding the gateway path from the client
+func newGatewayProxy(content *resolvers.Content) *httputil.ReverseProxy {
+	base := content.URL
+
+	return &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			u := base.JoinPath(req.URL.Path)
+			req.URL.Scheme = u.Scheme
+			req.URL.Host = u.Host
+			req.URL.Path = u.Path
+			req.URL.RawPath = ""
+			req.Host = u.Host
+		},
+		ModifyResponse: func(res *http.Response) error {
+			// gateways redirect directories
+			// to paths with a trailing slash
+			if loc := res.Header.Get("Location"); strings.HasPrefix(loc, base.Path+"/") {
+				res.Header.Set("Location", strings.TrimPrefix(loc, base.Path))
+			}
+
+			return nil
+		},
+		ErrorHandler: func(rw http.ResponseWriter, req *http.Request, err error) {
+			log.Printf("[WARN] content: %s gateway error: %v", req.Host, err)
+			http.Error(rw, "content gateway unavailable", http.StatusBadGateway)
+		},
+	}
+}
+
+// connListener a listener accepting
+// a single connection
+type connListener struct {
+	conn net.Conn
+	once sync.Once
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	var c net.Conn
+	l.once.Do(func() {
+		c = l.conn
+	})
+
+	if c == nil {
+		return nil, io.EOF
+	}
+
+	return c, nil
+}
+
+func (l *connListener) Close() error {
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"context"
 	"errors"
 	"fingertip/internal/resolvers"
 	"fmt"
@@ -31,8 +32,12 @@ type Debugger struct {
 	checkCert          func() bool
 	checkSynced        func() bool
 	checkBackend       func() string
+	checkExtensions    func(ctx context.Context) map[string]error
+	extensionErrs      map[string]error
+	cacheStats         func() map[string]resolvers.CacheStats
 
 	blockHeight uint64
+	caExpiry    time.Time
 
 	lastPing time.Time
 	sync.RWMutex
@@ -49,6 +54,17 @@ type DebugInfo struct {
 	DNSReachable       bool   `json:"dnsTestPassed"`
 	DNSProbeInProgress bool   `json:"dnsTestInProgress"`
 	DNSProbeErr        string `json:"dnsTestError"`
+
+	// Extensions enabled hip-5 extensions
+	// and their last health check error if any
+	Extensions map[string]string `json:"extensions"`
+
+	// Cache counters of resolver caches by name
+	Cache map[string]resolvers.CacheStats `json:"cache"`
+
+	CAExpires time.Time `json:"caExpires"`
+	// CAWarning set if the CA expires soon
+	CAWarning string `json:"caWarning,omitempty"`
 }
 
 // Check if udp over port 53 is reachable
@@ -132,6 +148,40 @@ func (d *Debugger) SetBlockHeight(h uint64) {
 	d.blockHeight = h
 }
 
+func (d *Debugger) BlockHeight() uint64 {
+	d.RLock()
+	defer d.RUnlock()
+
+	return d.blockHeight
+}
+
+// Synced whether the backend finished syncing
+func (d *Debugger) Synced() bool {
+	d.RLock()
+	defer d.RUnlock()
+
+	return d.checkSynced != nil && d.checkSynced()
+}
+
+func (d *Debugger) SetCAExpiry(t time.Time) {
+	d.Lock()
+	defer d.Unlock()
+
+	d.caExpiry = t
+}
+
+func (d *Debugger) CAExpiry() time.Time {
+	d.RLock()
+	defer d.RUnlock()
+
+	return d.caExpiry
+}
+
+// CAWarning a warning if the CA expires soon
+func (d *Debugger) CAWarning() string {
+	return caWarning(d.CAExpiry())
+}
+
 func (d *Debugger) Ping() {
 	d.Lock()
 	defer d.Unlock()
@@ -167,11 +217,40 @@ func (d *Debugger) SetCheckBackend(s func() string) {
 	d.checkBackend = s
 }
 
+func (d *Debugger) SetCheckExtensions(c func(ctx context.Context) map[string]error) {
+	d.Lock()
+	defer d.Unlock()
+
+	d.checkExtensions = c
+}
+
+func (d *Debugger) SetCacheStats(s func() map[string]resolvers.CacheStats) {
+	d.Lock()
+	defer d.Unlock()
+
+	d.cacheStats = s
+}
+
+// CacheStats returns resolver cache stats
+// nil if no resolver is set
+func (d *Debugger) CacheStats() map[string]resolvers.CacheStats {
+	d.RLock()
+	stats := d.cacheStats
+	d.RUnlock()
+
+	if stats == nil {
+		return nil
+	}
+
+	return stats()
+}
+
 func (d *Debugger) NewProbe() {
 	d.Lock()
 	d.proxyProbeReached = false
 	d.proxyProbeDomain = randString(50)
 	d.dnsProbeInProgress = true
+	checkExtensions := d.checkExtensions
 	d.Unlock()
 
 	go func() {
@@ -181,6 +260,18 @@ func (d *Debugger) NewProbe() {
 		d.dnsProbeErr = err
 		d.Unlock()
 	}()
+
+	if checkExtensions != nil {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			errs := checkExtensions(ctx)
+			d.Lock()
+			d.extensionErrs = errs
+			d.Unlock()
+		}()
+	}
 }
 
 func (d *Debugger) GetInfo() DebugInfo {
@@ -192,6 +283,19 @@ func (d *Debugger) GetInfo() DebugInfo {
 		err = d.dnsProbeErr.Error()
 	}
 
+	extensions := make(map[string]string)
+	for name, extErr := range d.extensionErrs {
+		extensions[name] = ""
+		if extErr != nil {
+			extensions[name] = extErr.Error()
+		}
+	}
+
+	var cache map[string]resolvers.CacheStats
+	if d.cacheStats != nil {
+		cache = d.cacheStats()
+	}
+
 	return DebugInfo{
 		Backend:            d.checkBackend(),
 		BlockHeight:        d.blockHeight,
@@ -202,6 +306,10 @@ func (d *Debugger) GetInfo() DebugInfo {
 		DNSReachable:       !d.dnsProbeInProgress && d.dnsProbeErr == nil,
 		DNSProbeErr:        err,
 		DNSProbeInProgress: d.dnsProbeInProgress,
+		Extensions:         extensions,
+		Cache:              cache,
+		CAExpires:          d.caExpiry,
+		CAWarning:          caWarning(d.caExpiry),
 	}
 }
 
@@ -0,0 +1,30 @@
+//go:build darwin
+
+package config
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+)
+
+var platformUUID = regexp.MustCompile(`"IOPlatformUUID" = "([^"]+)"`)
+
+func newKeyringKeys() (keyStore, error) {
+	return nil, fmt.Errorf("%w on macOS", errKeyringUnavailable)
+}
+
+// machineID the hardware uuid
+func machineID() (string, error) {
+	out, err := exec.Command("ioreg", "-rd1", "-c", "IOPlatformExpertDevice").Output()
+	if err != nil {
+		return "", err
+	}
+
+	match := platformUUID.FindSubmatch(out)
+	if match == nil {
+		return "", fmt.Errorf("IOPlatformUUID not found")
+	}
+
+	return string(match[1]), nil
+}
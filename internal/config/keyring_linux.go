@@ -0,0 +1,93 @@
+//go:build linux
+
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// secret attributes of the CA key
+var keyringAttrs = []string{"service", AppId, "account", "ca-key"}
+
+// keyringKeys the key in the Secret Service keyring
+// through libsecret's secret-tool
+type keyringKeys struct {
+	tool string
+}
+
+func newKeyringKeys() (keyStore, error) {
+	tool, err := exec.LookPath("secret-tool")
+	if err != nil {
+		return nil, fmt.Errorf("%w secret-tool not found", errKeyringUnavailable)
+	}
+
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		return nil, fmt.Errorf("%w no session bus", errKeyringUnavailable)
+	}
+
+	return &keyringKeys{tool}, nil
+}
+
+func (k *keyringKeys) load() ([]byte, error) {
+	out, err := exec.Command(k.tool, append([]string{"lookup"}, keyringAttrs...)...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		// no output if there's no matching secret
+		if errors.As(err, &exitErr) && len(bytes.TrimSpace(exitErr.Stderr)) == 0 {
+			return nil, os.ErrNotExist
+		}
+		return nil, fmt.Errorf("failed reading keyring: %v", err)
+	}
+
+	keyPEM, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(out)))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse CA key from keyring")
+	}
+
+	return keyPEM, nil
+}
+
+func (k *keyringKeys) store(keyPEM []byte) error {
+	args := append([]string{"store", "--label=" + AppName + " CA private key"}, keyringAttrs...)
+	cmd := exec.Command(k.tool, args...)
+	cmd.Stdin = strings.NewReader(base64.StdEncoding.EncodeToString(keyPEM))
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed writing keyring: %s", strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+func (k *keyringKeys) remove() error {
+	_, err := exec.Command(k.tool, append([]string{"clear"}, keyringAttrs...)...).CombinedOutput()
+	return err
+}
+
+func (k *keyringKeys) String() string {
+	return "keyring"
+}
+
+// machineID the systemd or dbus machine id
+func machineID() (string, error) {
+	var lastErr error
+	for _, name := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if id := strings.TrimSpace(string(b)); id != "" {
+			return id, nil
+		}
+	}
+
+	return "", lastErr
+}
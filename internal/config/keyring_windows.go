@@ -0,0 +1,25 @@
+//go:build windows
+
+package config
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+func newKeyringKeys() (keyStore, error) {
+	return nil, fmt.Errorf("%w on windows", errKeyringUnavailable)
+}
+
+// machineID the windows installation guid
+func machineID() (string, error) {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Cryptography`, registry.QUERY_VALUE|registry.WOW64_64KEY)
+	if err != nil {
+		return "", err
+	}
+	defer k.Close()
+
+	id, _, err := k.GetStringValue("MachineGuid")
+	return id, err
+}
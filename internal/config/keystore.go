@@ -0,0 +1,320 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// key storage options for the CA private key
+const (
+	// KeyStorageFile plaintext in the config directory
+	KeyStorageFile = "file"
+	// KeyStorageEncrypted encrypted in the config directory
+	// with the FINGERTIP_KEY_PASSPHRASE environment variable
+	KeyStorageEncrypted = "encrypted"
+	// KeyStorageMachine encrypted in the config directory
+	// with a key derived from the machine id
+	KeyStorageMachine = "machine"
+	// KeyStorageKeyring the Secret Service keyring on linux
+	KeyStorageKeyring = "keyring"
+)
+
+const (
+	EncryptedKeyFileName = "private.key.enc"
+	MachineKeyFileName   = "private.key.machine"
+)
+
+// keyPassphraseEnv the only place the passphrase is read from
+const keyPassphraseEnv = "FINGERTIP_KEY_PASSPHRASE"
+
+const encryptedKeyType = "FINGERTIP ENCRYPTED PRIVATE KEY"
+
+var (
+	errKeyringUnavailable = errors.New("keyring unavailable")
+	errNoPassphrase       = errors.New(keyPassphraseEnv + " isn't set")
+)
+
+// keyStore stores the CA private key PEM
+// load returns os.ErrNotExist if there's none
+type keyStore interface {
+	load() ([]byte, error)
+	store(keyPEM []byte) error
+	remove() error
+	String() string
+}
+
+// newKeyStore the store configured with storage the others
+// are only read to migrate an existing key it fails rather
+// than keep the key in a weaker store than configured
+func newKeyStore(dir, storage, passphrase string) (keyStore, []keyStore, error) {
+	file := &fileKeys{path.Join(dir, CertKeyFileName)}
+	encrypted := &encryptedKeys{path.Join(dir, EncryptedKeyFileName), passphrase}
+	machine := &machineKeys{path.Join(dir, MachineKeyFileName)}
+	keyring, err := newKeyringKeys()
+
+	others := []keyStore{file, encrypted, machine}
+	if err == nil {
+		others = append(others, keyring)
+	}
+
+	switch storage {
+	case "", KeyStorageFile:
+		return file, others, nil
+	case KeyStorageEncrypted:
+		if passphrase == "" {
+			return nil, nil, fmt.Errorf("encrypted key storage: %w", errNoPassphrase)
+		}
+		return encrypted, others, nil
+	case KeyStorageMachine:
+		if _, err := machineID(); err != nil {
+			return nil, nil, fmt.Errorf("machine key storage: failed reading machine id: %v", err)
+		}
+		return machine, others, nil
+	case KeyStorageKeyring:
+		if err != nil {
+			return nil, nil, fmt.Errorf("keyring key storage: %w", err)
+		}
+		return keyring, others, nil
+	}
+
+	return nil, nil, fmt.Errorf("unknown key storage %s", storage)
+}
+
+// loadKey reads the key from keys or moves it there from
+// another store if found in one a key that can't be read
+// is an error so a new CA doesn't replace it
+func loadKey(keys keyStore, others []keyStore) ([]byte, error) {
+	keyPEM, err := keys.load()
+	if !errors.Is(err, os.ErrNotExist) {
+		return keyPEM, err
+	}
+
+	for _, other := range others {
+		if other.String() == keys.String() {
+			continue
+		}
+
+		keyPEM, err := other.load()
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed reading CA key from %s: %v", other, err)
+		}
+
+		if err := keys.store(keyPEM); err != nil {
+			return nil, fmt.Errorf("failed moving CA key to %s: %v", keys, err)
+		}
+		if err := other.remove(); err != nil {
+			log.Printf("config: failed removing CA key from %s: %v", other, err)
+		}
+
+		log.Printf("config: moved CA key from %s to %s", other, keys)
+		return keyPEM, nil
+	}
+
+	return nil, os.ErrNotExist
+}
+
+// fileKeys the key in a plaintext file
+type fileKeys struct {
+	path string
+}
+
+func (f *fileKeys) load() ([]byte, error) {
+	return os.ReadFile(f.path)
+}
+
+func (f *fileKeys) store(keyPEM []byte) error {
+	return writeFileAtomic(f.path, keyPEM, 0600)
+}
+
+// remove overwrites the key before
+// unlinking it
+func (f *fileKeys) remove() error {
+	info, err := os.Stat(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_ = os.WriteFile(f.path, make([]byte, info.Size()), 0600)
+	return os.Remove(f.path)
+}
+
+func (f *fileKeys) String() string {
+	return f.path
+}
+
+// encryptedKeys the key encrypted with AES-GCM using
+// a key derived with scrypt from the passphrase
+type encryptedKeys struct {
+	path       string
+	passphrase string
+}
+
+func (e *encryptedKeys) aead(salt []byte) (cipher.AEAD, error) {
+	if e.passphrase == "" {
+		return nil, errNoPassphrase
+	}
+
+	key, err := scrypt.Key([]byte(e.passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func (e *encryptedKeys) load() ([]byte, error) {
+	b, err := os.ReadFile(e.path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != encryptedKeyType {
+		return nil, fmt.Errorf("couldn't parse encrypted key")
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(block.Headers["Salt"])
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse encrypted key salt")
+	}
+	nonce, err := base64.StdEncoding.DecodeString(block.Headers["Nonce"])
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse encrypted key nonce")
+	}
+
+	aead, err := e.aead(salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("couldn't parse encrypted key nonce")
+	}
+
+	keyPEM, err := aead.Open(nil, nonce, block.Bytes, []byte(encryptedKeyType))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decrypt CA key wrong passphrase")
+	}
+
+	return keyPEM, nil
+}
+
+func (e *encryptedKeys) store(keyPEM []byte) error {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+
+	aead, err := e.aead(salt)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	b := pem.EncodeToMemory(&pem.Block{
+		Type: encryptedKeyType,
+		Headers: map[string]string{
+			"KDF":   "scrypt",
+			"Salt":  base64.StdEncoding.EncodeToString(salt),
+			"Nonce": base64.StdEncoding.EncodeToString(nonce),
+		},
+		Bytes: aead.Seal(nil, nonce, keyPEM, []byte(encryptedKeyType)),
+	})
+
+	return writeFileAtomic(e.path, b, 0600)
+}
+
+func (e *encryptedKeys) remove() error {
+	if err := os.Remove(e.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func (e *encryptedKeys) String() string {
+	return e.path
+}
+
+// machineKeys the key encrypted like encryptedKeys with
+// a secret derived from the machine id it needs no
+// passphrase but only protects a copy of the config
+// directory taken to another machine
+type machineKeys struct {
+	path string
+}
+
+func (m *machineKeys) keys() (*encryptedKeys, error) {
+	id, err := machineID()
+	if err != nil {
+		return nil, fmt.Errorf("failed reading machine id: %v", err)
+	}
+
+	sum := sha256.Sum256([]byte(AppId + id))
+	return &encryptedKeys{m.path, hex.EncodeToString(sum[:])}, nil
+}
+
+func (m *machineKeys) load() ([]byte, error) {
+	if _, err := os.Stat(m.path); err != nil {
+		return nil, err
+	}
+
+	keys, err := m.keys()
+	if err != nil {
+		return nil, err
+	}
+
+	keyPEM, err := keys.load()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decrypt CA key on this machine: %v", err)
+	}
+
+	return keyPEM, nil
+}
+
+func (m *machineKeys) store(keyPEM []byte) error {
+	keys, err := m.keys()
+	if err != nil {
+		return err
+	}
+
+	return keys.store(keyPEM)
+}
+
+func (m *machineKeys) remove() error {
+	if err := os.Remove(m.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func (m *machineKeys) String() string {
+	return m.path
+}
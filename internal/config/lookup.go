@@ -0,0 +1,199 @@
+package config
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fingertip/internal/resolvers"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/randomlogin/sane/prove"
+	"github.com/randomlogin/sane/sync"
+)
+
+const lookupTimeout = 20 * time.Second
+
+type lookupTmplData struct {
+	NavSetupLink  string
+	NavStatusLink string
+	NavLookupLink string
+	Version       string
+	Name          string
+	Result        *resolvers.LookupResult
+}
+
+// Lookup explains how name resolves and checks its
+// certificate the way the proxy would
+func (c *App) Lookup(ctx context.Context, name string) (*resolvers.LookupResult, error) {
+	hip5, ok := c.Proxy.Resolver.(*resolvers.HIP5Resolver)
+	if !ok {
+		return nil, errors.New("resolver not available")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	res := &resolvers.LookupResult{Explanation: hip5.Explain(ctx, name)}
+	res.DANE = c.checkDANE(ctx, res.Explanation)
+	return res, nil
+}
+
+func parseRRs(rrs []string) []dns.RR {
+	var out []dns.RR
+	for _, s := range rrs {
+		if rr, err := dns.NewRR(s); err == nil && rr != nil {
+			out = append(out, rr)
+		}
+	}
+
+	return out
+}
+
+func (c *App) checkDANE(ctx context.Context, x *resolvers.Explanation) resolvers.DANECheck {
+	if len(x.TLSA) == 0 {
+		return resolvers.DANECheck{Detail: "no TLSA records found for _443._tcp." + x.Name}
+	}
+
+	if !x.TLSASecure {
+		return resolvers.DANECheck{Detail: "TLSA records aren't DNSSEC secure and are ignored by the proxy"}
+	}
+
+	var tlsa []*dns.TLSA
+	for _, rr := range parseRRs(x.TLSA) {
+		if t, ok := rr.(*dns.TLSA); ok && t.Usage == 3 {
+			tlsa = append(tlsa, t)
+		}
+	}
+
+	if len(tlsa) == 0 {
+		return resolvers.DANECheck{Detail: "no DANE-EE (usage 3) TLSA records the proxy supports"}
+	}
+
+	var ip net.IP
+	for _, rr := range parseRRs(x.Records) {
+		switch a := rr.(type) {
+		case *dns.A:
+			ip = a.A
+		case *dns.AAAA:
+			ip = a.AAAA
+		}
+
+		if ip != nil {
+			break
+		}
+	}
+
+	if ip == nil {
+		return resolvers.DANECheck{Detail: "no addresses to fetch the certificate from"}
+	}
+
+	cert, err := fetchCertificate(ctx, ip, strings.TrimSuffix(x.Name, "."))
+	if err != nil {
+		return resolvers.DANECheck{Detail: fmt.Sprintf("couldn't fetch certificate from %s: %v", ip, err)}
+	}
+
+	check := resolvers.DANECheck{Checked: true, Detail: "certificate doesn't match any TLSA record"}
+	for _, t := range tlsa {
+		if err := t.Verify(cert); err != nil {
+			continue
+		}
+
+		// sane also requires a proof of the TLSA
+		// record embedded in the certificate
+		if c.Store != nil && c.Store.Backend == "sane" {
+			roots, err := sync.ReadStoredRoots(c.Proxy.RootsPath)
+			if err != nil {
+				check.Detail = fmt.Sprintf("certificate matches TLSA but stored roots are unavailable: %v", err)
+				return check
+			}
+
+			if err := prove.VerifyCertificateExtensions(roots, *cert, t, c.Proxy.ExternalService); err != nil {
+				check.Detail = fmt.Sprintf("certificate matches TLSA but its SANE proof failed: %v", err)
+				return check
+			}
+		}
+
+		check.Passed = true
+		check.Detail = "certificate matches TLSA record " + t.String()
+		return check
+	}
+
+	return check
+}
+
+func fetchCertificate(ctx context.Context, ip net.IP, serverName string) (*x509.Certificate, error) {
+	d := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: 5 * time.Second},
+		Config: &tls.Config{
+			// verified against TLSA records instead
+			InsecureSkipVerify: true, // lgtm[go/disabled-certificate-check]
+			ServerName:         serverName,
+		},
+	}
+
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(ip.String(), "443"))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, errors.New("no certificate")
+	}
+
+	return certs[0], nil
+}
+
+func (h *contentHandler) serveLookup(rw http.ResponseWriter, req *http.Request) {
+	name := strings.TrimSpace(req.URL.Query().Get("name"))
+	url := GetProxyURL(h.config.ProxyAddr)
+
+	var res *resolvers.LookupResult
+	var err error
+	if name != "" {
+		res, err = h.config.Lookup(req.Context(), name)
+	}
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	lookupTmpl.Execute(rw, lookupTmplData{
+		NavSetupLink:  url + "/setup",
+		NavStatusLink: url,
+		NavLookupLink: url + "/lookup",
+		Version:       h.config.Version,
+		Name:          name,
+		Result:        res,
+	})
+}
+
+// Resolve resolves name the way the proxy does
+// recording every step taken
+func (c *App) Resolve(ctx context.Context, name, qtype string) (*resolvers.Answer, error) {
+	t := dns.TypeA
+	if qtype != "" {
+		var ok bool
+		if t, ok = dns.StringToType[strings.ToUpper(qtype)]; !ok {
+			return nil, fmt.Errorf("unknown type %s", qtype)
+		}
+	}
+
+	hip5, ok := c.Proxy.Resolver.(*resolvers.HIP5Resolver)
+	if !ok {
+		return nil, errors.New("resolver not available")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	return hip5.Trace(ctx, name, t), nil
+}
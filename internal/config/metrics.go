@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fingertip/internal/metrics"
+	"fingertip/internal/resolvers"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/randomlogin/sane/sync"
+)
+
+var proxiedTotal = metrics.Default.NewCounterVec("fingertip_proxied_connections_total",
+	"Connections handled by the proxy by type (connect, http, content)", "type")
+
+// cacheMetric a per cache counter read
+// from resolver cache stats
+type cacheMetric struct {
+	name  string
+	help  string
+	typ   string
+	value func(s resolvers.CacheStats) float64
+}
+
+var cacheMetrics = []cacheMetric{
+	{"fingertip_cache_entries", "Entries in resolver caches", "gauge",
+		func(s resolvers.CacheStats) float64 { return float64(s.Size) }},
+	{"fingertip_cache_hits_total", "Resolver cache hits", "counter",
+		func(s resolvers.CacheStats) float64 { return float64(s.Hits) }},
+	{"fingertip_cache_misses_total", "Resolver cache misses", "counter",
+		func(s resolvers.CacheStats) float64 { return float64(s.Misses) }},
+	{"fingertip_cache_evictions_total", "Resolver cache evictions", "counter",
+		func(s resolvers.CacheStats) float64 { return float64(s.Evictions) }},
+	{"fingertip_cache_stale_total", "Stale answers served from resolver caches", "counter",
+		func(s resolvers.CacheStats) float64 { return float64(s.Stale) }},
+	{"fingertip_cache_prefetches_total", "Resolver cache prefetches", "counter",
+		func(s resolvers.CacheStats) float64 { return float64(s.Prefetches) }},
+}
+
+// registerMetrics registers metrics read
+// from the app state on every scrape
+func (c *App) registerMetrics() {
+	for _, m := range cacheMetrics {
+		value := m.value
+		metrics.Default.Collect(m.name, m.help, m.typ, []string{"cache"}, func() []metrics.Sample {
+			stats := c.Debug.CacheStats()
+			names := make([]string, 0, len(stats))
+			for name := range stats {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			samples := make([]metrics.Sample, len(names))
+			for i, name := range names {
+				samples[i] = metrics.Sample{Labels: []string{name}, Value: value(stats[name])}
+			}
+			return samples
+		})
+	}
+
+	metrics.Default.NewGaugeFunc("fingertip_block_height", "Block height of the hnsd root server", func() float64 {
+		return float64(c.Debug.BlockHeight())
+	})
+
+	metrics.Default.NewGaugeFunc("fingertip_ca_expiry_timestamp_seconds", "Expiry of the local CA as a unix timestamp", func() float64 {
+		return float64(c.Debug.CAExpiry().Unix())
+	})
+
+	metrics.Default.Collect("fingertip_root_sync_age_seconds", "Age of the newest synced tree root", "gauge", nil, func() []metrics.Sample {
+		roots, err := sync.ReadStoredRoots(c.Proxy.RootsPath)
+		if err != nil || len(roots) == 0 {
+			return nil
+		}
+
+		var newest uint64
+		for _, root := range roots {
+			if root.Timestamp > newest {
+				newest = root.Timestamp
+			}
+		}
+
+		return []metrics.Sample{{Value: time.Since(time.Unix(int64(newest), 0)).Seconds()}}
+	})
+}
+
+func (c *contentHandler) serveMetrics(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.Default.Write(rw)
+}
@@ -8,6 +8,7 @@ import (
 type onBoardingTmplData struct {
 	NavSetupLink  string
 	NavStatusLink string
+	NavLookupLink string
 	CertPath      string
 	CertLink      string
 	PACLink       string
@@ -21,8 +22,12 @@ var statusPage string
 //go:embed pages/setup.html
 var setupPage string
 
+//go:embed pages/lookup.html
+var lookupPage string
+
 var setupTmpl *template.Template
 var statusTmpl *template.Template
+var lookupTmpl *template.Template
 
 func init() {
 	var err error
@@ -32,4 +37,7 @@ func init() {
 	if statusTmpl, err = template.New("status").Parse(statusPage); err != nil {
 		panic(err)
 	}
+	if lookupTmpl, err = template.New("lookup").Parse(lookupPage); err != nil {
+		panic(err)
+	}
 }
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path"
 
 	"github.com/spf13/viper"
 )
@@ -15,16 +16,63 @@ const (
 	DefaultRecursiveAddr    = "127.0.0.1:9592"
 	DefaultDOHUrl           = "https://hnsdoh.com/dns-query"
 	DefaultEthereumEndpoint = "https://mainnet.infura.io/v3/b0933ce6026a4e1e80e89e96a5d095bc"
+	DefaultIPFSGateway      = "http://127.0.0.1:8080"
+	DefaultSwarmGateway     = "https://api.gateway.ethswarm.org"
+	DefaultArweaveGateway   = "https://arweave.net"
 )
 
+var DefaultExtensions = []string{"_eth"}
+
 var DefaultExternalService = []string{"https://sdaneproofs.htools.work/proofs/", "https://sdane.woodburn.au/proofs/", "https://sdaneproofs.shakestation.io/proofs/"}
 
 // User Represents user facing configuration
 type User struct {
-	ProxyAddr        string `mapstructure:"PROXY_ADDRESS"`
-	RootAddr         string `mapstructure:"ROOT_ADDRESS"`
-	RecursiveAddr    string `mapstructure:"RECURSIVE_ADDRESS"`
-	EthereumEndpoint string `mapstructure:"ETHEREUM_ENDPOINT"`
+	ProxyAddr     string `mapstructure:"PROXY_ADDRESS"`
+	RootAddr      string `mapstructure:"ROOT_ADDRESS"`
+	RecursiveAddr string `mapstructure:"RECURSIVE_ADDRESS"`
+	// EthereumEndpoints comma separated endpoints
+	// used in order with failover
+	EthereumEndpoints []string `mapstructure:"ETHEREUM_ENDPOINT"`
+	// EthereumQuorum number of endpoints that
+	// must agree on contract calls
+	EthereumQuorum int `mapstructure:"ETHEREUM_QUORUM"`
+	// EthereumChains ids of other evm chains with
+	// registries each configured with its own
+	// ETHEREUM_ENDPOINT_<id> and ETHEREUM_QUORUM_<id>
+	EthereumChains []string `mapstructure:"ETHEREUM_CHAINS"`
+	// DNSAddr optional address for a local DNS server
+	// disabled if empty
+	DNSAddr string `mapstructure:"DNS_ADDRESS"`
+	// ControlAddr optional tcp address for the control
+	// api also served on a unix socket in the config dir
+	ControlAddr string `mapstructure:"CONTROL_ADDRESS"`
+	// NativeRecursion resolve names with the built-in
+	// validating resolver instead of RecursiveAddr
+	NativeRecursion bool `mapstructure:"NATIVE_RECURSION"`
+	// Extensions enabled HIP-5 extensions
+	Extensions []string `mapstructure:"EXTENSIONS"`
+	// PersistentCache keep resolver lookups in the
+	// config directory across restarts
+	PersistentCache bool `mapstructure:"PERSISTENT_CACHE"`
+	// QueryLog record queries and how they were resolved
+	// shown by the queries command and kept in the config directory
+	QueryLog bool `mapstructure:"QUERY_LOG"`
+	// SystemTrustStore also install the CA in the distro
+	// trust store on linux (needs elevation)
+	SystemTrustStore bool `mapstructure:"SYSTEM_TRUST_STORE"`
+	// BrowserPolicies also install a managed proxy policy
+	// for chromium based browsers on linux (needs elevation)
+	BrowserPolicies bool `mapstructure:"BROWSER_POLICIES"`
+	// MetricsNames how queried names are labeled at /metrics
+	// omitted if empty otherwise hashed or plain
+	MetricsNames string `mapstructure:"METRICS_NAMES"`
+	// KeyStorage where the CA private key is kept
+	// file, encrypted, machine or keyring
+	KeyStorage string `mapstructure:"KEY_STORAGE"`
+	// KeyPassphrase encrypts the CA private key required
+	// by encrypted storage only read from the environment
+	// as the config file is next to the key
+	KeyPassphrase string `mapstructure:"-"`
 }
 
 // TODO create a type for the backend, not use string
@@ -70,6 +118,12 @@ func readStore(path, version string, old *Store) (*Store, error) {
 	return zero, nil
 }
 
+// ReadStore reads the stored config in
+// the app config directory dir
+func ReadStore(dir string) (*Store, error) {
+	return readStore(path.Join(dir, "init"), "", nil)
+}
+
 func (i *Store) Reload() error {
 	_, err := readStore(i.path, i.Version, i)
 	return err
@@ -87,6 +141,12 @@ func (i *Store) Save() error {
 	return err
 }
 
+// Setting returns the raw value of a user setting
+// used by extensions for their own options
+func Setting(key string) string {
+	return viper.GetString(key)
+}
+
 var ErrUserConfigNotFound = errors.New("user config not found")
 
 // ReadUserConfig reads user facing configuration
@@ -103,6 +163,21 @@ func ReadUserConfig(path string) (config User, err error) {
 	viper.SetDefault("RECURSIVE_ADDRESS", DefaultRecursiveAddr)
 	viper.SetDefault("EXTERNAL_SERVICE", DefaultExternalService)
 	viper.SetDefault("ETHEREUM_ENDPOINT", DefaultEthereumEndpoint)
+	viper.SetDefault("ETHEREUM_QUORUM", 1)
+	viper.SetDefault("ETHEREUM_CHAINS", "")
+	viper.SetDefault("DNS_ADDRESS", "")
+	viper.SetDefault("CONTROL_ADDRESS", "")
+	viper.SetDefault("NATIVE_RECURSION", false)
+	viper.SetDefault("EXTENSIONS", DefaultExtensions)
+	viper.SetDefault("PERSISTENT_CACHE", false)
+	viper.SetDefault("QUERY_LOG", false)
+	viper.SetDefault("METRICS_NAMES", "")
+	viper.SetDefault("KEY_STORAGE", KeyStorageFile)
+	viper.SetDefault("IPFS_GATEWAY", DefaultIPFSGateway)
+	viper.SetDefault("SWARM_GATEWAY", DefaultSwarmGateway)
+	viper.SetDefault("ARWEAVE_GATEWAY", DefaultArweaveGateway)
+	viper.SetDefault("ETHEREUM_HEADER_ENDPOINT", "")
+	viper.SetDefault("ETHEREUM_CHECKPOINT", "")
 
 	err = viper.ReadInConfig()
 	if err != nil {
@@ -112,10 +187,17 @@ func ReadUserConfig(path string) (config User, err error) {
 		}
 	}
 
+	if viper.InConfig("KEY_PASSPHRASE") {
+		err = fmt.Errorf("error reading user config: KEY_PASSPHRASE in %s would be stored next to the key set %s in the environment instead",
+			viper.ConfigFileUsed(), keyPassphraseEnv)
+		return
+	}
+
 	err = viper.Unmarshal(&config)
 	if err != nil {
 		err = fmt.Errorf("error reading user config: %v", err)
 	}
+	config.KeyPassphrase = os.Getenv(keyPassphraseEnv)
 
 	return
 }
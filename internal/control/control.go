@@ -0,0 +1,391 @@
+// Package control a local API to control a running fingertip
+// served on a unix socket in the app config directory and
+// authenticated with a token only readable by the user
+package control
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fingertip/internal/resolvers"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SocketFileName = "control.sock"
+	TokenFileName  = "control.token"
+)
+
+// Status state of a running fingertip
+type Status struct {
+	Version     string `json:"version"`
+	Started     bool   `json:"started"`
+	Backend     string `json:"backend"`
+	AutoConfig  bool   `json:"autoConfig"`
+	ProxyURL    string `json:"proxyUrl"`
+	BlockHeight uint64 `json:"blockHeight"`
+	Synced      bool   `json:"synced"`
+	// CAExpires expiry of the local CA and a
+	// warning if it expires soon
+	CAExpires time.Time `json:"caExpires"`
+	CAWarning string    `json:"caWarning,omitempty"`
+}
+
+// Controller operations exposed by the api
+type Controller interface {
+	Start() error
+	Stop() error
+	// SetBackend switches to backend restarting
+	// the proxy if started
+	SetBackend(backend string) error
+	// ConfigureOS installs or removes the proxy
+	// and certificate settings of the OS and browsers
+	ConfigureOS(enable bool) error
+	// SyncRoots syncs tree roots in the background
+	SyncRoots() error
+	// RegenerateCA replaces the local CA with a new one
+	// installed wherever the previous one was
+	RegenerateCA() error
+	// Queries recent queries of the query log
+	// matching name if not empty
+	Queries(name string, limit int) ([]resolvers.QueryRecord, error)
+	// Resolve resolves name the way the proxy does
+	Resolve(ctx context.Context, name, qtype string) (*resolvers.Answer, error)
+	// Lookup explains how name resolves and checks
+	// its certificate the way the proxy would
+	Lookup(ctx context.Context, name string) (*resolvers.LookupResult, error)
+	Status() Status
+}
+
+// LoadOrCreateToken reads the api token from path
+// creating a random one if it doesn't exist
+func LoadOrCreateToken(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err == nil && len(strings.TrimSpace(string(b))) > 0 {
+		return strings.TrimSpace(string(b)), nil
+	}
+
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed reading control token: %v", err)
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed creating control token: %v", err)
+	}
+
+	token := hex.EncodeToString(raw)
+	if err := os.WriteFile(path, []byte(token), 0600); err != nil {
+		return "", fmt.Errorf("failed writing control token: %v", err)
+	}
+
+	return token, nil
+}
+
+type Server struct {
+	c      Controller
+	token  string
+	server *http.Server
+}
+
+func NewServer(c Controller, token string) *Server {
+	s := &Server{c: c, token: token}
+	s.server = &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	return s
+}
+
+// ListenUnix serves the api on a unix socket
+// replacing a stale socket left by a crash
+func (s *Server) ListenUnix(socketPath string) error {
+	if conn, err := net.DialTimeout("unix", socketPath, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("control: %s is in use by another instance", socketPath)
+	}
+	os.Remove(socketPath)
+
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("control: %v", err)
+	}
+
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		ln.Close()
+		return fmt.Errorf("control: %v", err)
+	}
+
+	go s.server.Serve(ln)
+	return nil
+}
+
+// ListenTCP serves the api on addr
+// which should be a loopback address
+func (s *Server) ListenTCP(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("control: %v", err)
+	}
+
+	go s.server.Serve(ln)
+	return nil
+}
+
+func (s *Server) Close() error {
+	return s.server.Close()
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(rw http.ResponseWriter, status int, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	data, _ := json.Marshal(v)
+	rw.Write(data)
+}
+
+func writeError(rw http.ResponseWriter, status int, err error) {
+	writeJSON(rw, status, errorResponse{Error: err.Error()})
+}
+
+func writeResult(rw http.ResponseWriter, v interface{}, err error) {
+	if err != nil {
+		writeError(rw, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, v)
+}
+
+func (s *Server) authorized(req *http.Request) bool {
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+func (s *Server) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if !s.authorized(req) {
+		writeError(rw, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	query := req.URL.Query()
+	switch req.URL.Path {
+	case "/status":
+		writeJSON(rw, http.StatusOK, s.c.Status())
+		return
+	case "/queries":
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		if limit <= 0 {
+			limit = 100
+		}
+
+		records, err := s.c.Queries(query.Get("name"), limit)
+		writeResult(rw, records, err)
+		return
+	case "/resolve", "/lookup":
+		name := strings.TrimSpace(query.Get("name"))
+		if name == "" {
+			writeError(rw, http.StatusBadRequest, errors.New("missing name"))
+			return
+		}
+
+		if req.URL.Path == "/resolve" {
+			answer, err := s.c.Resolve(req.Context(), name, query.Get("type"))
+			writeResult(rw, answer, err)
+			return
+		}
+
+		res, err := s.c.Lookup(req.Context(), name)
+		writeResult(rw, res, err)
+		return
+	}
+
+	if req.Method != http.MethodPost {
+		writeError(rw, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	var err error
+	switch req.URL.Path {
+	case "/start":
+		err = s.c.Start()
+	case "/stop":
+		err = s.c.Stop()
+	case "/sync":
+		err = s.c.SyncRoots()
+	case "/regenerate-ca":
+		err = s.c.RegenerateCA()
+	case "/backend":
+		var body struct {
+			Backend string `json:"backend"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			writeError(rw, http.StatusBadRequest, err)
+			return
+		}
+		err = s.c.SetBackend(body.Backend)
+	case "/configure":
+		var body struct {
+			Enable bool `json:"enable"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			writeError(rw, http.StatusBadRequest, err)
+			return
+		}
+		err = s.c.ConfigureOS(body.Enable)
+	default:
+		writeError(rw, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, s.c.Status())
+}
+
+type Client struct {
+	base   string
+	token  string
+	client *http.Client
+}
+
+// NewClient creates a client of the api served
+// on the unix socket in the app config dir
+func NewClient(dir string) (*Client, error) {
+	token, err := os.ReadFile(path.Join(dir, TokenFileName))
+	if err != nil {
+		return nil, fmt.Errorf("control: failed reading token: %v", err)
+	}
+
+	socketPath := path.Join(dir, SocketFileName)
+	return &Client{
+		base:  "http://fingertip",
+		token: strings.TrimSpace(string(token)),
+		client: &http.Client{
+			Timeout: time.Minute,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}, nil
+}
+
+// NewTCPClient creates a client of the api served on addr
+func NewTCPClient(addr, token string) *Client {
+	return &Client{
+		base:   "http://" + addr,
+		token:  token,
+		client: &http.Client{Timeout: time.Minute},
+	}
+}
+
+func (c *Client) do(method, path string, body interface{}) (Status, error) {
+	var status Status
+	err := c.call(method, path, body, &status)
+	return status, err
+}
+
+// call sends a request to the api
+// decoding the response into v
+func (c *Client) call(method, path string, body, v interface{}) error {
+	var data []byte
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+
+	req, err := http.NewRequest(method, c.base+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("control: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var e errorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Error == "" {
+			return fmt.Errorf("control: %s", resp.Status)
+		}
+		return errors.New(e.Error)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (c *Client) Status() (Status, error) {
+	return c.do(http.MethodGet, "/status", nil)
+}
+
+func (c *Client) Start() (Status, error) {
+	return c.do(http.MethodPost, "/start", nil)
+}
+
+func (c *Client) Stop() (Status, error) {
+	return c.do(http.MethodPost, "/stop", nil)
+}
+
+func (c *Client) SyncRoots() (Status, error) {
+	return c.do(http.MethodPost, "/sync", nil)
+}
+
+func (c *Client) RegenerateCA() (Status, error) {
+	return c.do(http.MethodPost, "/regenerate-ca", nil)
+}
+
+func (c *Client) SetBackend(backend string) (Status, error) {
+	return c.do(http.MethodPost, "/backend", map[string]string{"backend": backend})
+}
+
+func (c *Client) ConfigureOS(enable bool) (Status, error) {
+	return c.do(http.MethodPost, "/configure", map[string]bool{"enable": enable})
+}
+
+func (c *Client) Queries(name string, limit int) ([]resolvers.QueryRecord, error) {
+	var records []resolvers.QueryRecord
+	query := url.Values{"name": {name}, "limit": {strconv.Itoa(limit)}}
+	err := c.call(http.MethodGet, "/queries?"+query.Encode(), nil, &records)
+	return records, err
+}
+
+func (c *Client) Resolve(name, qtype string) (*resolvers.Answer, error) {
+	var answer resolvers.Answer
+	query := url.Values{"name": {name}, "type": {qtype}}
+	if err := c.call(http.MethodGet, "/resolve?"+query.Encode(), nil, &answer); err != nil {
+		return nil, err
+	}
+
+	return &answer, nil
+}
+
+func (c *Client) Lookup(name string) (*resolvers.LookupResult, error) {
+	var res resolvers.LookupResult
+	query := url.Values{"name": {name}}
+	if err := c.call(http.MethodGet, "/lookup?"+query.Encode(), nil, &res); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
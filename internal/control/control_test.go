@@ -0,0 +1,157 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"fingertip/internal/resolvers"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+type testController struct {
+	status Status
+}
+
+func (c *testController) Start() error {
+	c.status.Started = true
+	return nil
+}
+
+func (c *testController) Stop() error {
+	c.status.Started = false
+	return nil
+}
+
+func (c *testController) SetBackend(backend string) error {
+	if backend != "sane" && backend != "letsdane" {
+		return errors.New("unknown backend " + backend)
+	}
+
+	c.status.Backend = backend
+	return nil
+}
+
+func (c *testController) ConfigureOS(enable bool) error {
+	c.status.AutoConfig = enable
+	return nil
+}
+
+func (c *testController) SyncRoots() error {
+	return nil
+}
+
+func (c *testController) RegenerateCA() error {
+	c.status.CAExpires = c.status.CAExpires.Add(365 * 24 * time.Hour)
+	return nil
+}
+
+func (c *testController) Queries(name string, limit int) ([]resolvers.QueryRecord, error) {
+	if name == "" {
+		return nil, errors.New("query log disabled")
+	}
+
+	return []resolvers.QueryRecord{{Name: name, Records: limit}}, nil
+}
+
+func (c *testController) Resolve(ctx context.Context, name, qtype string) (*resolvers.Answer, error) {
+	return &resolvers.Answer{Name: name, Type: qtype}, nil
+}
+
+func (c *testController) Lookup(ctx context.Context, name string) (*resolvers.LookupResult, error) {
+	return &resolvers.LookupResult{
+		Explanation: &resolvers.Explanation{Name: name},
+		DANE:        resolvers.DANECheck{Passed: true},
+	}, nil
+}
+
+func (c *testController) Status() Status {
+	return c.status
+}
+
+func TestControl(t *testing.T) {
+	// unix socket paths are limited in length
+	dir, err := os.MkdirTemp("", "ft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	token, err := LoadOrCreateToken(path.Join(dir, TokenFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if again, _ := LoadOrCreateToken(path.Join(dir, TokenFileName)); again != token {
+		t.Fatalf("got token = %s, want %s", again, token)
+	}
+
+	s := NewServer(&testController{status: Status{Backend: "sane"}}, token)
+	if err := s.ListenUnix(path.Join(dir, SocketFileName)); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	c, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := c.Start()
+	if err != nil || !st.Started {
+		t.Fatalf("got started = %v, err = %v, want started", st.Started, err)
+	}
+
+	if st, err = c.SetBackend("letsdane"); err != nil || st.Backend != "letsdane" {
+		t.Fatalf("got backend = %s, err = %v, want letsdane", st.Backend, err)
+	}
+
+	if _, err = c.SetBackend("other"); err == nil || err.Error() != "unknown backend other" {
+		t.Fatalf("got err = %v, want unknown backend other", err)
+	}
+
+	if st, err = c.ConfigureOS(true); err != nil || !st.AutoConfig {
+		t.Fatalf("got auto config = %v, err = %v, want true", st.AutoConfig, err)
+	}
+
+	if st, err = c.RegenerateCA(); err != nil || st.CAExpires.IsZero() {
+		t.Fatalf("got ca expires = %v, err = %v, want renewed", st.CAExpires, err)
+	}
+
+	if st, err = c.Stop(); err != nil || st.Started {
+		t.Fatalf("got started = %v, err = %v, want stopped", st.Started, err)
+	}
+
+	records, err := c.Queries("example.forever.", 5)
+	if err != nil || len(records) != 1 || records[0].Name != "example.forever." || records[0].Records != 5 {
+		t.Fatalf("got records = %v, err = %v, want example.forever. limited to 5", records, err)
+	}
+
+	if _, err = c.Queries("", 5); err == nil || err.Error() != "query log disabled" {
+		t.Fatalf("got err = %v, want query log disabled", err)
+	}
+
+	answer, err := c.Resolve("example.forever.", "TXT")
+	if err != nil || answer.Name != "example.forever." || answer.Type != "TXT" {
+		t.Fatalf("got answer = %v, err = %v, want example.forever. TXT", answer, err)
+	}
+
+	if _, err = c.Resolve("", "A"); err == nil || err.Error() != "missing name" {
+		t.Fatalf("got err = %v, want missing name", err)
+	}
+
+	res, err := c.Lookup("example.forever.")
+	if err != nil || res.Explanation == nil || res.Name != "example.forever." || !res.DANE.Passed {
+		t.Fatalf("got lookup = %v, err = %v, want example.forever. passed", res, err)
+	}
+
+	c.token = "wrong"
+	if _, err = c.Status(); err == nil || err.Error() != "invalid token" {
+		t.Fatalf("got err = %v, want invalid token", err)
+	}
+
+	if _, err = c.Queries("example.forever.", 5); err == nil || err.Error() != "invalid token" {
+		t.Fatalf("got err = %v, want invalid token", err)
+	}
+}
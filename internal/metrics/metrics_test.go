@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	r := NewRegistry()
+
+	c := r.NewCounterVec("test_queries_total", "Queries", "path")
+	c.Inc("stub")
+	c.Add(2, `h"ip5`)
+
+	h := r.NewHistogramVec("test_latency_seconds", "Latency", []float64{.1, 1}, "path")
+	h.Observe(.05, "stub")
+	h.Observe(.5, "stub")
+	h.Observe(5, "stub")
+
+	r.NewGaugeFunc("test_height", "Height", func() float64 { return 42 })
+
+	var buf bytes.Buffer
+	r.Write(&buf)
+	out := buf.String()
+
+	for _, want := range []string{
+		"# TYPE test_queries_total counter\n",
+		`test_queries_total{path="h\"ip5"} 2` + "\n",
+		`test_queries_total{path="stub"} 1` + "\n",
+		"# TYPE test_latency_seconds histogram\n",
+		`test_latency_seconds_bucket{path="stub",le="0.1"} 1` + "\n",
+		`test_latency_seconds_bucket{path="stub",le="1"} 2` + "\n",
+		`test_latency_seconds_bucket{path="stub",le="+Inf"} 3` + "\n",
+		`test_latency_seconds_sum{path="stub"} 5.55` + "\n",
+		`test_latency_seconds_count{path="stub"} 3` + "\n",
+		"# TYPE test_height gauge\ntest_height 42\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("got output\n%s\nwant it to contain %q", out, want)
+		}
+	}
+
+	// metrics are sorted by name
+	if strings.Index(out, "test_height") > strings.Index(out, "test_latency_seconds") {
+		t.Fatalf("got unsorted output\n%s", out)
+	}
+}
@@ -1,58 +1,199 @@
 package resolvers
 
 import (
+	"container/list"
+	"github.com/miekg/dns"
 	"sync"
 	"time"
 )
 
+// max time expired entries are served while the
+// upstream is failing RFC 8767 suggests 1 to 3 days
+const maxStale = 24 * time.Hour
+
+// ttl of stale records in answers
+// https://datatracker.ietf.org/doc/html/rfc8767#section-4
+const staleTTL = 30
+
+// entries hit at least this often are
+// refreshed before they expire
+const prefetchHits = 3
+
+// entries are prefetched once less than
+// this fraction of their ttl remains
+const prefetchRatio = 0.1
+
+// max time a background refresh may take
+const prefetchTimeout = 10 * time.Second
+
 type entry struct {
 	msg interface{}
 	ttl time.Time
 }
 
+// CacheStats counters of a resolver cache
+type CacheStats struct {
+	Size       int    `json:"size"`
+	Hits       uint64 `json:"hits"`
+	Misses     uint64 `json:"misses"`
+	Evictions  uint64 `json:"evictions"`
+	Stale      uint64 `json:"stale"`
+	Prefetches uint64 `json:"prefetches"`
+}
+
+type cacheItem struct {
+	key   string
+	e     *entry
+	added time.Time
+	hits  int
+	// prefetch already started
+	prefetching bool
+}
+
+// cache a LRU cache of entries expiring with their ttl
+// expired entries are kept to be served stale
 type cache struct {
-	m    map[string]*entry
+	m    map[string]*list.Element
+	ll   *list.List
 	maxN int
 
-	sync.RWMutex
+	counters CacheStats
+	sync.Mutex
 }
 
 func newCache(maxN int) (m *cache) {
-	return &cache{m: make(map[string]*entry), maxN: maxN}
+	return &cache{m: make(map[string]*list.Element), ll: list.New(), maxN: maxN}
 }
 
 func (c *cache) set(key string, item *entry) {
 	c.Lock()
 	defer c.Unlock()
 
-	if c.maxN == len(c.m) {
-		for k := range c.m {
-			delete(c.m, k)
-			break
-		}
+	it := &cacheItem{key: key, e: item, added: time.Now()}
+	if el, ok := c.m[key]; ok {
+		el.Value = it
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	for c.maxN > 0 && c.ll.Len() >= c.maxN {
+		c.removeElement(c.ll.Back())
+		c.counters.Evictions++
 	}
 
-	c.m[key] = item
+	c.m[key] = c.ll.PushFront(it)
 }
 
+// get returns an entry if it hasn't expired
 func (c *cache) get(key string) (*entry, bool) {
-	c.RLock()
-	defer c.RUnlock()
+	c.Lock()
+	defer c.Unlock()
+
+	el, ok := c.m[key]
+	if !ok {
+		c.counters.Misses++
+		return nil, false
+	}
+
+	it := el.Value.(*cacheItem)
+	if !time.Now().Before(it.e.ttl) {
+		c.counters.Misses++
+		return nil, false
+	}
+
+	it.hits++
+	c.ll.MoveToFront(el)
+	c.counters.Hits++
+	return it.e, true
+}
+
+// getStale returns an expired entry for use when the
+// upstream fails entries expired over maxStale are dropped
+func (c *cache) getStale(key string) (*entry, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	el, ok := c.m[key]
+	if !ok {
+		return nil, false
+	}
+
+	it := el.Value.(*cacheItem)
+	if time.Since(it.e.ttl) > maxStale {
+		c.removeElement(el)
+		return nil, false
+	}
 
-	i, ok := c.m[key]
-	return i, ok
+	c.ll.MoveToFront(el)
+	c.counters.Stale++
+	return it.e, true
+}
+
+// prefetch reports once per entry if a hot entry is
+// about to expire and should be refreshed by the caller
+func (c *cache) prefetch(key string) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	el, ok := c.m[key]
+	if !ok {
+		return false
+	}
+
+	it := el.Value.(*cacheItem)
+	if it.prefetching || it.hits < prefetchHits {
+		return false
+	}
+
+	ttl := it.e.ttl.Sub(it.added)
+	left := time.Until(it.e.ttl)
+	if left <= 0 || float64(left) > float64(ttl)*prefetchRatio {
+		return false
+	}
+
+	it.prefetching = true
+	c.counters.Prefetches++
+	return true
 }
 
 func (c *cache) remove(key string) {
 	c.Lock()
 	defer c.Unlock()
 
-	delete(c.m, key)
+	if el, ok := c.m[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+func (c *cache) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.m, el.Value.(*cacheItem).key)
 }
 
 func (c *cache) len() int {
-	c.RLock()
-	defer c.RUnlock()
+	c.Lock()
+	defer c.Unlock()
+
+	return c.ll.Len()
+}
+
+func (c *cache) stats() CacheStats {
+	c.Lock()
+	defer c.Unlock()
+
+	s := c.counters
+	s.Size = c.ll.Len()
+	return s
+}
+
+// staleRRs copies rrs with the ttl
+// of stale answers
+func staleRRs(rrs []dns.RR) []dns.RR {
+	out := make([]dns.RR, len(rrs))
+	for i, rr := range rrs {
+		out[i] = dns.Copy(rr)
+		out[i].Header().Ttl = staleTTL
+	}
 
-	return len(c.m)
+	return out
 }
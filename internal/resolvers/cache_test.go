@@ -0,0 +1,127 @@
+package resolvers
+
+import (
+	"context"
+	"errors"
+	"github.com/miekg/dns"
+	"github.com/randomlogin/sane/resolver"
+	"testing"
+	"time"
+)
+
+func TestCacheLRU(t *testing.T) {
+	c := newCache(2)
+	c.set("a", &entry{msg: 1, ttl: time.Now().Add(time.Hour)})
+	c.set("b", &entry{msg: 2, ttl: time.Now().Add(time.Hour)})
+
+	// a is used more recently so b is evicted
+	if _, ok := c.get("a"); !ok {
+		t.Fatal("got no entry for a")
+	}
+	c.set("c", &entry{msg: 3, ttl: time.Now().Add(time.Hour)})
+
+	if _, ok := c.get("b"); ok {
+		t.Fatal("got evicted entry b")
+	}
+	if _, ok := c.get("a"); !ok {
+		t.Fatal("got no entry for a")
+	}
+
+	// expired entries aren't returned but
+	// can be served stale
+	c.set("a", &entry{msg: 4, ttl: time.Now().Add(-time.Minute)})
+	if _, ok := c.get("a"); ok {
+		t.Fatal("got expired entry a")
+	}
+
+	e, ok := c.getStale("a")
+	if !ok || e.msg.(int) != 4 {
+		t.Fatalf("got stale entry = %v, %v, want 4", e, ok)
+	}
+
+	c.set("a", &entry{msg: 5, ttl: time.Now().Add(-maxStale - time.Minute)})
+	if _, ok := c.getStale("a"); ok {
+		t.Fatal("got entry expired over maxStale")
+	}
+
+	want := CacheStats{Size: 1, Hits: 2, Misses: 2, Evictions: 1, Stale: 1}
+	if got := c.stats(); got != want {
+		t.Fatalf("got stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestCachePrefetch(t *testing.T) {
+	c := newCache(10)
+	c.set("a", &entry{msg: 1, ttl: time.Now().Add(time.Minute)})
+	c.m["a"].Value.(*cacheItem).added = time.Now().Add(-time.Hour)
+
+	// only hot entries are prefetched
+	if c.prefetch("a") {
+		t.Fatal("got prefetch for a cold entry")
+	}
+
+	for i := 0; i < prefetchHits; i++ {
+		c.get("a")
+	}
+
+	if !c.prefetch("a") {
+		t.Fatal("got no prefetch for a hot entry about to expire")
+	}
+
+	// once per entry
+	if c.prefetch("a") {
+		t.Fatal("got prefetch twice")
+	}
+
+	// entries far from expiry aren't prefetched
+	c.set("b", &entry{msg: 2, ttl: time.Now().Add(time.Hour)})
+	for i := 0; i < prefetchHits; i++ {
+		c.get("b")
+	}
+
+	if c.prefetch("b") {
+		t.Fatal("got prefetch for a fresh entry")
+	}
+
+	if got := c.stats().Prefetches; got != 1 {
+		t.Fatalf("got prefetches = %d, want 1", got)
+	}
+}
+
+func TestHIP5ServeStale(t *testing.T) {
+	stub := &resolver.Stub{DefaultResolver: resolver.DefaultResolver{
+		Query: func(ctx context.Context, name string, qtype uint16) *resolver.DNSResult {
+			return &resolver.DNSResult{Err: resolver.ErrServFail}
+		},
+	}}
+
+	h := NewHIP5Resolver(stub, "0.0.0.0", func() bool {
+		return true
+	})
+	h.RegisterHandler("_example", func(ctx context.Context, qname string, qtype uint16, ns *dns.NS) ([]dns.RR, error) {
+		return []dns.RR{testRR(qname + " 300 IN A 127.0.0.1")}, nil
+	})
+
+	h.exchangeRoot = testExchangeRootFunc(t, "forever.",
+		[]dns.RR{testRR("forever. 300 IN NS data._example.")})
+
+	if res := h.Resolve(context.Background(), "forever.", dns.TypeA); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+
+	// expire the tld and fail the root
+	e, _ := h.tldCache.get("forever.")
+	e.ttl = time.Now().Add(-time.Minute)
+	h.exchangeRoot = func(ctx context.Context, m *dns.Msg, a string) (*dns.Msg, time.Duration, error) {
+		return nil, 0, errors.New("root unreachable")
+	}
+
+	res := h.Resolve(context.Background(), "forever.", dns.TypeA)
+	if res.Err != nil || res.Extension != "_example" {
+		t.Fatalf("got ext = %s, err = %v, want a stale answer from _example", res.Extension, res.Err)
+	}
+
+	if got := h.tldCache.stats().Stale; got == 0 {
+		t.Fatal("got no stale tld cache hits")
+	}
+}
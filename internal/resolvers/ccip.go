@@ -0,0 +1,216 @@
+package resolvers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CCIP read offchain lookups
+// https://eips.ethereum.org/EIPS/eip-3668
+
+// limits offchain lookups a single call can make
+const maxCCIPRedirects = 4
+
+// max gateway response size
+const maxCCIPResponse = 1 << 20
+
+const ccipABI = `[{"type":"error","name":"OffchainLookup","inputs":[{"name":"sender","type":"address"},{"name":"urls","type":"string[]"},{"name":"callData","type":"bytes"},{"name":"callbackFunction","type":"bytes4"},{"name":"extraData","type":"bytes"}]}]`
+
+var offchainLookupError = mustParseABI(ccipABI).Errors["OffchainLookup"]
+
+// callback(bytes response, bytes extraData)
+var ccipCallbackArgs = abi.Arguments{offchainLookupError.Inputs[2], offchainLookupError.Inputs[4]}
+
+type offchainLookup struct {
+	sender    common.Address
+	urls      []string
+	callData  []byte
+	callback  [4]byte
+	extraData []byte
+}
+
+func mustParseABI(s string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(s))
+	if err != nil {
+		panic(err)
+	}
+
+	return parsed
+}
+
+// revertData returns data included in a
+// reverted call error if any
+func revertData(err error) ([]byte, bool) {
+	var dataErr rpc.DataError
+	if !errors.As(err, &dataErr) {
+		return nil, false
+	}
+
+	s, ok := dataErr.ErrorData().(string)
+	if !ok {
+		return nil, false
+	}
+
+	data, decodeErr := hexutil.Decode(s)
+	return data, decodeErr == nil
+}
+
+func parseOffchainLookup(data []byte) (*offchainLookup, bool) {
+	if len(data) < 4 || !bytes.Equal(data[:4], offchainLookupError.ID[:4]) {
+		return nil, false
+	}
+
+	values, err := offchainLookupError.Inputs.Unpack(data[4:])
+	if err != nil || len(values) != 5 {
+		return nil, false
+	}
+
+	lookup := &offchainLookup{}
+	var ok [5]bool
+	lookup.sender, ok[0] = values[0].(common.Address)
+	lookup.urls, ok[1] = values[1].([]string)
+	lookup.callData, ok[2] = values[2].([]byte)
+	lookup.callback, ok[3] = values[3].([4]byte)
+	lookup.extraData, ok[4] = values[4].([]byte)
+
+	for _, o := range ok {
+		if !o {
+			return nil, false
+		}
+	}
+
+	return lookup, true
+}
+
+// ccipCall calls the contract following
+// any offchain lookups it requests
+func (e *Ethereum) ccipCall(ctx context.Context, to common.Address, data []byte) ([]byte, error) {
+	for i := 0; i <= maxCCIPRedirects; i++ {
+		ret, err := e.client.CallContract(ctx, ethereum.CallMsg{To: &to, Data: data}, nil)
+		if err == nil {
+			return ret, nil
+		}
+
+		revert, ok := revertData(err)
+		if !ok {
+			return nil, err
+		}
+
+		lookup, ok := parseOffchainLookup(revert)
+		if !ok {
+			return nil, err
+		}
+
+		// lookups can't be requested on
+		// behalf of other contracts
+		if lookup.sender != to {
+			return nil, fmt.Errorf("offchain lookup sender %s doesn't match %s", lookup.sender, to)
+		}
+
+		res, err := e.ccipFetch(ctx, lookup)
+		if err != nil {
+			return nil, fmt.Errorf("offchain lookup failed: %w", err)
+		}
+
+		// the callback verifies the gateway response
+		args, err := ccipCallbackArgs.Pack(res, lookup.extraData)
+		if err != nil {
+			return nil, err
+		}
+
+		data = append(lookup.callback[:], args...)
+	}
+
+	return nil, errors.New("too many offchain lookups")
+}
+
+// ccipFetch queries the lookup gateways in order
+func (e *Ethereum) ccipFetch(ctx context.Context, lookup *offchainLookup) ([]byte, error) {
+	sender := strings.ToLower(lookup.sender.Hex())
+	data := hexutil.Encode(lookup.callData)
+	lastErr := errors.New("no gateway urls")
+
+	for _, rawurl := range lookup.urls {
+		rawurl = strings.ReplaceAll(rawurl, "{sender}", sender)
+
+		var req *http.Request
+		var err error
+
+		if strings.Contains(rawurl, "{data}") {
+			rawurl = strings.ReplaceAll(rawurl, "{data}", data)
+			req, err = http.NewRequestWithContext(ctx, http.MethodGet, rawurl, nil)
+		} else {
+			body, _ := json.Marshal(map[string]string{"data": data, "sender": sender})
+			req, err = http.NewRequestWithContext(ctx, http.MethodPost, rawurl, bytes.NewReader(body))
+			if err == nil {
+				req.Header.Set("Content-Type", "application/json")
+			}
+		}
+
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if req.URL.Scheme != "https" && req.URL.Scheme != "http" {
+			lastErr = fmt.Errorf("unsupported gateway url %s", (&url.URL{Scheme: req.URL.Scheme, Host: req.URL.Host}).String())
+			continue
+		}
+
+		res, err := e.httpClient.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		b, err := readCCIPResponse(res)
+		// client errors are returned
+		// without trying other gateways
+		if err != nil && res.StatusCode >= 400 && res.StatusCode < 500 {
+			return nil, err
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		return b, nil
+	}
+
+	return nil, lastErr
+}
+
+func readCCIPResponse(res *http.Response) ([]byte, error) {
+	defer res.Body.Close()
+
+	var body struct {
+		Data    string `json:"data"`
+		Message string `json:"message"`
+	}
+
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxCCIPResponse)).Decode(&body); err != nil && res.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("bad gateway response: %v", err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		if body.Message != "" {
+			return nil, fmt.Errorf("gateway returned status %d: %s", res.StatusCode, body.Message)
+		}
+
+		return nil, fmt.Errorf("gateway returned status %d", res.StatusCode)
+	}
+
+	return hexutil.Decode(body.Data)
+}
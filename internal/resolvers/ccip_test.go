@@ -0,0 +1,179 @@
+package resolvers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testWildcardABI = `[{"type":"function","name":"resolveWithProof","stateMutability":"view","inputs":[{"name":"response","type":"bytes"},{"name":"extraData","type":"bytes"}],"outputs":[{"name":"","type":"bytes"}]}]`
+
+// newTestWildcard returns an ethereum client with an offchain
+// ENSIP-10 resolver set for base.eth answering through urls
+func newTestWildcard(t *testing.T, sender common.Address, urls []string) *Ethereum {
+	registryAddr := common.HexToAddress(FirstNLabels(ethNS[0].Ns, 1))
+	resolverAddr := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	wildcard := mustParseABI(testWildcardABI)
+	base := EnsNode("base.eth")
+
+	_, found := testMethod(t, ENSRegistryABI, "resolver", resolverAddr)
+	_, none := testMethod(t, ENSRegistryABI, "resolver", common.Address{})
+
+	registry := func(data []byte) ([]byte, error) {
+		if bytes.Equal(data[4:36], base[:]) {
+			return found, nil
+		}
+		return none, nil
+	}
+
+	resolver := func(data []byte) ([]byte, error) {
+		switch {
+		case bytes.Equal(data[:4], extendedResolverABI.Methods["supportsInterface"].ID):
+			return extendedResolverABI.Methods["supportsInterface"].Outputs.Pack(
+				bytes.Equal(data[4:8], extendedResolverInterface[:]))
+		case bytes.Equal(data[:4], extendedResolverABI.Methods["resolve"].ID):
+			args, err := extendedResolverABI.Methods["resolve"].Inputs.Unpack(data[4:])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			revert, err := offchainLookupError.Inputs.Pack(sender, urls, args[1].([]byte),
+				[4]byte(wildcard.Methods["resolveWithProof"].ID), args[0].([]byte))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			return nil, testRevert(append(offchainLookupError.ID[:4:4], revert...))
+		case bytes.Equal(data[:4], wildcard.Methods["resolveWithProof"].ID):
+			args, err := wildcard.Methods["resolveWithProof"].Inputs.Unpack(data[4:])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			name, _ := dnsEncode("alice.base.eth")
+			if !bytes.Equal(args[1].([]byte), name) {
+				t.Fatalf("got extra data = %x, want %x", args[1], name)
+			}
+
+			return wildcard.Methods["resolveWithProof"].Outputs.Pack(args[0].([]byte))
+		}
+
+		return nil, testRevert(nil)
+	}
+
+	e := newEthereum(&testBackend{calls: map[common.Address]func([]byte) ([]byte, error){
+		registryAddr: registry,
+		resolverAddr: resolver,
+	}})
+	e.gateways, _ = NewContentGateways("http://127.0.0.1:8080", "", "")
+	return e
+}
+
+func TestCCIPRead(t *testing.T) {
+	resolverAddr := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	contenthash, _ := hexutil.Decode("0xe3010170122029f2d17be6139079dc48696d1f582a8530eb9805b561eda517e22a892c7e3f1f")
+	_, ret := testMethod(t, ContentHashResolverABI, "contenthash", contenthash)
+
+	var gets, posts int
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data, sender string
+		switch r.Method {
+		case http.MethodGet:
+			gets++
+			if gets == 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			parts := strings.Split(strings.TrimSuffix(r.URL.Path, ".json"), "/")
+			sender, data = parts[1], parts[2]
+		case http.MethodPost:
+			posts++
+			var body struct {
+				Data   string `json:"data"`
+				Sender string `json:"sender"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			sender, data = body.Sender, body.Data
+		}
+
+		if sender != strings.ToLower(resolverAddr.Hex()) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		call, err := hexutil.Decode(data)
+		if err != nil || !bytes.Equal(call[:4], contentHashResolverABI.Methods["contenthash"].ID) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]string{"data": hexutil.Encode(ret)})
+	}))
+	defer gateway.Close()
+
+	urls := []string{gateway.URL + "/{sender}/{data}.json", gateway.URL}
+	e := newTestWildcard(t, resolverAddr, urls)
+
+	r, err := e.GetResolver(context.Background(), "alice.base.eth", FirstNLabels(ethNS[0].Ns, 1))
+	if err != nil || r == nil || !r.Extended {
+		t.Fatalf("got resolver = %v, %v, want extended resolver", r, err)
+	}
+
+	// first gateway fails with a server error
+	// and the next one is used
+	content, err := e.Content(context.Background(), "alice.base.eth.", ethNS[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "http://127.0.0.1:8080/ipfs/bafybeibj6lixxzqtsb45ysdjnupvqkufgdvzqbnvmhw2kf7cfkesy7r7d4"
+	if content.URL.String() != want {
+		t.Fatalf("got url = %s, want %s", content.URL, want)
+	}
+
+	if gets != 1 || posts != 1 {
+		t.Fatalf("got %d gets and %d posts, want 1 and 1", gets, posts)
+	}
+
+	// lookups on behalf of other contracts are rejected
+	e = newTestWildcard(t, common.HexToAddress("0x00000000000000000000000000000000000000bb"), urls)
+	if _, err = e.Content(context.Background(), "alice.base.eth.", ethNS[0]); err == nil || !strings.Contains(err.Error(), "sender") {
+		t.Fatalf("got err = %v, want sender mismatch", err)
+	}
+
+	// client errors aren't retried
+	gets, posts = 0, 0
+	e = newTestWildcard(t, resolverAddr, []string{gateway.URL + "/bad/{data}.json", gateway.URL})
+	gets = 1
+	if _, err = e.Content(context.Background(), "alice.base.eth.", ethNS[0]); err == nil || posts != 0 {
+		t.Fatalf("got err = %v with %d posts, want gateway error and no posts", err, posts)
+	}
+}
+
+func TestDNSEncode(t *testing.T) {
+	b, err := dnsEncode("alice.base.eth")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "\x05alice\x04base\x03eth\x00"; string(b) != want {
+		t.Fatalf("got %q, want %q", b, want)
+	}
+
+	if b, _ = dnsEncode(""); string(b) != "\x00" {
+		t.Fatalf("got %q, want root", b)
+	}
+
+	if _, err = dnsEncode("alice..eth"); err == nil {
+		t.Fatal("got nil err for empty label")
+	}
+}
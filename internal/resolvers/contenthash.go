@@ -0,0 +1,203 @@
+package resolvers
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/miekg/dns"
+	"net/url"
+	"strings"
+)
+
+// multicodec namespaces used by EIP-1577 contenthash
+const (
+	codecIPFS    = 0xe3
+	codecSwarm   = 0xe4
+	codecIPNS    = 0xe5
+	codecArweave = 0xb29910
+)
+
+// multicodecs found in contenthash CIDs
+const (
+	codecDagPB     = 0x70
+	codecLibp2pKey = 0x72
+	codecSwarmMF   = 0xfa
+	mhIdentity     = 0x00
+	mhSHA256       = 0x12
+	mhKeccak256    = 0x1b
+
+	anyCodec = ^uint64(0)
+)
+
+var errBadContentHash = errors.New("bad contenthash")
+
+// contentHash a decoded EIP-1577 contenthash
+type contentHash struct {
+	// namespace ipfs, ipns, bzz or arweave
+	namespace string
+	// id the content identifier in the form
+	// expected by gateways
+	id string
+}
+
+// decodeContentHash decodes an EIP-1577 contenthash
+// https://eips.ethereum.org/EIPS/eip-1577
+func decodeContentHash(b []byte) (*contentHash, error) {
+	codec, n := binary.Uvarint(b)
+	if n <= 0 {
+		return nil, errBadContentHash
+	}
+	b = b[n:]
+
+	switch codec {
+	case codecIPFS:
+		cid, err := normalizeCID(b)
+		if err != nil {
+			return nil, err
+		}
+
+		return &contentHash{namespace: "ipfs", id: cid}, nil
+	case codecIPNS:
+		// ipns names can be a dnslink name
+		// in an identity multihash
+		if name, ok := identityCID(b); ok {
+			return &contentHash{namespace: "ipns", id: name}, nil
+		}
+
+		cid, err := normalizeCID(b)
+		if err != nil {
+			return nil, err
+		}
+
+		return &contentHash{namespace: "ipns", id: cid}, nil
+	case codecSwarm:
+		// <cidv1><swarm-manifest><keccak-256><32 bytes>
+		hash, ok := readCID(b, codecSwarmMF, mhKeccak256)
+		if !ok || len(hash) != 32 {
+			return nil, fmt.Errorf("%w: bad swarm reference", errBadContentHash)
+		}
+
+		return &contentHash{namespace: "bzz", id: hex.EncodeToString(hash)}, nil
+	case codecArweave:
+		if len(b) != 32 {
+			return nil, fmt.Errorf("%w: bad arweave transaction id", errBadContentHash)
+		}
+
+		return &contentHash{namespace: "arweave", id: base64.RawURLEncoding.EncodeToString(b)}, nil
+	}
+
+	return nil, fmt.Errorf("%w: unsupported codec 0x%x", errBadContentHash, codec)
+}
+
+// normalizeCID returns a CIDv1 in base32 which
+// is accepted by both path and subdomain gateways
+func normalizeCID(b []byte) (string, error) {
+	// CIDv0 is a bare sha2-256 multihash
+	if len(b) == 34 && b[0] == mhSHA256 && b[1] == 32 {
+		b = append([]byte{0x01, codecDagPB}, b...)
+	}
+
+	cid := "b" + strings.ToLower(cidEncoding.EncodeToString(b))
+	if err := parseCID(cid); err != nil {
+		return "", fmt.Errorf("%w: %v", errBadContentHash, err)
+	}
+
+	return cid, nil
+}
+
+// readCID returns the digest of a CIDv1 with the
+// given codec and multihash function any codec
+// is accepted if codec is anyCodec
+func readCID(b []byte, codec, mh uint64) ([]byte, bool) {
+	var fields [4]uint64
+	for i := range fields {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, false
+		}
+
+		fields[i] = v
+		b = b[n:]
+	}
+
+	if fields[0] != 1 || (codec != anyCodec && fields[1] != codec) || fields[2] != mh || fields[3] != uint64(len(b)) {
+		return nil, false
+	}
+
+	return b, true
+}
+
+// identityCID returns a dnslink name stored in an identity
+// multihash libp2p keys may use one as well
+func identityCID(b []byte) (string, bool) {
+	if _, ok := readCID(b, codecLibp2pKey, mhIdentity); ok {
+		return "", false
+	}
+
+	digest, ok := readCID(b, anyCodec, mhIdentity)
+	if !ok || len(digest) == 0 {
+		return "", false
+	}
+
+	if _, ok := dns.IsDomainName(string(digest)); !ok {
+		return "", false
+	}
+
+	return string(digest), true
+}
+
+// ContentGateways base urls used to
+// serve decoded contenthashes
+type ContentGateways struct {
+	IPFS    *url.URL
+	Swarm   *url.URL
+	Arweave *url.URL
+}
+
+// NewContentGateways parses gateway urls
+// empty urls disable their namespace
+func NewContentGateways(ipfs, swarm, arweave string) (*ContentGateways, error) {
+	g := &ContentGateways{}
+	for _, gw := range []struct {
+		raw string
+		u   **url.URL
+	}{{ipfs, &g.IPFS}, {swarm, &g.Swarm}, {arweave, &g.Arweave}} {
+		if gw.raw == "" {
+			continue
+		}
+
+		u, err := url.Parse(gw.raw)
+		if err != nil {
+			return nil, fmt.Errorf("bad gateway %s: %v", gw.raw, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("bad gateway %s: unsupported scheme", gw.raw)
+		}
+
+		*gw.u = u
+	}
+
+	return g, nil
+}
+
+func (g *ContentGateways) content(ch *contentHash) (*Content, error) {
+	var base *url.URL
+	var elem []string
+
+	switch ch.namespace {
+	case "ipfs", "ipns":
+		base, elem = g.IPFS, []string{ch.namespace, ch.id}
+	case "bzz":
+		base, elem = g.Swarm, []string{"bzz", ch.id}
+	case "arweave":
+		base, elem = g.Arweave, []string{ch.id}
+	}
+
+	if base == nil {
+		return nil, fmt.Errorf("no gateway configured for %s content", ch.namespace)
+	}
+
+	return &Content{URL: base.JoinPath(elem...)}, nil
+}
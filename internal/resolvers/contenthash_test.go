@@ -0,0 +1,114 @@
+package resolvers
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDecodeContentHash(t *testing.T) {
+	arweaveID := make([]byte, 32)
+	arweaveID[0] = 0xff
+	arweave := hex.EncodeToString(append(binary.AppendUvarint(nil, codecArweave), arweaveID...))
+
+	tests := []struct {
+		hash      string
+		namespace string
+		id        string
+	}{
+		// EIP-1577 examples
+		{
+			hash:      "e3010170122029f2d17be6139079dc48696d1f582a8530eb9805b561eda517e22a892c7e3f1f",
+			namespace: "ipfs",
+			id:        "bafybeibj6lixxzqtsb45ysdjnupvqkufgdvzqbnvmhw2kf7cfkesy7r7d4",
+		},
+		{
+			hash:      "e40101fa011b20d1de9994b4d039f6548d191eb26786769f580809256b4685ef316805265ea162",
+			namespace: "bzz",
+			id:        "d1de9994b4d039f6548d191eb26786769f580809256b4685ef316805265ea162",
+		},
+		// cidv0
+		{
+			hash:      "e301122029f2d17be6139079dc48696d1f582a8530eb9805b561eda517e22a892c7e3f1f",
+			namespace: "ipfs",
+			id:        "bafybeibj6lixxzqtsb45ysdjnupvqkufgdvzqbnvmhw2kf7cfkesy7r7d4",
+		},
+		// dnslink name
+		{
+			hash:      "e5010170000f6170702e756e69737761702e6f7267",
+			namespace: "ipns",
+			id:        "app.uniswap.org",
+		},
+		{
+			hash:      "e50101720024080112205cbd1cc86ac20d6640795809c2a185bb2504538a2de8076da5a6971b8acb4715",
+			namespace: "ipns",
+			id:        "bafzaajaiaejcaxf5dtegvqqnmzahswajykqylozfarjyulpia5w2ljuxdofmwryv",
+		},
+		{
+			hash:      arweave,
+			namespace: "arweave",
+			id:        "_wAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA",
+		},
+	}
+
+	for _, test := range tests {
+		b, _ := hex.DecodeString(test.hash)
+		ch, err := decodeContentHash(b)
+		if err != nil {
+			t.Fatalf("decodeContentHash(%s) got err = %v, want nil", test.hash, err)
+		}
+
+		if ch.namespace != test.namespace || ch.id != test.id {
+			t.Fatalf("got %s/%s, want %s/%s", ch.namespace, ch.id, test.namespace, test.id)
+		}
+	}
+
+	bad := []string{
+		"",
+		// onion
+		"bc037a716b6c337a",
+		// truncated
+		"e3010170122029f2d17be6139079dc48696d1f582a8530eb9805b561eda517e22a892c7e3f",
+		"e40101fa011b20d1de9994b4d039f6548d191eb267",
+	}
+
+	for _, hash := range bad {
+		b, _ := hex.DecodeString(hash)
+		if _, err := decodeContentHash(b); !errors.Is(err, errBadContentHash) {
+			t.Fatalf("decodeContentHash(%s) got err = %v, want %v", hash, err, errBadContentHash)
+		}
+	}
+}
+
+func TestContentGateways(t *testing.T) {
+	g, err := NewContentGateways("http://127.0.0.1:8080", "https://swarm.example/", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := g.content(&contentHash{namespace: "ipns", id: "app.uniswap.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.URL.String(), "http://127.0.0.1:8080/ipns/app.uniswap.org"; got != want {
+		t.Fatalf("got url = %s, want %s", got, want)
+	}
+
+	c, err = g.content(&contentHash{namespace: "bzz", id: "d1de"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.URL.String(), "https://swarm.example/bzz/d1de"; got != want {
+		t.Fatalf("got url = %s, want %s", got, want)
+	}
+
+	if _, err = g.content(&contentHash{namespace: "arweave", id: "x"}); err == nil || !strings.Contains(err.Error(), "no gateway") {
+		t.Fatalf("got err = %v, want no gateway error", err)
+	}
+
+	if _, err = NewContentGateways("ftp://127.0.0.1", "", ""); err == nil {
+		t.Fatal("got nil err for unsupported gateway scheme")
+	}
+}
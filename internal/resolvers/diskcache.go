@@ -0,0 +1,285 @@
+package resolvers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/miekg/dns"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultDiskCacheSize max entries kept on disk
+const DefaultDiskCacheSize = 10000
+
+// entries of other versions are dropped
+const diskCacheVersion = 1
+
+// how long writes are batched before saving
+const diskCacheFlushDelay = 10 * time.Second
+
+// DiskEntry a cached rrset or value
+type DiskEntry struct {
+	// RRs records including their RRSIGs
+	// for DNSSEC validated entries
+	RRs []dns.RR
+	// Secure the entry was validated
+	Secure bool
+	// Value non record data
+	Value string
+	// Expires set on read
+	Expires time.Time
+}
+
+type diskRecord struct {
+	RRs     []string `json:"rrs,omitempty"`
+	Secure  bool     `json:"secure,omitempty"`
+	Value   string   `json:"value,omitempty"`
+	Expires int64    `json:"expires"`
+}
+
+type diskFile struct {
+	Version int                    `json:"version"`
+	Backend string                 `json:"backend"`
+	Entries map[string]*diskRecord `json:"entries"`
+}
+
+// DiskCache a size capped cache persisted to a file so
+// lookups survive restarts entries expire with their TTL
+// a nil cache is valid and caches nothing
+type DiskCache struct {
+	path string
+	maxN int
+
+	sync.Mutex
+	backend string
+	entries map[string]*diskRecord
+	dirty   bool
+	flush   *time.Timer
+
+	// serializes file writes
+	writeMu sync.Mutex
+}
+
+// OpenDiskCache loads the cache at path
+// a missing or corrupt file starts empty
+func OpenDiskCache(path string, maxN int) (*DiskCache, error) {
+	d := &DiskCache{
+		path:    path,
+		maxN:    maxN,
+		entries: make(map[string]*diskRecord),
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return d, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f diskFile
+	if err := json.Unmarshal(b, &f); err != nil || f.Version != diskCacheVersion {
+		return d, nil
+	}
+
+	now := time.Now().Unix()
+	for k, r := range f.Entries {
+		if r != nil && r.Expires > now {
+			d.entries[k] = r
+		}
+	}
+
+	d.backend = f.Backend
+	return d, nil
+}
+
+// SetBackend drops all entries if they were
+// cached using a different backend
+func (d *DiskCache) SetBackend(backend string) {
+	if d == nil {
+		return
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	if d.backend == backend {
+		return
+	}
+
+	d.backend = backend
+	d.entries = make(map[string]*diskRecord)
+	d.markDirty()
+}
+
+func (d *DiskCache) Get(key string) (*DiskEntry, bool) {
+	if d == nil {
+		return nil, false
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	r, ok := d.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	if time.Now().Unix() >= r.Expires {
+		delete(d.entries, key)
+		d.markDirty()
+		return nil, false
+	}
+
+	e := &DiskEntry{
+		Secure:  r.Secure,
+		Value:   r.Value,
+		Expires: time.Unix(r.Expires, 0),
+	}
+
+	for _, s := range r.RRs {
+		rr, err := dns.NewRR(s)
+		if err != nil || rr == nil {
+			delete(d.entries, key)
+			d.markDirty()
+			return nil, false
+		}
+
+		e.RRs = append(e.RRs, rr)
+	}
+
+	return e, true
+}
+
+func (d *DiskCache) Set(key string, e *DiskEntry, ttl time.Duration) {
+	if d == nil || d.maxN <= 0 {
+		return
+	}
+
+	r := &diskRecord{
+		Secure:  e.Secure,
+		Value:   e.Value,
+		Expires: time.Now().Add(ttl).Unix(),
+	}
+
+	for _, rr := range e.RRs {
+		r.RRs = append(r.RRs, rr.String())
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	if _, ok := d.entries[key]; !ok && len(d.entries) >= d.maxN {
+		d.evict()
+	}
+
+	d.entries[key] = r
+	d.markDirty()
+}
+
+func (d *DiskCache) Len() int {
+	if d == nil {
+		return 0
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	return len(d.entries)
+}
+
+// evict removes expired entries or
+// the entry expiring first if none
+func (d *DiskCache) evict() {
+	now := time.Now().Unix()
+
+	var first string
+	var firstExpires int64
+	for k, r := range d.entries {
+		if r.Expires <= now {
+			delete(d.entries, k)
+			continue
+		}
+
+		if first == "" || r.Expires < firstExpires {
+			first, firstExpires = k, r.Expires
+		}
+	}
+
+	if len(d.entries) >= d.maxN {
+		delete(d.entries, first)
+	}
+}
+
+func (d *DiskCache) markDirty() {
+	d.dirty = true
+	if d.flush == nil {
+		d.flush = time.AfterFunc(diskCacheFlushDelay, func() {
+			_ = d.Flush()
+		})
+	}
+}
+
+// Flush writes pending changes to disk
+func (d *DiskCache) Flush() error {
+	if d == nil {
+		return nil
+	}
+
+	d.writeMu.Lock()
+	defer d.writeMu.Unlock()
+
+	d.Lock()
+	if d.flush != nil {
+		d.flush.Stop()
+		d.flush = nil
+	}
+
+	if !d.dirty {
+		d.Unlock()
+		return nil
+	}
+
+	b, err := json.Marshal(&diskFile{
+		Version: diskCacheVersion,
+		Backend: d.backend,
+		Entries: d.entries,
+	})
+	d.dirty = false
+	d.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	// write to a temp file first so a crash
+	// never leaves a partial cache
+	tmp, err := os.CreateTemp(filepath.Dir(d.path), filepath.Base(d.path)+".*")
+	if err != nil {
+		return err
+	}
+
+	if _, err = tmp.Write(b); err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), d.path)
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return nil
+}
+
+// Close flushes the cache
+func (d *DiskCache) Close() error {
+	return d.Flush()
+}
@@ -0,0 +1,164 @@
+package resolvers
+
+import (
+	"context"
+	"fmt"
+	"github.com/miekg/dns"
+	"github.com/randomlogin/sane/resolver"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDiskCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+
+	d, err := OpenDiskCache(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.SetBackend("sane")
+
+	rrs := []dns.RR{
+		testRR("example. 300 IN DNSKEY 257 3 13 kXKkvWU3vGYfTJGl3qBd4qhiWp5aRs7YtkCJxD2d+t7KXqwahww5IgJtxJT2yFItlggazyfXqJEVOmMJ3qT0tQ=="),
+		testRR("example. 300 IN RRSIG DNSKEY 13 1 300 20300101000000 20200101000000 12345 example. 4YvNHdMqFuZT+gQEuK7UqJMgsiHjnnjAW3pL8Us52+4Zq5wXZSX91gyW1A9BAWCfPVZ8wS1a/p1UJi6eyMUkZQ=="),
+	}
+
+	d.Set("key;example.", &DiskEntry{RRs: rrs, Secure: true}, time.Hour)
+	d.Set("resolver;vitalik.eth.", &DiskEntry{Value: "0x01"}, time.Hour)
+	d.Set("expired", &DiskEntry{Value: "0x02"}, 0)
+
+	if _, ok := d.Get("expired"); ok {
+		t.Fatal("got expired entry")
+	}
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// entries survive reopening with their signatures
+	d, err = OpenDiskCache(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.SetBackend("sane")
+
+	e, ok := d.Get("key;example.")
+	if !ok || !e.Secure || len(e.RRs) != 2 {
+		t.Fatalf("got entry = %v, %v, want secure %v", e, ok, rrs)
+	}
+
+	for i, rr := range e.RRs {
+		if rr.String() != rrs[i].String() {
+			t.Fatalf("got rr = %s, want %s", rr, rrs[i])
+		}
+	}
+
+	if e, ok = d.Get("resolver;vitalik.eth."); !ok || e.Value != "0x01" {
+		t.Fatalf("got entry = %v, %v, want value 0x01", e, ok)
+	}
+
+	// the entry expiring first is evicted once full
+	d.Set("a", &DiskEntry{Value: "a"}, time.Minute)
+	d.Set("b", &DiskEntry{Value: "b"}, 2*time.Hour)
+	if _, ok := d.Get("a"); ok {
+		t.Fatal("got evicted entry a")
+	}
+	if got := d.Len(); got != 3 {
+		t.Fatalf("got len = %d, want 3", got)
+	}
+
+	// a different backend drops all entries
+	d.SetBackend("letsdane")
+	if got := d.Len(); got != 0 {
+		t.Fatalf("got len = %d, want 0", got)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err = OpenDiskCache(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := d.Len(); got != 0 {
+		t.Fatalf("got len = %d after reopening, want 0", got)
+	}
+}
+
+func TestDiskCacheConcurrent(t *testing.T) {
+	d, err := OpenDiskCache(filepath.Join(t.TempDir(), "cache.json"), 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				key := fmt.Sprintf("%d;%d", i, j)
+				d.Set(key, &DiskEntry{RRs: []dns.RR{testRR("example. 300 IN A 127.0.0.1")}}, time.Hour)
+				d.Get(key)
+				if j%25 == 0 {
+					if err := d.Flush(); err != nil {
+						t.Error(err)
+					}
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got := d.Len(); got != 50 {
+		t.Fatalf("got len = %d, want 50", got)
+	}
+}
+
+func TestHIP5DiskCache(t *testing.T) {
+	d, err := OpenDiskCache(filepath.Join(t.TempDir(), "cache.json"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newResolver := func() *HIP5Resolver {
+		stub := &resolver.Stub{DefaultResolver: resolver.DefaultResolver{
+			Query: func(ctx context.Context, name string, qtype uint16) *resolver.DNSResult {
+				return &resolver.DNSResult{Err: resolver.ErrServFail}
+			},
+		}}
+
+		h := NewHIP5Resolver(stub, "0.0.0.0", func() bool {
+			return true
+		})
+		h.SetDiskCache(d)
+		h.RegisterHandler("_example", func(ctx context.Context, qname string, qtype uint16, ns *dns.NS) ([]dns.RR, error) {
+			return []dns.RR{testRR(qname + " 300 IN A 127.0.0.1")}, nil
+		})
+
+		return h
+	}
+
+	h := newResolver()
+	h.exchangeRoot = testExchangeRootFunc(t, "forever.",
+		[]dns.RR{testRR("forever. 300 IN NS data._example.")})
+
+	if res := h.Resolve(context.Background(), "forever.", dns.TypeA); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+
+	// a new resolver finds the tld in the disk
+	// cache without asking the root
+	h = newResolver()
+	h.exchangeRoot = func(ctx context.Context, m *dns.Msg, a string) (*dns.Msg, time.Duration, error) {
+		t.Fatalf("unexpected root query %s", m.Question[0].Name)
+		return nil, 0, nil
+	}
+
+	res := h.Resolve(context.Background(), "forever.", dns.TypeA)
+	if res.Err != nil || res.Extension != "_example" || len(res.Records) != 1 {
+		t.Fatalf("got %v, ext = %s, err = %v, want an answer from _example", res.Records, res.Extension, res.Err)
+	}
+}
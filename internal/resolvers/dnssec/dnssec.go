@@ -445,7 +445,7 @@ func Verify(msg *dns.Msg, zone, qname string, qtype uint16, trustedKeys map[uint
 			return verifyNoData(msg, zone, qname, qtype)
 		}
 
-		return verifyAnswer(msg, qname, qtype)
+		return verifyAnswer(msg, zone, qname, qtype)
 	}
 
 	if msg.Rcode == dns.RcodeNameError {
@@ -456,15 +456,21 @@ func Verify(msg *dns.Msg, zone, qname string, qtype uint16, trustedKeys map[uint
 }
 
 // verifyAnswer pass a verified msg with fqdn canonical qname
-func verifyAnswer(msg *dns.Msg, qname string, qtype uint16) (bool, error) {
+func verifyAnswer(msg *dns.Msg, zone, qname string, qtype uint16) (bool, error) {
 	if len(msg.Answer) == 0 {
 		return false, errors.New("empty answer")
 	}
 
 	wildcard := false
-	nx := false
+	var wildcardLabels uint8
 	labels := uint8(dns.CountLabel(qname))
 
+	// a query for the wildcard owner
+	// itself isn't an expansion
+	if strings.HasPrefix(qname, "*.") {
+		labels--
+	}
+
 	// sanitized answer section
 	var answer []dns.RR
 
@@ -490,7 +496,12 @@ func verifyAnswer(msg *dns.Msg, qname string, qtype uint16) (bool, error) {
 
 			answer = append(answer, rr)
 			if sig.Labels < labels {
+				if wildcard && sig.Labels != wildcardLabels {
+					return false, fmt.Errorf("inconsistent wildcard signatures")
+				}
+
 				wildcard = true
+				wildcardLabels = sig.Labels
 			}
 			continue
 		}
@@ -503,26 +514,130 @@ func verifyAnswer(msg *dns.Msg, qname string, qtype uint16) (bool, error) {
 	msg.Answer = answer
 
 	// if the rrsig is for a wildcard
-	// there must be an NSEC proving the original name
+	// there must be a proof the original name
 	// doesn't exist
 	if wildcard {
-		for _, rr := range msg.Ns {
-			if rr.Header().Rrtype != dns.TypeNSEC {
-				continue
-			}
+		return verifyWildcardAnswer(msg, zone, qname, wildcardLabels)
+	}
 
-			nsec := rr.(*dns.NSEC)
-			if nx = covers(nsec.Header().Name, nsec.NextDomain, qname); nx {
-				break
-			}
+	return true, nil
+}
+
+// verifyWildcardAnswer RFC4035 5.3.4 and RFC5155 8.8
+// the closest encloser is derived from the rrsig labels
+func verifyWildcardAnswer(msg *dns.Msg, zone, qname string, labels uint8) (bool, error) {
+	ce := ancestor(qname, int(labels))
+	if !dns.IsSubDomain(zone, ce) {
+		return false, fmt.Errorf("wildcard out of bailiwick")
+	}
+
+	if len(extractRRSet(msg.Ns, "", dns.TypeNSEC3)) > 0 {
+		set, ok := extractNSEC3(msg.Ns, zone)
+		if !ok {
+			return false, nil
 		}
 
-		if !nx {
+		next := set.cover(ancestor(qname, int(labels)+1))
+		if next == nil {
 			return false, fmt.Errorf("bad wildcard substitution")
 		}
+
+		// qname may be an unsigned delegation
+		// within an opt-out span
+		return next.Flags&nsec3OptOut == 0, nil
 	}
 
-	return true, nil
+	for _, rr := range msg.Ns {
+		nsec, ok := rr.(*dns.NSEC)
+		if !ok {
+			continue
+		}
+
+		if nsecClosestEncloser(nsec, qname) == ce {
+			return true, nil
+		}
+	}
+
+	return false, fmt.Errorf("bad wildcard substitution")
+}
+
+// nsecClosestEncloser returns the closest encloser
+// of qname if the nsec proves it doesn't exist
+func nsecClosestEncloser(nsec *dns.NSEC, qname string) string {
+	if !covers(nsec.Header().Name, nsec.NextDomain, qname) || nsecAtDelegation(nsec, qname) {
+		return ""
+	}
+
+	// qname is an empty non-terminal
+	if IsSubDomainStrict(qname, nsec.NextDomain) {
+		return ""
+	}
+
+	// names between the closest encloser and qname
+	// would share more labels with owner or next
+	shared := dns.CompareDomainName(qname, nsec.Header().Name)
+	if n := dns.CompareDomainName(qname, nsec.NextDomain); n > shared {
+		shared = n
+	}
+
+	return ancestor(qname, shared)
+}
+
+// nsecAtDelegation whether nsec is owned by a delegation
+// point above qname the parent isn't authoritative for
+// names below it so it can't deny them
+func nsecAtDelegation(nsec *dns.NSEC, qname string) bool {
+	if !IsSubDomainStrict(nsec.Header().Name, qname) {
+		return false
+	}
+
+	hasNS, hasSOA := false, false
+	for _, t := range nsec.TypeBitMap {
+		switch t {
+		case dns.TypeNS:
+			hasNS = true
+		case dns.TypeSOA:
+			hasSOA = true
+		}
+	}
+
+	return hasNS && !hasSOA
+}
+
+// verifyWildcardNoData RFC4035 3.1.3.4 qname doesn't exist
+// and the wildcard at its closest encloser
+// doesn't own qtype. ok is false if msg
+// isn't a wildcard no data response
+func verifyWildcardNoData(msg *dns.Msg, zone, qname string, qtype uint16) (ok bool, err error) {
+	for _, rr := range msg.Ns {
+		nsec, isNSEC := rr.(*dns.NSEC)
+		if !isNSEC {
+			continue
+		}
+
+		ce := nsecClosestEncloser(nsec, qname)
+		if ce == "" || !dns.IsSubDomain(zone, ce) {
+			continue
+		}
+
+		wildcard := extractRRSet(msg.Ns, wildcardName(ce), dns.TypeNSEC)
+		if len(wildcard) == 0 {
+			return false, nil
+		}
+
+		for _, t := range wildcard[0].(*dns.NSEC).TypeBitMap {
+			if t == qtype {
+				return true, fmt.Errorf("type exists at wildcard")
+			}
+			if t == dns.TypeCNAME {
+				return true, fmt.Errorf("cname exists at wildcard")
+			}
+		}
+
+		return true, nil
+	}
+
+	return false, nil
 }
 
 func verifyNoData(msg *dns.Msg, zone, qname string, qtype uint16) (bool, error) {
@@ -530,14 +645,27 @@ func verifyNoData(msg *dns.Msg, zone, qname string, qtype uint16) (bool, error)
 		return false, fmt.Errorf("no nsec records found")
 	}
 
+	// referrals must prove the DS doesn't
+	// exist with an NSEC at the delegation
+	delegation := ""
+	for _, rr := range msg.Ns {
+		if rr.Header().Rrtype == dns.TypeNS && IsSubDomainStrict(zone, dns.CanonicalName(rr.Header().Name)) {
+			delegation = dns.CanonicalName(rr.Header().Name)
+			break
+		}
+	}
+
+	nsecQname, nsecQtype := qname, qtype
+	if delegation != "" {
+		nsecQname, nsecQtype = delegation, dns.TypeDS
+	}
+
 	for _, rr := range msg.Ns {
-		// no authenticated denial of existence
-		// for NSEC3 for now it should be downgraded
 		if rr.Header().Rrtype == dns.TypeNSEC3 {
 			// must be in bailiwick already checked
 			// by verifySignatures
 			if dns.IsSubDomain(zone, rr.Header().Name) {
-				return false, nil
+				return verifyNSEC3NoData(msg, zone, qname, qtype)
 			}
 		}
 
@@ -572,7 +700,15 @@ func verifyNoData(msg *dns.Msg, zone, qname string, qtype uint16) (bool, error)
 		if rr.Header().Rrtype == dns.TypeNSEC {
 			if nsec, ok := rr.(*dns.NSEC); ok {
 				// RFC4035 5.4 bullet 1
-				if !strings.EqualFold(nsec.Header().Name, qname) {
+				if !strings.EqualFold(nsec.Header().Name, nsecQname) {
+					if delegation != "" {
+						continue
+					}
+
+					if ok, err := verifyWildcardNoData(msg, zone, qname, qtype); ok {
+						return err == nil, err
+					}
+
 					// owner name doesn't match
 					// RFC4035 5.4 bullet 2
 					return verifyNameError(msg, zone, qname)
@@ -586,9 +722,10 @@ func verifyNoData(msg *dns.Msg, zone, qname string, qtype uint16) (bool, error)
 
 				hasDelegation := false
 				hasDS := false
+				hasSOA := false
 
 				for _, t := range nsec.TypeBitMap {
-					if t == qtype {
+					if t == nsecQtype {
 						return false, fmt.Errorf("type exists")
 					}
 					if t == dns.TypeCNAME {
@@ -603,6 +740,15 @@ func verifyNoData(msg *dns.Msg, zone, qname string, qtype uint16) (bool, error)
 					if t == dns.TypeNS {
 						hasDelegation = true
 					}
+
+					if t == dns.TypeSOA {
+						hasSOA = true
+					}
+				}
+
+				if delegation != "" && hasSOA {
+					return false, fmt.Errorf("bad insecure delegation proof " +
+						"SOA exists in NSEC bitmap")
 				}
 
 				// verify delegation
@@ -633,6 +779,10 @@ func verifyNoData(msg *dns.Msg, zone, qname string, qtype uint16) (bool, error)
 }
 
 func verifyNameError(msg *dns.Msg, zone, qname string) (bool, error) {
+	if len(extractRRSet(msg.Ns, "", dns.TypeNSEC3)) > 0 {
+		return verifyNSEC3NameError(msg, zone, qname)
+	}
+
 	nameProof := false
 	wildcardProof := false
 	qnameParts := dns.SplitDomainName(qname)
@@ -647,6 +797,12 @@ func verifyNameError(msg *dns.Msg, zone, qname string) (bool, error) {
 				continue
 			}
 
+			// the parent isn't authoritative
+			// for names below a delegation
+			if nsecAtDelegation(nsec, qname) {
+				continue
+			}
+
 			if !nameProof && covers(nsec.Header().Name, nsec.NextDomain, qname) {
 				nameProof = true
 			}
@@ -771,6 +927,27 @@ func covers(owner, next, qname string) (result bool) {
 	return true
 }
 
+// ancestor returns the rightmost n labels of name
+func ancestor(name string, n int) string {
+	labels := dns.Split(name)
+	if n <= 0 {
+		return "."
+	}
+	if n >= len(labels) {
+		return name
+	}
+
+	return name[labels[len(labels)-n]:]
+}
+
+func wildcardName(ce string) string {
+	if ce == "." {
+		return "*."
+	}
+
+	return "*." + ce
+}
+
 func compareWithErrors(a, b string, errs *int) int {
 	res, err := canonicalNameCompare(a, b)
 	if err != nil {
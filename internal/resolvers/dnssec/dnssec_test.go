@@ -30,6 +30,7 @@ type testCase struct {
 	time        time.Time
 	secure      bool
 	bogus       bool
+	err         string
 }
 
 func TestVerify(t *testing.T) {
@@ -296,6 +297,9 @@ func runTest(t *testing.T, hdr *testHDR, tc *testCase) {
 		if err == nil {
 			t.Fatalf("got no error, want bogus")
 		}
+		if !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("got err = %v, want %s", err, tc.err)
+		}
 	} else if err != nil {
 		t.Fatal(err)
 	} else if tc.secure != ok {
@@ -402,6 +406,8 @@ func parseTestFile(t *testing.T, f *os.File, run func(t *testing.T, hdr *testHDR
 					tc.secure = val == "1"
 				case "bogus":
 					tc.bogus = val == "1"
+				case "error":
+					tc.err = val
 				}
 			})
 			continue
@@ -0,0 +1,232 @@
+package dnssec
+
+import (
+	"fmt"
+	"github.com/miekg/dns"
+	"strings"
+)
+
+// RFC9276 3.2 responses using NSEC3 records
+// with more iterations are treated as insecure
+const maxNSEC3Iterations = 150
+
+const nsec3OptOut = 1
+
+type nsec3Set []*dns.NSEC3
+
+// extractNSEC3 returns NSEC3 records owned by zone
+// ok is false if denial of existence can't be
+// authenticated using these records
+func extractNSEC3(rrs []dns.RR, zone string) (set nsec3Set, ok bool) {
+	for _, rr := range rrs {
+		nsec3, isNSEC3 := rr.(*dns.NSEC3)
+		if !isNSEC3 {
+			continue
+		}
+
+		// owner name must be a single label
+		// hash directly below zone
+		owner := dns.CanonicalName(nsec3.Header().Name)
+		if !IsSubDomainStrict(zone, owner) || dns.CountLabel(owner) != dns.CountLabel(zone)+1 {
+			continue
+		}
+
+		// RFC5155 8.1, 8.2 ignore unknown
+		// hash algorithms and flags
+		if nsec3.Hash != dns.SHA1 || nsec3.Flags&^nsec3OptOut != 0 {
+			continue
+		}
+
+		if nsec3.Iterations > maxNSEC3Iterations {
+			return nil, false
+		}
+
+		set = append(set, nsec3)
+	}
+
+	return set, len(set) > 0
+}
+
+func (s nsec3Set) match(name string) *dns.NSEC3 {
+	for _, nsec3 := range s {
+		if nsec3.Match(name) {
+			return nsec3
+		}
+	}
+
+	return nil
+}
+
+func (s nsec3Set) cover(name string) *dns.NSEC3 {
+	for _, nsec3 := range s {
+		// Cover also accepts a hash equal to the owner
+		if !nsec3.Match(name) && nsec3.Cover(name) {
+			return nsec3
+		}
+	}
+
+	return nil
+}
+
+// closestEncloser finds the closest provable encloser
+// of qname and the NSEC3 covering the next closer name
+// RFC5155 8.3
+func (s nsec3Set) closestEncloser(zone, qname string) (string, *dns.NSEC3, error) {
+	labels := dns.Split(qname)
+
+	for i := range labels {
+		name := qname[labels[i]:]
+		if !dns.IsSubDomain(zone, name) {
+			break
+		}
+
+		nsec3 := s.match(name)
+		if nsec3 == nil {
+			continue
+		}
+
+		if i == 0 {
+			return "", nil, fmt.Errorf("nsec3 proves %s exists", qname)
+		}
+
+		// RFC5155 8.3 the closest encloser can't
+		// be a delegation or a DNAME
+		hasNS, hasSOA := false, false
+		for _, t := range nsec3.TypeBitMap {
+			switch t {
+			case dns.TypeDNAME:
+				return "", nil, fmt.Errorf("closest encloser %s has a DNAME", name)
+			case dns.TypeNS:
+				hasNS = true
+			case dns.TypeSOA:
+				hasSOA = true
+			}
+		}
+		if hasNS && !hasSOA {
+			return "", nil, fmt.Errorf("closest encloser %s is a delegation", name)
+		}
+
+		next := s.cover(qname[labels[i-1]:])
+		if next == nil {
+			return "", nil, fmt.Errorf("next closer name isn't covered")
+		}
+
+		return name, next, nil
+	}
+
+	return "", nil, fmt.Errorf("missing closest encloser proof")
+}
+
+// verifyNSEC3NameError RFC5155 8.4
+func verifyNSEC3NameError(msg *dns.Msg, zone, qname string) (bool, error) {
+	set, ok := extractNSEC3(msg.Ns, zone)
+	if !ok {
+		return false, nil
+	}
+
+	ce, next, err := set.closestEncloser(zone, qname)
+	if err != nil {
+		return false, err
+	}
+
+	if set.cover(wildcardName(ce)) == nil {
+		return false, fmt.Errorf("missing wildcard proof")
+	}
+
+	// qname may be an unsigned delegation
+	// within an opt-out span
+	if next.Flags&nsec3OptOut != 0 {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// verifyNSEC3NoData RFC5155 8.5, 8.6, 8.7 and 8.9
+func verifyNSEC3NoData(msg *dns.Msg, zone, qname string, qtype uint16) (bool, error) {
+	set, ok := extractNSEC3(msg.Ns, zone)
+	if !ok {
+		return false, nil
+	}
+
+	// referrals must prove the DS
+	// doesn't exist at the delegation
+	delegation := ""
+	for _, rr := range msg.Ns {
+		if rr.Header().Rrtype == dns.TypeNS {
+			delegation = dns.CanonicalName(rr.Header().Name)
+			break
+		}
+	}
+
+	if delegation != "" {
+		if strings.EqualFold(delegation, zone) {
+			return false, fmt.Errorf("bad referral")
+		}
+
+		qname = delegation
+		qtype = dns.TypeDS
+	}
+
+	if nsec3 := set.match(qname); nsec3 != nil {
+		hasNS, hasSOA := false, false
+
+		for _, t := range nsec3.TypeBitMap {
+			switch t {
+			case qtype:
+				return false, fmt.Errorf("type exists")
+			case dns.TypeCNAME:
+				return false, fmt.Errorf("cname exists")
+			case dns.TypeNS:
+				hasNS = true
+			case dns.TypeSOA:
+				hasSOA = true
+			}
+		}
+
+		if delegation != "" && !hasNS {
+			return false, fmt.Errorf("NS isn't set in NSEC3 bitmap")
+		}
+
+		// the parent isn't authoritative
+		// for names below a delegation
+		if qtype != dns.TypeDS && hasNS && !hasSOA {
+			return false, fmt.Errorf("no data proof from a delegation point")
+		}
+
+		return true, nil
+	}
+
+	ce, next, err := set.closestEncloser(zone, qname)
+	if err != nil {
+		return false, err
+	}
+
+	// only DS records within an opt-out span can be
+	// proven without a match RFC5155 8.6 the proof
+	// only shows the delegation is insecure
+	if qtype == dns.TypeDS {
+		if next.Flags&nsec3OptOut == 0 {
+			return false, fmt.Errorf("next closer name isn't covered by an opt-out NSEC3")
+		}
+
+		return false, nil
+	}
+
+	// RFC5155 8.7 wildcard no data
+	wildcard := set.match(wildcardName(ce))
+	if wildcard == nil {
+		return false, fmt.Errorf("missing NSEC3 matching qname")
+	}
+
+	for _, t := range wildcard.TypeBitMap {
+		if t == qtype {
+			return false, fmt.Errorf("type exists at wildcard")
+		}
+		if t == dns.TypeCNAME {
+			return false, fmt.Errorf("cname exists at wildcard")
+		}
+	}
+
+	return next.Flags&nsec3OptOut == 0, nil
+}
@@ -0,0 +1,372 @@
+package resolvers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"math/big"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// max time a single endpoint is given to answer
+const endpointTimeout = 10 * time.Second
+
+// max time a failing endpoint is skipped
+const maxEndpointBackoff = 5 * time.Minute
+
+var errNoQuorum = errors.New("ethereum endpoints didn't reach quorum")
+
+// ethEndpoint a lazily dialed ethereum rpc endpoint
+// with its health
+type ethEndpoint struct {
+	rawurl string
+
+	sync.Mutex
+	client   *ethclient.Client
+	failures int
+	lastErr  error
+	retryAt  time.Time
+}
+
+// name the endpoint without any path or query
+// since urls of providers often include api keys
+func (ep *ethEndpoint) name() string {
+	u, err := url.Parse(ep.rawurl)
+	if err != nil || u.Host == "" {
+		return ep.rawurl
+	}
+
+	return u.Scheme + "://" + u.Host
+}
+
+func (ep *ethEndpoint) dial(ctx context.Context) (*ethclient.Client, error) {
+	ep.Lock()
+	defer ep.Unlock()
+
+	if ep.client != nil {
+		return ep.client, nil
+	}
+
+	c, err := ethclient.DialContext(ctx, ep.rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	ep.client = c
+	return c, nil
+}
+
+func (ep *ethEndpoint) healthy() bool {
+	ep.Lock()
+	defer ep.Unlock()
+
+	return time.Now().After(ep.retryAt)
+}
+
+// done records the outcome of a request failing
+// endpoints are skipped with an exponential backoff
+func (ep *ethEndpoint) done(err error) {
+	ep.Lock()
+	defer ep.Unlock()
+
+	if err == nil {
+		ep.failures = 0
+		ep.lastErr = nil
+		ep.retryAt = time.Time{}
+		return
+	}
+
+	ep.failures++
+	ep.lastErr = err
+
+	backoff := maxEndpointBackoff
+	if ep.failures < 10 {
+		backoff = time.Second << ep.failures
+	}
+	if backoff > maxEndpointBackoff {
+		backoff = maxEndpointBackoff
+	}
+
+	ep.retryAt = time.Now().Add(backoff)
+}
+
+// isAnswer reports if err came from the chain
+// itself rather than a failing endpoint
+func isAnswer(err error) bool {
+	var dataErr rpc.DataError
+	return err == nil || errors.As(err, &dataErr) || errors.Is(err, ethereum.NotFound)
+}
+
+func callEndpoint[T any](ctx context.Context, ep *ethEndpoint, f func(ctx context.Context, c *ethclient.Client) (T, error)) (T, error) {
+	var v T
+
+	cctx, cancel := context.WithTimeout(ctx, endpointTimeout)
+	defer cancel()
+
+	start := time.Now()
+	c, err := ep.dial(cctx)
+	if err == nil {
+		v, err = f(cctx, c)
+	}
+	ethRPCDuration.Observe(time.Since(start).Seconds(), ep.name())
+
+	if isAnswer(err) {
+		ep.done(nil)
+		return v, err
+	}
+
+	// canceled by the caller not the endpoint's fault
+	if ctx.Err() != nil {
+		return v, err
+	}
+
+	ethRPCErrors.Inc(ep.name())
+	ep.done(err)
+	return v, fmt.Errorf("%s: %w", ep.name(), err)
+}
+
+// endpointPool ethereum endpoints used in order with failover
+// contract calls may require a quorum of endpoints to agree
+type endpointPool struct {
+	endpoints []*ethEndpoint
+	quorum    int
+}
+
+// splitEndpoints splits a comma separated list of endpoints
+func splitEndpoints(s string) []string {
+	var urls []string
+	for _, u := range strings.Split(s, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+
+	return urls
+}
+
+// newEndpointPool endpoints are dialed on first use
+// so unreachable ones don't fail the caller
+func newEndpointPool(urls []string, quorum int) (*endpointPool, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("no ethereum endpoints")
+	}
+
+	if quorum < 1 {
+		quorum = 1
+	}
+
+	if quorum > len(urls) {
+		return nil, fmt.Errorf("quorum of %d needs at least as many ethereum endpoints got %d", quorum, len(urls))
+	}
+
+	p := &endpointPool{quorum: quorum}
+	for _, u := range urls {
+		p.endpoints = append(p.endpoints, &ethEndpoint{rawurl: u})
+	}
+
+	return p, nil
+}
+
+// ordered returns healthy endpoints first
+// keeping the configured order
+func (p *endpointPool) ordered() []*ethEndpoint {
+	eps := make([]*ethEndpoint, len(p.endpoints))
+	copy(eps, p.endpoints)
+
+	sort.SliceStable(eps, func(i, j int) bool {
+		return eps[i].healthy() && !eps[j].healthy()
+	})
+
+	return eps
+}
+
+func failover[T any](ctx context.Context, p *endpointPool, f func(ctx context.Context, c *ethclient.Client) (T, error)) (T, error) {
+	var v T
+	var err error
+
+	for _, ep := range p.ordered() {
+		if v, err = callEndpoint(ctx, ep, f); isAnswer(err) || ctx.Err() != nil {
+			return v, err
+		}
+	}
+
+	return v, fmt.Errorf("ethereum endpoints unavailable: %w", err)
+}
+
+func (p *endpointPool) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	f := func(ctx context.Context, c *ethclient.Client) ([]byte, error) {
+		return c.CallContract(ctx, call, blockNumber)
+	}
+
+	if p.quorum == 1 {
+		return failover(ctx, p, f)
+	}
+
+	return p.quorumCall(ctx, f)
+}
+
+// quorumCall asks all endpoints concurrently and returns
+// once quorum of them agree on a result or revert
+func (p *endpointPool) quorumCall(ctx context.Context, f func(ctx context.Context, c *ethclient.Client) ([]byte, error)) ([]byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		ret []byte
+		err error
+	}
+
+	results := make(chan result, len(p.endpoints))
+	for _, ep := range p.endpoints {
+		go func(ep *ethEndpoint) {
+			ret, err := callEndpoint(ctx, ep, f)
+			results <- result{ret, err}
+		}(ep)
+	}
+
+	votes := make(map[string]int)
+	var lastErr error
+
+	for range p.endpoints {
+		r := <-results
+		if !isAnswer(r.err) {
+			lastErr = r.err
+			continue
+		}
+
+		key := "ok:" + string(r.ret)
+		if r.err != nil {
+			data, _ := revertData(r.err)
+			key = "err:" + r.err.Error() + string(data)
+		}
+
+		if votes[key]++; votes[key] >= p.quorum {
+			return r.ret, r.err
+		}
+	}
+
+	if lastErr != nil {
+		return nil, fmt.Errorf("%w: %v", errNoQuorum, lastErr)
+	}
+
+	return nil, errNoQuorum
+}
+
+// health checks all endpoints and returns an error
+// if fewer than quorum of them are reachable
+func (p *endpointPool) health(ctx context.Context) error {
+	errs := make([]error, len(p.endpoints))
+
+	var wg sync.WaitGroup
+	for i, ep := range p.endpoints {
+		wg.Add(1)
+		go func(i int, ep *ethEndpoint) {
+			defer wg.Done()
+			_, errs[i] = callEndpoint(ctx, ep, func(ctx context.Context, c *ethclient.Client) (uint64, error) {
+				return c.BlockNumber(ctx)
+			})
+		}(i, ep)
+	}
+	wg.Wait()
+
+	var failed []string
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+
+	if reachable := len(p.endpoints) - len(failed); reachable < p.quorum {
+		return fmt.Errorf("%d of %d ethereum endpoints reachable: %s", reachable, len(p.endpoints), strings.Join(failed, "; "))
+	}
+
+	return nil
+}
+
+func (p *endpointPool) BlockNumber(ctx context.Context) (uint64, error) {
+	return failover(ctx, p, func(ctx context.Context, c *ethclient.Client) (uint64, error) {
+		return c.BlockNumber(ctx)
+	})
+}
+
+func (p *endpointPool) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	return failover(ctx, p, func(ctx context.Context, c *ethclient.Client) (*types.Header, error) {
+		return c.HeaderByHash(ctx, hash)
+	})
+}
+
+func (p *endpointPool) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return failover(ctx, p, func(ctx context.Context, c *ethclient.Client) (*types.Header, error) {
+		return c.HeaderByNumber(ctx, number)
+	})
+}
+
+func (p *endpointPool) GetProof(ctx context.Context, addr common.Address, slots []common.Hash, block *big.Int) (*accountResult, error) {
+	return failover(ctx, p, func(ctx context.Context, c *ethclient.Client) (*accountResult, error) {
+		return (&rpcProofs{client: c.Client()}).GetProof(ctx, addr, slots, block)
+	})
+}
+
+func (p *endpointPool) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	return failover(ctx, p, func(ctx context.Context, c *ethclient.Client) ([]byte, error) {
+		return c.CodeAt(ctx, contract, blockNumber)
+	})
+}
+
+func (p *endpointPool) PendingCodeAt(ctx context.Context, account common.Address) ([]byte, error) {
+	return failover(ctx, p, func(ctx context.Context, c *ethclient.Client) ([]byte, error) {
+		return c.PendingCodeAt(ctx, account)
+	})
+}
+
+func (p *endpointPool) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	return failover(ctx, p, func(ctx context.Context, c *ethclient.Client) (uint64, error) {
+		return c.PendingNonceAt(ctx, account)
+	})
+}
+
+func (p *endpointPool) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return failover(ctx, p, func(ctx context.Context, c *ethclient.Client) (*big.Int, error) {
+		return c.SuggestGasPrice(ctx)
+	})
+}
+
+func (p *endpointPool) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	return failover(ctx, p, func(ctx context.Context, c *ethclient.Client) (*big.Int, error) {
+		return c.SuggestGasTipCap(ctx)
+	})
+}
+
+func (p *endpointPool) EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
+	return failover(ctx, p, func(ctx context.Context, c *ethclient.Client) (uint64, error) {
+		return c.EstimateGas(ctx, call)
+	})
+}
+
+func (p *endpointPool) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	_, err := failover(ctx, p, func(ctx context.Context, c *ethclient.Client) (struct{}, error) {
+		return struct{}{}, c.SendTransaction(ctx, tx)
+	})
+	return err
+}
+
+func (p *endpointPool) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	return failover(ctx, p, func(ctx context.Context, c *ethclient.Client) ([]types.Log, error) {
+		return c.FilterLogs(ctx, query)
+	})
+}
+
+func (p *endpointPool) SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	return failover(ctx, p, func(ctx context.Context, c *ethclient.Client) (ethereum.Subscription, error) {
+		return c.SubscribeFilterLogs(ctx, query, ch)
+	})
+}
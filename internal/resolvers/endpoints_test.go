@@ -0,0 +1,119 @@
+package resolvers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// testRPC a json-rpc endpoint answering eth_call
+// with result or failing if result is empty
+func testRPC(t *testing.T, result string) *httptest.Server {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if result == "" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		res := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result}
+		if req.Method == "eth_blockNumber" {
+			res["result"] = "0x1"
+		} else if result == "revert" {
+			delete(res, "result")
+			res["error"] = map[string]interface{}{"code": 3, "message": "execution reverted", "data": "0x01"}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(res)
+	}))
+
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestEndpointFailover(t *testing.T) {
+	down := testRPC(t, "")
+	up := testRPC(t, "0x0102")
+	to := common.Address{}
+
+	// unreachable endpoints don't fail startup
+	e, err := NewEthereum([]string{"http://127.0.0.1:1", down.URL, up.URL}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := e.client.(*endpointPool)
+	ret, err := pool.CallContract(context.Background(), ethereum.CallMsg{To: &to}, nil)
+	if err != nil || string(ret) != "\x01\x02" {
+		t.Fatalf("got %x, %v, want 0102", ret, err)
+	}
+
+	// failing endpoints are skipped
+	if eps := pool.ordered(); eps[0].rawurl != up.URL {
+		t.Fatalf("got first endpoint %s, want %s", eps[0].rawurl, up.URL)
+	}
+
+	// reverts are answers not endpoint failures
+	reverted := testRPC(t, "revert")
+	pool, _ = newEndpointPool([]string{reverted.URL, up.URL}, 1)
+	if _, err = pool.CallContract(context.Background(), ethereum.CallMsg{To: &to}, nil); err == nil || !isAnswer(err) {
+		t.Fatalf("got err = %v, want revert", err)
+	}
+
+	if err = e.Health(context.Background()); err != nil {
+		t.Fatalf("got health err = %v, want nil", err)
+	}
+
+	pool, _ = newEndpointPool([]string{down.URL}, 1)
+	if _, err = pool.BlockNumber(context.Background()); err == nil {
+		t.Fatal("got nil err with no reachable endpoints")
+	}
+
+	if err = pool.health(context.Background()); err == nil {
+		t.Fatal("got nil health err with no reachable endpoints")
+	}
+}
+
+func TestEndpointQuorum(t *testing.T) {
+	a := testRPC(t, "0x01")
+	b := testRPC(t, "0x02")
+	down := testRPC(t, "")
+	to := common.Address{}
+
+	pool, err := newEndpointPool([]string{a.URL, b.URL, testRPC(t, "0x01").URL}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ret, err := pool.CallContract(context.Background(), ethereum.CallMsg{To: &to}, nil)
+	if err != nil || string(ret) != "\x01" {
+		t.Fatalf("got %x, %v, want 01", ret, err)
+	}
+
+	pool, _ = newEndpointPool([]string{a.URL, b.URL, down.URL}, 2)
+	if _, err = pool.CallContract(context.Background(), ethereum.CallMsg{To: &to}, nil); !errors.Is(err, errNoQuorum) {
+		t.Fatalf("got err = %v, want %v", err, errNoQuorum)
+	}
+
+	if err = pool.health(context.Background()); err != nil {
+		t.Fatalf("got health err = %v, want nil", err)
+	}
+
+	if _, err = newEndpointPool([]string{a.URL}, 2); err == nil {
+		t.Fatal("got nil err for a quorum larger than the endpoints")
+	}
+}
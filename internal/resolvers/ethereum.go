@@ -2,14 +2,33 @@ package resolvers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/miekg/dns"
+	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// ENSIP-10 extended resolver interface id
+var extendedResolverInterface = [4]byte{0x90, 0x61, 0xb9, 0x23}
+
+const extendedResolverABIJSON = `[{"type":"function","name":"resolve","stateMutability":"view","inputs":[{"name":"name","type":"bytes"},{"name":"data","type":"bytes"}],"outputs":[{"name":"","type":"bytes"}]},{"type":"function","name":"supportsInterface","stateMutability":"view","inputs":[{"name":"interfaceID","type":"bytes4"}],"outputs":[{"name":"","type":"bool"}]}]`
+
+var (
+	extendedResolverABI    = mustParseABI(extendedResolverABIJSON)
+	dnsResolverABI         = mustParseABI(DNSResolverABI)
+	contentHashResolverABI = mustParseABI(ContentHashResolverABI)
+)
+
 // hardcoded .eth NS rrset pointing to their registry
 var ethNS = []*dns.NS{
 	{
@@ -23,29 +42,151 @@ var ethNS = []*dns.NS{
 	},
 }
 
+func init() {
+	RegisterExtension("_eth", func(setting func(key string) string) (Extension, error) {
+		quorum := 1
+		if q := setting("ETHEREUM_QUORUM"); q != "" {
+			var err error
+			if quorum, err = strconv.Atoi(q); err != nil {
+				return nil, fmt.Errorf("bad ethereum quorum %s", q)
+			}
+		}
+
+		e, err := NewEthereum(splitEndpoints(setting("ETHEREUM_ENDPOINT")), quorum)
+		if err != nil {
+			return nil, err
+		}
+
+		// registries on other evm chains
+		for _, id := range splitEndpoints(setting("ETHEREUM_CHAINS")) {
+			chainID, err := strconv.ParseUint(id, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad chain id %s", id)
+			}
+
+			quorum := 1
+			if q := setting("ETHEREUM_QUORUM_" + id); q != "" {
+				if quorum, err = strconv.Atoi(q); err != nil {
+					return nil, fmt.Errorf("bad ethereum quorum %s for chain %s", q, id)
+				}
+			}
+
+			if err = e.AddChain(chainID, splitEndpoints(setting("ETHEREUM_ENDPOINT_"+id)), quorum); err != nil {
+				return nil, fmt.Errorf("chain %s: %v", id, err)
+			}
+		}
+
+		if e.gateways, err = NewContentGateways(setting("IPFS_GATEWAY"),
+			setting("SWARM_GATEWAY"), setting("ARWEAVE_GATEWAY")); err != nil {
+			return nil, err
+		}
+
+		var headers HeaderSource
+		switch {
+		case setting("ETHEREUM_HEADER_ENDPOINT") != "":
+			headers, err = NewEndpointHeaders(setting("ETHEREUM_HEADER_ENDPOINT"))
+		case setting("ETHEREUM_CHECKPOINT") != "":
+			headers, err = NewCheckpointHeaders(e.client, setting("ETHEREUM_CHECKPOINT"))
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if headers != nil {
+			if err = e.SetHeaderSource(headers); err != nil {
+				return nil, err
+			}
+		}
+
+		return e, nil
+	})
+}
+
+// chain id of registries in NS records without one
+const mainnetChainID = 1
+
+// ethBackend ethereum client used by the extension
+// satisfied by ethclient and endpoint pools
+type ethBackend interface {
+	bind.ContractBackend
+	BlockNumber(ctx context.Context) (uint64, error)
+	HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error)
+}
+
 type Ethereum struct {
-	client *ethclient.Client
+	client ethBackend
 	// resolver cache
 	rCache *cache
 	// query cache
 	qCache map[uint16]*cache
+	// contenthash cache
+	cCache *cache
+	// extended resolver support cache
+	iCache *cache
+
+	// client used for offchain lookups
+	httpClient *http.Client
+
+	// proofs endpoint used by the verifier
+	proofs proofBackend
+	// verifies storage reads if set
+	verifier *lightClient
+
+	// gateways used to serve contenthash
+	// content disabled if nil
+	gateways *ContentGateways
+
+	// clients of other evm chains
+	// by chain id
+	chains map[uint64]*Ethereum
+
+	// persists resolver and query lookups
+	// keys are prefixed by chain
+	disk       *DiskCache
+	diskPrefix string
+}
+
+// ENSResolver a resolver contract found for a name
+type ENSResolver struct {
+	Address common.Address
+	// Extended the resolver implements ENSIP-10
+	// resolve(bytes,bytes) and may be a wildcard
+	Extended bool
+	// Verified the resolver was read through proofs
+	// and so are its records
+	Verified bool
 }
 
 type queryCacheData struct {
 	registry string
 	rrs      []dns.RR
+	verified bool
 }
 
-func NewEthereum(rawurl string) (*Ethereum, error) {
-	conn, err := ethclient.Dial(rawurl)
+// NewEthereum uses endpoints in order failing over to the next
+// one on errors contract calls must be answered the same by
+// quorum endpoints endpoints are dialed on first use
+func NewEthereum(endpoints []string, quorum int) (*Ethereum, error) {
+	pool, err := newEndpointPool(endpoints, quorum)
 	if err != nil {
 		return nil, err
 	}
 
+	e := newEthereum(pool)
+	e.proofs = pool
+	return e, nil
+}
+
+func newEthereum(client ethBackend) *Ethereum {
 	e := &Ethereum{
-		client: conn,
+		client: client,
 		rCache: newCache(200),
 		qCache: make(map[uint16]*cache),
+		cCache: newCache(200),
+		iCache: newCache(200),
+		chains: make(map[uint64]*Ethereum),
+
+		httpClient: &http.Client{Timeout: 10 * time.Second},
 	}
 
 	// caching lower level lookups only
@@ -54,19 +195,40 @@ func NewEthereum(rawurl string) (*Ethereum, error) {
 	e.qCache[dns.TypeCNAME] = newCache(200)
 	e.qCache[dns.TypeNS] = newCache(500)
 	e.qCache[dns.TypeDS] = newCache(500)
-	return e, nil
+	return e
 }
 
 func (e *Ethereum) GetResolverAddress(node, registryAddress string) (common.Address, error) {
 	key := node + ";" + registryAddress
-	r, ok := e.rCache.get(key)
-	if ok {
-		if time.Now().Before(r.ttl) {
+	if r, ok := e.rCache.get(key); ok {
+		if e.rCache.prefetch(key) {
+			go e.fetchResolverAddress(key, node, registryAddress)
+		}
+
+		return r.msg.(common.Address), nil
+	}
+
+	if d, ok := e.disk.Get(e.diskPrefix + "resolver;" + key); ok && common.IsHexAddress(d.Value) {
+		addr := common.HexToAddress(d.Value)
+		e.rCache.set(key, &entry{
+			msg: addr,
+			ttl: d.Expires,
+		})
+		return addr, nil
+	}
+
+	addr, err := e.fetchResolverAddress(key, node, registryAddress)
+	if !isAnswer(err) {
+		// serve stale while endpoints are failing
+		if r, ok := e.rCache.getStale(key); ok {
 			return r.msg.(common.Address), nil
 		}
-		e.rCache.remove(key)
 	}
 
+	return addr, err
+}
+
+func (e *Ethereum) fetchResolverAddress(key, node, registryAddress string) (common.Address, error) {
 	registry, err := NewENSRegistry(common.HexToAddress(registryAddress), e.client)
 	if err != nil {
 		return common.Address{}, err
@@ -86,6 +248,7 @@ func (e *Ethereum) GetResolverAddress(node, registryAddress string) (common.Addr
 		msg: addr,
 		ttl: time.Now().Add(6 * time.Hour),
 	})
+	e.disk.Set(e.diskPrefix+"resolver;"+key, &DiskEntry{Value: addr.Hex()}, 6*time.Hour)
 
 	return addr, nil
 }
@@ -100,16 +263,168 @@ func isZero(addr common.Address) bool {
 	return true
 }
 
-func (e *Ethereum) Resolve(registry string, ra common.Address, qname string, qtype uint16) ([]dns.RR, error) {
-	if isZero(ra) {
-		return nil, nil
+// GetResolver finds the resolver for name walking up its
+// parents for an ENSIP-10 wildcard resolver
+// https://docs.ens.domains/ensip/10
+func (e *Ethereum) GetResolver(ctx context.Context, name, registryAddress string) (*ENSResolver, error) {
+	if e.verifier != nil {
+		r, err := e.verifiedResolver(ctx, name, registryAddress)
+		if err == nil {
+			return r, nil
+		}
+
+		if !errors.Is(err, errNotVerifiable) {
+			return nil, err
+		}
+	}
+
+	labels := dns.SplitDomainName(name)
+	for i := range labels {
+		addr, err := e.GetResolverAddress(strings.Join(labels[i:], "."), registryAddress)
+		if err != nil {
+			return nil, err
+		}
+
+		if isZero(addr) {
+			continue
+		}
+
+		extended, err := e.supportsExtended(ctx, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		// resolvers of parent names must support wildcards
+		if i > 0 && !extended {
+			return nil, nil
+		}
+
+		return &ENSResolver{Address: addr, Extended: extended}, nil
+	}
+
+	return nil, nil
+}
+
+// verifiedResolver returns the resolver of name if it
+// and its records can be read through proofs
+func (e *Ethereum) verifiedResolver(ctx context.Context, name, registryAddress string) (*ENSResolver, error) {
+	key := "verified;" + name + ";" + registryAddress
+	if c, ok := e.rCache.get(key); ok {
+		return c.msg.(*ENSResolver), nil
+	}
+
+	normalizedName, err := Normalize(name)
+	if err != nil {
+		return nil, err
+	}
+
+	addr, err := e.verifier.registryResolver(ctx, common.HexToAddress(registryAddress), EnsNode(normalizedName))
+	if err != nil {
+		if c, ok := e.rCache.getStale(key); ok && !errors.Is(err, errNotVerifiable) && !errors.Is(err, errBadProof) {
+			return c.msg.(*ENSResolver), nil
+		}
+
+		return nil, err
+	}
+
+	if _, ok := verifiableResolvers[addr]; !ok {
+		return nil, errNotVerifiable
+	}
+
+	r := &ENSResolver{Address: addr, Verified: true}
+	e.rCache.set(key, &entry{
+		msg: r,
+		ttl: time.Now().Add(6 * time.Hour),
+	})
+
+	return r, nil
+}
+
+func (e *Ethereum) supportsExtended(ctx context.Context, addr common.Address) (bool, error) {
+	key := addr.Hex()
+	if c, ok := e.iCache.get(key); ok {
+		return c.msg.(bool), nil
+	}
+
+	data, err := extendedResolverABI.Pack("supportsInterface", extendedResolverInterface)
+	if err != nil {
+		return false, err
+	}
+
+	var extended bool
+	ret, err := e.client.CallContract(ctx, ethereum.CallMsg{To: &addr, Data: data}, nil)
+	if err != nil {
+		// resolvers without erc-165 support revert
+		var dataErr rpc.DataError
+		if !errors.As(err, &dataErr) {
+			if c, ok := e.iCache.getStale(key); ok && !isAnswer(err) {
+				return c.msg.(bool), nil
+			}
+
+			return false, err
+		}
+	} else if out, err := extendedResolverABI.Unpack("supportsInterface", ret); err == nil {
+		extended, _ = out[0].(bool)
 	}
 
-	r, err := NewDNSResolver(ra, e.client)
+	e.iCache.set(key, &entry{
+		msg: extended,
+		ttl: time.Now().Add(6 * time.Hour),
+	})
+
+	return extended, nil
+}
+
+// callResolver calls method on the resolver of name through
+// resolve(bytes,bytes) if the resolver is extended
+func (e *Ethereum) callResolver(ctx context.Context, r *ENSResolver, name string, contract abi.ABI, method string, args ...interface{}) ([]interface{}, error) {
+	data, err := contract.Pack(method, args...)
 	if err != nil {
 		return nil, err
 	}
 
+	if r.Extended {
+		normalizedName, err := Normalize(name)
+		if err != nil {
+			return nil, err
+		}
+
+		encoded, err := dnsEncode(normalizedName)
+		if err != nil {
+			return nil, err
+		}
+
+		if data, err = extendedResolverABI.Pack("resolve", encoded, data); err != nil {
+			return nil, err
+		}
+	}
+
+	ret, err := e.ccipCall(ctx, r.Address, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ret) == 0 {
+		return nil, bind.ErrNoCode
+	}
+
+	if r.Extended {
+		out, err := extendedResolverABI.Unpack("resolve", ret)
+		if err != nil {
+			return nil, err
+		}
+
+		ret, _ = out[0].([]byte)
+	}
+
+	return contract.Unpack(method, ret)
+}
+
+func (e *Ethereum) Resolve(ctx context.Context, registry string, r *ENSResolver, qname string, qtype uint16) ([]dns.RR, error) {
+	if r == nil {
+		return nil, nil
+	}
+
 	qname = dns.CanonicalName(qname)
 	node := toNode(qname)
 	nodeHash, err := NameHash(node)
@@ -117,7 +432,7 @@ func (e *Ethereum) Resolve(registry string, ra common.Address, qname string, qty
 		return nil, err
 	}
 
-	res, err := e.queryWithResolver(registry, r, nodeHash, qname, qtype)
+	res, err := e.queryWithResolver(ctx, registry, r, node, nodeHash, qname, qtype)
 	if err != nil {
 		return nil, err
 	}
@@ -125,32 +440,64 @@ func (e *Ethereum) Resolve(registry string, ra common.Address, qname string, qty
 	return res, nil
 }
 
-func (e *Ethereum) checkQueryCache(registry string, qname string, qtype uint16) ([]dns.RR, bool) {
+func (e *Ethereum) checkQueryCache(registry string, qname string, qtype uint16, verified bool) ([]dns.RR, bool) {
 	c, ok := e.qCache[qtype]
 	if !ok {
 		return nil, false
 	}
-	entry, ok := c.get(qname)
-	if !ok {
+
+	if cached, ok := c.get(qname); ok {
+		m := cached.msg.(*queryCacheData)
+		if strings.EqualFold(m.registry, registry) && m.verified == verified {
+			return m.rrs, true
+		}
+		c.remove(qname)
+	}
+
+	d, ok := e.disk.Get(e.queryDiskKey(registry, qname, qtype))
+	if !ok || d.Secure != verified {
 		return nil, false
 	}
 
-	if time.Now().After(entry.ttl) {
-		c.remove(qname)
+	c.set(qname, &entry{
+		msg: &queryCacheData{
+			registry: registry,
+			rrs:      d.RRs,
+			verified: verified,
+		},
+		ttl: d.Expires,
+	})
+
+	return d.RRs, true
+}
+
+// staleQuery returns expired records while endpoints
+// are failing proofs that don't verify aren't failures
+func (e *Ethereum) staleQuery(registry string, qname string, qtype uint16, verified bool, err error) ([]dns.RR, bool) {
+	c, ok := e.qCache[qtype]
+	if !ok || isAnswer(err) || errors.Is(err, errBadProof) {
 		return nil, false
 	}
 
-	m := entry.msg.(*queryCacheData)
-	if !strings.EqualFold(m.registry, registry) {
-		c.remove(qname)
+	cached, ok := c.getStale(qname)
+	if !ok {
 		return nil, false
 	}
 
-	return m.rrs, true
+	m := cached.msg.(*queryCacheData)
+	if !strings.EqualFold(m.registry, registry) || m.verified != verified {
+		return nil, false
+	}
+
+	return staleRRs(m.rrs), true
+}
+
+func (e *Ethereum) queryDiskKey(registry string, qname string, qtype uint16) string {
+	return e.diskPrefix + "query;" + strings.ToLower(registry) + ";" + qname + ";" + dns.TypeToString[qtype]
 }
 
-func (e *Ethereum) dnsRecord(registry string, r *DNSResolver, node [32]byte, qname string, qtype uint16) ([]dns.RR, error) {
-	if rrs, ok := e.checkQueryCache(registry, qname, qtype); ok {
+func (e *Ethereum) dnsRecord(ctx context.Context, registry string, r *ENSResolver, node string, nodeHash [32]byte, qname string, qtype uint16) ([]dns.RR, error) {
+	if rrs, ok := e.checkQueryCache(registry, qname, qtype, r.Verified); ok {
 		return rrs, nil
 	}
 
@@ -159,28 +506,44 @@ func (e *Ethereum) dnsRecord(registry string, r *DNSResolver, node [32]byte, qna
 		return nil, err
 	}
 
-	raw, err := r.DnsRecord(nil, node, qnameHash, qtype)
+	var raw []byte
+	if r.Verified {
+		raw, err = e.verifier.dnsRecord(ctx, r.Address, nodeHash, qnameHash, qtype)
+	} else {
+		var out []interface{}
+		if out, err = e.callResolver(ctx, r, node, dnsResolverABI, "dnsRecord", nodeHash, qnameHash, qtype); err == nil {
+			raw, _ = out[0].([]byte)
+		}
+	}
+
 	if err != nil {
+		if rrs, ok := e.staleQuery(registry, qname, qtype, r.Verified, err); ok {
+			return rrs, nil
+		}
+
 		return nil, err
 	}
 
 	rrs := unpackRRSet(raw)
 
 	if qtype == dns.TypeCNAME || qtype == dns.TypeNS || qtype == dns.TypeDS {
+		ttl := getTTL(rrs)
 		e.qCache[qtype].set(qname, &entry{
 			msg: &queryCacheData{
 				registry: registry,
 				rrs:      rrs,
+				verified: r.Verified,
 			},
-			ttl: time.Now().Add(getTTL(rrs)),
+			ttl: time.Now().Add(ttl),
 		})
+		e.disk.Set(e.queryDiskKey(registry, qname, qtype), &DiskEntry{RRs: rrs, Secure: r.Verified}, ttl)
 	}
 
 	return rrs, nil
 }
 
-func (e *Ethereum) queryWithResolver(registry string, r *DNSResolver, nodeHash [32]byte, qname string, qtype uint16) ([]dns.RR, error) {
-	rawRecords, err := e.dnsRecord(registry, r, nodeHash, qname, qtype)
+func (e *Ethereum) queryWithResolver(ctx context.Context, registry string, r *ENSResolver, node string, nodeHash [32]byte, qname string, qtype uint16) ([]dns.RR, error) {
+	rawRecords, err := e.dnsRecord(ctx, registry, r, node, nodeHash, qname, qtype)
 	if err != nil {
 		return nil, err
 	}
@@ -201,14 +564,14 @@ func (e *Ethereum) queryWithResolver(registry string, r *DNSResolver, nodeHash [
 			name := dns.Fqdn(LastNLabels(qname, labels))
 			labels++
 
-			if rawRecords, err = e.dnsRecord(registry, r, nodeHash, name, dns.TypeNS); err != nil {
+			if rawRecords, err = e.dnsRecord(ctx, registry, r, node, nodeHash, name, dns.TypeNS); err != nil {
 				return nil, err
 			}
 
 			// a delegation exists check if it's signed
 			if len(rawRecords) > 0 {
 				var dsSet []dns.RR
-				if dsSet, err = e.dnsRecord(registry, r, nodeHash, name, dns.TypeDS); err != nil {
+				if dsSet, err = e.dnsRecord(ctx, registry, r, node, nodeHash, name, dns.TypeDS); err != nil {
 					return nil, err
 				}
 
@@ -224,7 +587,7 @@ func (e *Ethereum) queryWithResolver(registry string, r *DNSResolver, nodeHash [
 	if len(rawRecords) == 0 {
 		// no records for original qname and no delegations
 		// check if a CNAME exists
-		if rawRecords, err = e.dnsRecord(registry, r, nodeHash, qname, dns.TypeCNAME); err != nil {
+		if rawRecords, err = e.dnsRecord(ctx, registry, r, node, nodeHash, qname, dns.TypeCNAME); err != nil {
 			return nil, err
 		}
 	}
@@ -232,17 +595,258 @@ func (e *Ethereum) queryWithResolver(registry string, r *DNSResolver, nodeHash [
 	return rawRecords, nil
 }
 
+// AddChain resolves registries deployed on the
+// evm chain with the given id using endpoints
+func (e *Ethereum) AddChain(chainID uint64, endpoints []string, quorum int) error {
+	if chainID == mainnetChainID {
+		return errors.New("mainnet uses the default endpoints")
+	}
+
+	pool, err := newEndpointPool(endpoints, quorum)
+	if err != nil {
+		return err
+	}
+
+	c := newEthereum(pool)
+	c.proofs = pool
+	c.disk = e.disk
+	c.diskPrefix = chainDiskPrefix(chainID)
+	e.chains[chainID] = c
+	return nil
+}
+
+func chainDiskPrefix(chainID uint64) string {
+	return "eth;" + strconv.FormatUint(chainID, 10) + ";"
+}
+
+// SetDiskCache persists resolver addresses and
+// delegations of all chains in d
+func (e *Ethereum) SetDiskCache(d *DiskCache) {
+	e.disk = d
+	e.diskPrefix = chainDiskPrefix(mainnetChainID)
+	for id, c := range e.chains {
+		c.disk = d
+		c.diskPrefix = chainDiskPrefix(id)
+	}
+}
+
+// chain returns the client and registry address of a hip-5 NS
+// record <registry>._eth. on mainnet or <registry>.<chain id>._eth.
+func (e *Ethereum) chain(ns *dns.NS) (*Ethereum, string, error) {
+	labels := dns.SplitDomainName(dns.CanonicalName(ns.Ns))
+
+	switch len(labels) {
+	case 2:
+		return e, labels[0], nil
+	case 3:
+		chainID, err := strconv.ParseUint(labels[1], 10, 64)
+		if err != nil {
+			return nil, "", fmt.Errorf("bad chain id in %s", ns.Ns)
+		}
+
+		if chainID == mainnetChainID {
+			return e, labels[0], nil
+		}
+
+		c, ok := e.chains[chainID]
+		if !ok {
+			return nil, "", fmt.Errorf("no ethereum endpoint configured for chain %d", chainID)
+		}
+
+		return c, labels[0], nil
+	}
+
+	return nil, "", fmt.Errorf("bad _eth NS target %s", ns.Ns)
+}
+
 func (e *Ethereum) Handler(ctx context.Context, qname string, qtype uint16, ns *dns.NS) ([]dns.RR, error) {
-	registryAddress := FirstNLabels(ns.Ns, 1)
+	rrs, _, err := e.VerifiedHandler(ctx, qname, qtype, ns)
+	return rrs, err
+}
+
+// VerifiedHandler resolves qname reporting whether the records
+// were read through proofs verified against a trusted header
+func (e *Ethereum) VerifiedHandler(ctx context.Context, qname string, qtype uint16, ns *dns.NS) ([]dns.RR, bool, error) {
+	c, registryAddress, err := e.chain(ns)
+	if err != nil {
+		return nil, false, err
+	}
+
 	node := toNode(qname)
+	r, err := c.GetResolver(ctx, node, registryAddress)
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to get resolver from registry %s: %v", registryAddress, err)
+	}
+
+	rrs, err := c.Resolve(ctx, registryAddress, r, qname, qtype)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return rrs, r != nil && r.Verified, nil
+}
+
+// SetHeaderSource verifies registry and resolver storage
+// against headers from src so answers can be secure
+func (e *Ethereum) SetHeaderSource(src HeaderSource) error {
+	if e.proofs == nil {
+		return errors.New("ethereum endpoint doesn't support proofs")
+	}
+
+	e.verifier = &lightClient{proofs: e.proofs, headers: src}
+	return nil
+}
 
-	var resolverAddr common.Address
-	var err error
+// CacheStats returns counters of the mainnet caches
+func (e *Ethereum) CacheStats() map[string]CacheStats {
+	return map[string]CacheStats{
+		"resolver":    e.rCache.stats(),
+		"query.cname": e.qCache[dns.TypeCNAME].stats(),
+		"query.ns":    e.qCache[dns.TypeNS].stats(),
+		"query.ds":    e.qCache[dns.TypeDS].stats(),
+		"contenthash": e.cCache.stats(),
+		"interface":   e.iCache.stats(),
+	}
+}
 
-	resolverAddr, err = e.GetResolverAddress(node, registryAddress)
+func (e *Ethereum) Name() string {
+	return "_eth"
+}
+
+// Health checks the endpoints of every chain are reachable
+func (e *Ethereum) Health(ctx context.Context) error {
+	if err := e.health(ctx); err != nil {
+		return err
+	}
+
+	ids := make([]uint64, 0, len(e.chains))
+	for id := range e.chains {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	for _, id := range ids {
+		if err := e.chains[id].health(ctx); err != nil {
+			return fmt.Errorf("chain %d: %v", id, err)
+		}
+	}
+
+	return nil
+}
+
+func (e *Ethereum) health(ctx context.Context) error {
+	if pool, ok := e.client.(*endpointPool); ok {
+		if err := pool.health(ctx); err != nil {
+			return err
+		}
+	} else if _, err := e.client.BlockNumber(ctx); err != nil {
+		return err
+	}
+
+	if e.verifier != nil {
+		if _, err := e.verifier.headers.TrustedHeader(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *Ethereum) CachePolicy() CachePolicy {
+	return CachePolicy{}
+}
+
+// Content returns the gateway url serving
+// the EIP-1577 contenthash of qname
+func (e *Ethereum) Content(ctx context.Context, qname string, ns *dns.NS) (*Content, error) {
+	if e.gateways == nil {
+		return nil, ErrNoContent
+	}
+
+	c, registryAddress, err := e.chain(ns)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSuffix(dns.CanonicalName(qname), ".")
+	raw, err := c.contenthash(ctx, name, registryAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	ch, err := decodeContentHash(raw)
 	if err != nil {
-		return nil, fmt.Errorf("unable to get resolver address from registry %s: %v", registryAddress, err)
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return e.gateways.content(ch)
+}
+
+func (e *Ethereum) contenthash(ctx context.Context, name, registryAddress string) ([]byte, error) {
+	key := name + ";" + registryAddress
+	if c, ok := e.cCache.get(key); ok {
+		raw := c.msg.([]byte)
+		if len(raw) == 0 {
+			return nil, ErrNoContent
+		}
+
+		return raw, nil
+	}
+
+	raw, err := e.fetchContenthash(ctx, name, registryAddress)
+	if err != nil {
+		c, ok := e.cCache.getStale(key)
+		if !ok {
+			return nil, err
+		}
+
+		raw = c.msg.([]byte)
+	} else {
+		e.cCache.set(key, &entry{
+			msg: raw,
+			ttl: time.Now().Add(5 * time.Minute),
+		})
+	}
+
+	if len(raw) == 0 {
+		return nil, ErrNoContent
+	}
+
+	return raw, nil
+}
+
+func (e *Ethereum) fetchContenthash(ctx context.Context, name, registryAddress string) ([]byte, error) {
+	r, err := e.GetResolver(ctx, name, registryAddress)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get resolver from registry %s: %v", registryAddress, err)
+	}
+
+	if r == nil {
+		return nil, nil
+	}
+
+	return e.callContenthash(ctx, r, name)
+}
+
+func (e *Ethereum) callContenthash(ctx context.Context, r *ENSResolver, name string) ([]byte, error) {
+	normalizedName, err := Normalize(name)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := e.callResolver(ctx, r, name, contentHashResolverABI, "contenthash", EnsNode(normalizedName))
+	if err != nil {
+		// resolvers without contenthash support revert
+		var dataErr rpc.DataError
+		if errors.Is(err, bind.ErrNoCode) || errors.As(err, &dataErr) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("contenthash call failed: %v", err)
 	}
 
-	return e.Resolve(registryAddress, resolverAddr, qname, qtype)
+	raw, _ := out[0].([]byte)
+	return raw, nil
 }
@@ -0,0 +1,206 @@
+package resolvers
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/miekg/dns"
+	"github.com/randomlogin/sane/resolver"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// testBackend answers contract calls with fixed
+// abi encoded return values for each method or
+// with a func for contracts in calls
+type testBackend struct {
+	contracts map[common.Address]map[[4]byte][]byte
+	calls     map[common.Address]func(data []byte) ([]byte, error)
+	header    *types.Header
+	bind.ContractBackend
+}
+
+// testRevert a reverted call error as
+// returned by ethclient
+type testRevert []byte
+
+func (r testRevert) Error() string {
+	return "execution reverted"
+}
+
+func (r testRevert) ErrorCode() int {
+	return 3
+}
+
+func (r testRevert) ErrorData() interface{} {
+	return hexutil.Encode(r)
+}
+
+func (b *testBackend) BlockNumber(ctx context.Context) (uint64, error) {
+	return 1, nil
+}
+
+func (b *testBackend) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	if b.header == nil || b.header.Hash() != hash {
+		return nil, errors.New("not found")
+	}
+
+	return b.header, nil
+}
+
+func (b *testBackend) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	_, hasCalls := b.calls[contract]
+	if _, ok := b.contracts[contract]; !ok && !hasCalls {
+		return nil, nil
+	}
+
+	return []byte{0x00}, nil
+}
+
+func (b *testBackend) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	if f, ok := b.calls[*call.To]; ok {
+		return f(call.Data)
+	}
+
+	var sel [4]byte
+	copy(sel[:], call.Data)
+
+	if ret, ok := b.contracts[*call.To][sel]; ok {
+		return ret, nil
+	}
+
+	return nil, testRevert(nil)
+}
+
+func testMethod(t *testing.T, contractABI, method string, ret ...interface{}) ([4]byte, []byte) {
+	parsed, err := abi.JSON(strings.NewReader(contractABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := parsed.Methods[method]
+	out, err := m.Outputs.Pack(ret...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sel [4]byte
+	copy(sel[:], m.ID)
+	return sel, out
+}
+
+func newTestEthereum(t *testing.T, contenthash []byte) *Ethereum {
+	registryAddr := common.HexToAddress(FirstNLabels(ethNS[0].Ns, 1))
+	resolverAddr := common.HexToAddress("0x4976fb03C32e5B8cfe2b6cCB31c09Ba78EBaBa41")
+
+	resolverSel, resolverRet := testMethod(t, ENSRegistryABI, "resolver", resolverAddr)
+	dnsSel, dnsRet := testMethod(t, DNSResolverABI, "dnsRecord", []byte{})
+	chSel, chRet := testMethod(t, ContentHashResolverABI, "contenthash", contenthash)
+
+	e := newEthereum(&testBackend{contracts: map[common.Address]map[[4]byte][]byte{
+		registryAddr: {resolverSel: resolverRet},
+		resolverAddr: {dnsSel: dnsRet, chSel: chRet},
+	}})
+	e.gateways, _ = NewContentGateways("http://127.0.0.1:8080", "", "")
+	return e
+}
+
+func TestEthereumContent(t *testing.T) {
+	contenthash, _ := hex.DecodeString("e3010170122029f2d17be6139079dc48696d1f582a8530eb9805b561eda517e22a892c7e3f1f")
+	e := newTestEthereum(t, contenthash)
+
+	if err := e.Health(context.Background()); err != nil {
+		t.Fatalf("got health err = %v, want nil", err)
+	}
+
+	stub := &resolver.Stub{DefaultResolver: resolver.DefaultResolver{
+		Query: func(ctx context.Context, name string, qtype uint16) *resolver.DNSResult {
+			t.Fatalf("unexpected stub query %s", name)
+			return nil
+		},
+	}}
+
+	h := NewHIP5Resolver(stub, "0.0.0.0", func() bool {
+		return true
+	})
+
+	reg := NewRegistry()
+	reg.Add(e)
+	h.SetExtensions(reg)
+
+	content, ok := h.LookupContent(context.Background(), "vitalik.eth")
+	if !ok {
+		t.Fatal("no content found for vitalik.eth")
+	}
+
+	want := "http://127.0.0.1:8080/ipfs/bafybeibj6lixxzqtsb45ysdjnupvqkufgdvzqbnvmhw2kf7cfkesy7r7d4"
+	if content.URL.String() != want {
+		t.Fatalf("got url = %s, want %s", content.URL, want)
+	}
+
+	// not supported by the gateways
+	arweave := append(binary.AppendUvarint(nil, codecArweave), make([]byte, 32)...)
+	e = newTestEthereum(t, arweave)
+	if _, err := e.Content(context.Background(), "vitalik.eth.", ethNS[0]); err == nil {
+		t.Fatal("got nil err for arweave content without a gateway")
+	}
+
+	// names without a contenthash resolve normally
+	e = newTestEthereum(t, nil)
+	reg.Add(e)
+	res := h.Resolve(context.Background(), "nocontent.eth.", dns.TypeA)
+	if res.Err != nil || res.Content != nil || res.Extension != "_eth" {
+		t.Fatalf("got result = %v, %v, %s, want no records or content from _eth", res.Content, res.Err, res.Extension)
+	}
+}
+
+func TestEthereumChains(t *testing.T) {
+	registryAddr := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	resolverAddr := common.HexToAddress("0x00000000000000000000000000000000000000dd")
+
+	a := testRR("example.eth. 300 IN A 127.0.0.1")
+	raw := make([]byte, 64)
+	n, err := dns.PackRR(a, raw, 0, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolverSel, resolverRet := testMethod(t, ENSRegistryABI, "resolver", resolverAddr)
+	dnsSel, dnsRet := testMethod(t, DNSResolverABI, "dnsRecord", raw[:n])
+
+	e := newTestEthereum(t, nil)
+	e.chains[8453] = newEthereum(&testBackend{contracts: map[common.Address]map[[4]byte][]byte{
+		registryAddr: {resolverSel: resolverRet},
+		resolverAddr: {dnsSel: dnsRet},
+	}})
+
+	ns := &dns.NS{Ns: registryAddr.Hex() + ".8453._eth."}
+	rrs, err := e.Handler(context.Background(), "example.eth.", dns.TypeA, ns)
+	if err != nil || len(rrs) != 1 || rrs[0].String() != a.String() {
+		t.Fatalf("got %v, %v, want %s", rrs, err, a)
+	}
+
+	// the registry isn't deployed on mainnet
+	ns = &dns.NS{Ns: registryAddr.Hex() + ".1._eth."}
+	if rrs, err = e.Handler(context.Background(), "example.eth.", dns.TypeA, ns); err == nil {
+		t.Fatalf("got %v, nil err, want mainnet call error", rrs)
+	}
+
+	for _, target := range []string{registryAddr.Hex() + ".10._eth.", registryAddr.Hex() + ".base._eth.", "a.b.c._eth."} {
+		if _, err = e.Handler(context.Background(), "example.eth.", dns.TypeA, &dns.NS{Ns: target}); err == nil {
+			t.Fatalf("got nil err for NS target %s", target)
+		}
+	}
+
+	if err = e.AddChain(mainnetChainID, []string{"http://127.0.0.1:1"}, 1); err == nil {
+		t.Fatal("got nil err adding mainnet as a chain")
+	}
+}
@@ -0,0 +1,146 @@
+package resolvers
+
+import (
+	"context"
+	"github.com/miekg/dns"
+)
+
+// Explanation how a name resolves step by step
+// used to diagnose names that don't work
+type Explanation struct {
+	Name string `json:"name"`
+	TLD  string `json:"tld"`
+
+	// RootNS enabled hip-5 NS records of
+	// the tld answered by the root
+	RootNS    []string `json:"rootNs"`
+	RootError string   `json:"rootError,omitempty"`
+
+	// Extension the hip-5 extension that
+	// answered the name if any
+	Extension string      `json:"extension,omitempty"`
+	Trace     []TraceStep `json:"trace"`
+	CNAMEs    []string    `json:"cnames,omitempty"`
+
+	Records []string `json:"records"`
+	Secure  bool     `json:"secure"`
+	Error   string   `json:"error,omitempty"`
+
+	// TLSA records of _443._tcp.<name>
+	TLSA       []string `json:"tlsa"`
+	TLSASecure bool     `json:"tlsaSecure"`
+	TLSAError  string   `json:"tlsaError,omitempty"`
+}
+
+// DANECheck whether the proxy would accept
+// the certificate served by a name
+type DANECheck struct {
+	Checked bool   `json:"checked"`
+	Passed  bool   `json:"passed"`
+	Detail  string `json:"detail"`
+}
+
+// LookupResult an explanation of a name and
+// the DANE check of its certificate
+type LookupResult struct {
+	*Explanation
+	DANE DANECheck `json:"dane"`
+}
+
+// Explain resolves the addresses and TLSA records
+// of name recording every step taken
+func (h *HIP5Resolver) Explain(ctx context.Context, name string) *Explanation {
+	name = dns.CanonicalName(dns.Fqdn(name))
+	x := &Explanation{Name: name, TLD: dns.Fqdn(LastNLabels(name, 1))}
+
+	if ns, err := h.lookupExtensions(ctx, x.TLD); err != nil {
+		x.RootError = err.Error()
+	} else {
+		for _, rr := range ns {
+			x.RootNS = append(x.RootNS, rr.String())
+		}
+	}
+
+	t := &queryTrace{}
+	tctx := withTrace(ctx, t)
+
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		res := h.queryInternal(tctx, name, qtype, 0)
+		if res.Err != nil {
+			x.Error = dns.TypeToString[qtype] + ": " + res.Err.Error()
+			continue
+		}
+
+		if res.Extension != "" {
+			x.Extension = res.Extension
+		}
+
+		if res.Content != nil {
+			traceStep(tctx, "content", nil, "served from %s", res.Content.URL)
+		}
+
+		x.Secure = res.Secure
+		for _, rr := range res.Records {
+			x.Records = append(x.Records, rr.String())
+		}
+	}
+
+	tlsa := h.queryInternal(tctx, "_443._tcp."+name, dns.TypeTLSA, 0)
+	if tlsa.Err != nil {
+		x.TLSAError = tlsa.Err.Error()
+	}
+
+	x.TLSASecure = tlsa.Secure
+	for _, rr := range tlsa.Records {
+		x.TLSA = append(x.TLSA, rr.String())
+	}
+
+	t.Lock()
+	x.Trace, x.CNAMEs = t.steps, t.cnames
+	t.Unlock()
+
+	return x
+}
+
+// Answer the result of a single query
+// with every step taken to resolve it
+type Answer struct {
+	Name      string      `json:"name"`
+	Type      string      `json:"type"`
+	Extension string      `json:"extension,omitempty"`
+	Trace     []TraceStep `json:"trace"`
+	CNAMEs    []string    `json:"cnames,omitempty"`
+	Records   []string    `json:"records"`
+	Secure    bool        `json:"secure"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// Trace resolves name recording every step taken
+func (h *HIP5Resolver) Trace(ctx context.Context, name string, qtype uint16) *Answer {
+	name = dns.CanonicalName(dns.Fqdn(name))
+	a := &Answer{Name: name, Type: dns.TypeToString[qtype]}
+
+	t := &queryTrace{}
+	tctx := withTrace(ctx, t)
+
+	res := h.queryInternal(tctx, name, qtype, 0)
+	if res.Err != nil {
+		a.Error = res.Err.Error()
+	}
+
+	if res.Content != nil {
+		traceStep(tctx, "content", nil, "served from %s", res.Content.URL)
+	}
+
+	a.Extension = res.Extension
+	a.Secure = res.Secure
+	for _, rr := range res.Records {
+		a.Records = append(a.Records, rr.String())
+	}
+
+	t.Lock()
+	a.Trace, a.CNAMEs = t.steps, t.cnames
+	t.Unlock()
+
+	return a
+}
@@ -0,0 +1,86 @@
+package resolvers
+
+import (
+	"context"
+	"github.com/miekg/dns"
+	"github.com/randomlogin/sane/resolver"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	stub := &resolver.Stub{DefaultResolver: resolver.DefaultResolver{
+		Query: func(ctx context.Context, name string, qtype uint16) *resolver.DNSResult {
+			return &resolver.DNSResult{Err: resolver.ErrServFail}
+		},
+	}}
+
+	h := NewHIP5Resolver(stub, "0.0.0.0", func() bool {
+		return true
+	})
+
+	h.exchangeRoot = testExchangeRootFunc(t, "forever.",
+		[]dns.RR{testRR("forever. 300 IN NS data._example.")})
+
+	h.RegisterHandler("_example", func(ctx context.Context, qname string, qtype uint16, ns *dns.NS) ([]dns.RR, error) {
+		switch qtype {
+		case dns.TypeA:
+			return []dns.RR{testRR(qname + " 300 IN A 127.0.0.1")}, nil
+		case dns.TypeTLSA:
+			return []dns.RR{testRR(qname + " 300 IN TLSA 3 1 1 0102")}, nil
+		}
+
+		return nil, nil
+	})
+
+	x := h.Explain(context.Background(), "Forever")
+	if x.Name != "forever." || x.TLD != "forever." || x.Extension != "_example" {
+		t.Fatalf("got name = %s, tld = %s, ext = %s, want forever. via _example", x.Name, x.TLD, x.Extension)
+	}
+
+	if len(x.RootNS) != 1 || x.RootError != "" {
+		t.Fatalf("got root ns = %v, err = %s, want 1 record", x.RootNS, x.RootError)
+	}
+
+	if len(x.Records) != 1 || len(x.TLSA) != 1 || x.Error != "" || x.TLSAError != "" {
+		t.Fatalf("got records = %v, tlsa = %v, want 1 A and 1 TLSA", x.Records, x.TLSA)
+	}
+
+	extensions := 0
+	for _, step := range x.Trace {
+		if step.Path == "extension" {
+			extensions++
+		}
+	}
+
+	if extensions != 3 {
+		t.Fatalf("got %d extension steps, want 3 in %v", extensions, x.Trace)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	stub := &resolver.Stub{DefaultResolver: resolver.DefaultResolver{
+		Query: func(ctx context.Context, name string, qtype uint16) *resolver.DNSResult {
+			return &resolver.DNSResult{Err: resolver.ErrServFail}
+		},
+	}}
+
+	h := NewHIP5Resolver(stub, "0.0.0.0", func() bool {
+		return true
+	})
+
+	h.exchangeRoot = testExchangeRootFunc(t, "forever.",
+		[]dns.RR{testRR("forever. 300 IN NS data._example.")})
+
+	h.RegisterHandler("_example", func(ctx context.Context, qname string, qtype uint16, ns *dns.NS) ([]dns.RR, error) {
+		return []dns.RR{testRR(qname + " 300 IN TXT \"hip5\"")}, nil
+	})
+
+	a := h.Trace(context.Background(), "Forever", dns.TypeTXT)
+	if a.Name != "forever." || a.Type != "TXT" || a.Extension != "_example" || a.Error != "" {
+		t.Fatalf("got name = %s, type = %s, ext = %s, err = %s, want forever. TXT via _example", a.Name, a.Type, a.Extension, a.Error)
+	}
+
+	if len(a.Records) != 1 || len(a.Trace) < 2 || a.Trace[0].Path != "stub" {
+		t.Fatalf("got records = %v, trace = %v, want 1 record after a stub step", a.Records, a.Trace)
+	}
+}
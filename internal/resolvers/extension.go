@@ -0,0 +1,306 @@
+package resolvers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/miekg/dns"
+	"github.com/randomlogin/sane/resolver"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Extension a HIP-5 extension answering names
+// delegated to NS records ending with its name
+type Extension interface {
+	// Name the extension label e.g. _eth
+	Name() string
+
+	// Handler resolves qname using the hip-5 NS record
+	Handler(ctx context.Context, qname string, qtype uint16, ns *dns.NS) ([]dns.RR, error)
+
+	// Health returns an error if the extension
+	// is currently unable to answer queries
+	Health(ctx context.Context) error
+
+	// CachePolicy bounds the TTLs of records
+	// returned by the handler
+	CachePolicy() CachePolicy
+}
+
+// CachePolicy TTL bounds applied to extension
+// answers zero values are ignored
+type CachePolicy struct {
+	MinTTL time.Duration
+	MaxTTL time.Duration
+}
+
+func (p CachePolicy) apply(rrs []dns.RR) []dns.RR {
+	if p.MinTTL == 0 && p.MaxTTL == 0 {
+		return rrs
+	}
+
+	out := make([]dns.RR, 0, len(rrs))
+	for _, rr := range rrs {
+		rr = dns.Copy(rr)
+		ttl := time.Duration(rr.Header().Ttl) * time.Second
+
+		if p.MinTTL != 0 && ttl < p.MinTTL {
+			ttl = p.MinTTL
+		}
+		if p.MaxTTL != 0 && ttl > p.MaxTTL {
+			ttl = p.MaxTTL
+		}
+
+		rr.Header().Ttl = uint32(ttl.Seconds())
+		out = append(out, rr)
+	}
+
+	return out
+}
+
+// VerifiedExtension an extension able to tell if its answers
+// were verified instead of trusted from a third party answers
+// of other extensions are trusted
+type VerifiedExtension interface {
+	Extension
+
+	// VerifiedHandler like Handler also reporting
+	// if the records were verified
+	VerifiedHandler(ctx context.Context, qname string, qtype uint16, ns *dns.NS) ([]dns.RR, bool, error)
+}
+
+// DiskCacheExtension an extension able to persist
+// its lookups in a disk cache
+type DiskCacheExtension interface {
+	Extension
+
+	SetDiskCache(d *DiskCache)
+}
+
+// CacheStatsExtension an extension reporting
+// counters of its caches by name
+type CacheStatsExtension interface {
+	Extension
+
+	CacheStats() map[string]CacheStats
+}
+
+// ErrNoContent returned by content extensions
+// if a name has no content
+var ErrNoContent = errors.New("no content")
+
+// ContentExtension an extension answering names
+// with content served by the proxy instead of records
+type ContentExtension interface {
+	Extension
+
+	// Content returns where the content for qname
+	// delegated to ns can be fetched from it's only
+	// used if Handler returns no records
+	Content(ctx context.Context, qname string, ns *dns.NS) (*Content, error)
+}
+
+// Content location of a content addressed site
+type Content struct {
+	// URL base url content is fetched from
+	// request paths are appended to it
+	URL *url.URL
+}
+
+// DNSResult a query result annotated with
+// the hip-5 extension that served the name
+type DNSResult struct {
+	resolver.DNSResult
+	Extension string
+
+	// Content set if the name is served
+	// by a content extension
+	Content *Content
+}
+
+// ExtensionFactory creates an extension reading
+// any user settings it needs with setting
+type ExtensionFactory func(setting func(key string) string) (Extension, error)
+
+var extensionFactories = make(map[string]ExtensionFactory)
+
+// RegisterExtension makes an extension available to
+// LoadRegistry it should be called from init
+func RegisterExtension(name string, factory ExtensionFactory) {
+	if _, ok := extensionFactories[name]; ok {
+		panic("resolvers: extension " + name + " registered twice")
+	}
+
+	extensionFactories[name] = factory
+}
+
+// AvailableExtensions returns the names
+// of all registered extensions
+func AvailableExtensions() []string {
+	var names []string
+	for name := range extensionFactories {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Registry extensions used by HIP5Resolver
+type Registry struct {
+	extensions map[string]Extension
+	disabled   map[string]struct{}
+
+	sync.RWMutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		extensions: make(map[string]Extension),
+		disabled:   make(map[string]struct{}),
+	}
+}
+
+// LoadRegistry creates a registry with the
+// specified extensions enabled
+func LoadRegistry(enabled []string, setting func(key string) string) (*Registry, error) {
+	r := NewRegistry()
+
+	for _, name := range enabled {
+		factory, ok := extensionFactories[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown hip-5 extension %s", name)
+		}
+
+		ext, err := factory(setting)
+		if err != nil {
+			return nil, fmt.Errorf("failed loading hip-5 extension %s: %v", name, err)
+		}
+
+		r.Add(ext)
+	}
+
+	return r, nil
+}
+
+// Add adds an enabled extension replacing
+// any extension with the same name
+func (r *Registry) Add(ext Extension) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.extensions[ext.Name()] = ext
+	delete(r.disabled, ext.Name())
+}
+
+func (r *Registry) SetEnabled(name string, enabled bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	if enabled {
+		delete(r.disabled, name)
+		return
+	}
+
+	r.disabled[name] = struct{}{}
+}
+
+// Get returns the extension if it's enabled
+func (r *Registry) Get(name string) (Extension, bool) {
+	r.RLock()
+	defer r.RUnlock()
+
+	if _, ok := r.disabled[name]; ok {
+		return nil, false
+	}
+
+	ext, ok := r.extensions[name]
+	return ext, ok
+}
+
+// Enabled returns the names of enabled extensions
+func (r *Registry) Enabled() []string {
+	r.RLock()
+	defer r.RUnlock()
+
+	var names []string
+	for name := range r.extensions {
+		if _, ok := r.disabled[name]; !ok {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// SetDiskCache passes d to all extensions able
+// to persist their lookups
+func (r *Registry) SetDiskCache(d *DiskCache) {
+	r.RLock()
+	defer r.RUnlock()
+
+	for _, ext := range r.extensions {
+		if c, ok := ext.(DiskCacheExtension); ok {
+			c.SetDiskCache(d)
+		}
+	}
+}
+
+// CacheStats returns counters of extension caches
+// prefixed with the extension name e.g. _eth.resolver
+func (r *Registry) CacheStats() map[string]CacheStats {
+	stats := make(map[string]CacheStats)
+	for _, name := range r.Enabled() {
+		ext, ok := r.Get(name)
+		if !ok {
+			continue
+		}
+
+		if c, ok := ext.(CacheStatsExtension); ok {
+			for cacheName, s := range c.CacheStats() {
+				stats[name+"."+cacheName] = s
+			}
+		}
+	}
+
+	return stats
+}
+
+// Health checks all enabled extensions
+func (r *Registry) Health(ctx context.Context) map[string]error {
+	res := make(map[string]error)
+	for _, name := range r.Enabled() {
+		if ext, ok := r.Get(name); ok {
+			res[name] = ext.Health(ctx)
+		}
+	}
+
+	return res
+}
+
+// handlerExtension adapts a bare handler
+// func used by RegisterHandler
+type handlerExtension struct {
+	name    string
+	handler hip5Handler
+}
+
+func (e *handlerExtension) Name() string {
+	return e.name
+}
+
+func (e *handlerExtension) Handler(ctx context.Context, qname string, qtype uint16, ns *dns.NS) ([]dns.RR, error) {
+	return e.handler(ctx, qname, qtype, ns)
+}
+
+func (e *handlerExtension) Health(ctx context.Context) error {
+	return nil
+}
+
+func (e *handlerExtension) CachePolicy() CachePolicy {
+	return CachePolicy{}
+}
@@ -0,0 +1,144 @@
+package resolvers
+
+import (
+	"context"
+	"errors"
+	"github.com/miekg/dns"
+	"github.com/randomlogin/sane/resolver"
+	"testing"
+	"time"
+)
+
+type testExtension struct {
+	name    string
+	policy  CachePolicy
+	records map[string][]dns.RR
+}
+
+func (e *testExtension) Name() string {
+	return e.name
+}
+
+func (e *testExtension) Handler(ctx context.Context, qname string, qtype uint16, ns *dns.NS) ([]dns.RR, error) {
+	if rrs, ok := e.records[qname]; ok {
+		return rrs, nil
+	}
+
+	return nil, errors.New("not found")
+}
+
+func (e *testExtension) Health(ctx context.Context) error {
+	return nil
+}
+
+func (e *testExtension) CachePolicy() CachePolicy {
+	return e.policy
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	r.Add(&testExtension{name: "_b"})
+	r.Add(&testExtension{name: "_a"})
+
+	if got := r.Enabled(); len(got) != 2 || got[0] != "_a" || got[1] != "_b" {
+		t.Fatalf("got enabled = %v, want [_a _b]", got)
+	}
+
+	r.SetEnabled("_a", false)
+	if _, ok := r.Get("_a"); ok {
+		t.Fatal("got disabled extension _a")
+	}
+	if got := r.Enabled(); len(got) != 1 || got[0] != "_b" {
+		t.Fatalf("got enabled = %v, want [_b]", got)
+	}
+
+	r.SetEnabled("_a", true)
+	if _, ok := r.Get("_a"); !ok {
+		t.Fatal("extension _a not found")
+	}
+
+	if _, err := LoadRegistry([]string{"_unknown"}, func(string) string { return "" }); err == nil {
+		t.Fatal("got nil err for unknown extension")
+	}
+}
+
+func TestCachePolicy(t *testing.T) {
+	rrs := []dns.RR{
+		testRR("a.forever. 10 IN A 127.0.0.1"),
+		testRR("a.forever. 300 IN A 127.0.0.2"),
+		testRR("a.forever. 90000 IN A 127.0.0.3"),
+	}
+
+	p := CachePolicy{MinTTL: time.Minute, MaxTTL: time.Hour}
+	got := p.apply(rrs)
+	want := []uint32{60, 300, 3600}
+
+	for i, rr := range got {
+		if rr.Header().Ttl != want[i] {
+			t.Fatalf("got ttl = %d, want %d", rr.Header().Ttl, want[i])
+		}
+	}
+
+	if rrs[0].Header().Ttl != 10 {
+		t.Fatalf("got original ttl = %d, want 10", rrs[0].Header().Ttl)
+	}
+}
+
+func TestHIP5Extensions(t *testing.T) {
+	stub := &resolver.Stub{DefaultResolver: resolver.DefaultResolver{
+		Query: func(ctx context.Context, name string, qtype uint16) *resolver.DNSResult {
+			return &resolver.DNSResult{Err: resolver.ErrServFail}
+		},
+	}}
+
+	h := NewHIP5Resolver(stub, "0.0.0.0", func() bool {
+		return true
+	})
+
+	h.exchangeRoot = testExchangeRootFunc(t, "forever.", []dns.RR{
+		testRR("forever. 300 IN NS ns._first."),
+		testRR("forever. 300 IN NS ns._second."),
+	})
+
+	first := &testExtension{name: "_first", records: map[string][]dns.RR{
+		"a.forever.": {testRR("a.forever. 300 IN A 127.0.0.1")},
+	}}
+	second := &testExtension{name: "_second", policy: CachePolicy{MaxTTL: time.Minute}, records: map[string][]dns.RR{
+		"a.forever.": {testRR("a.forever. 300 IN A 127.0.0.2")},
+	}}
+
+	reg := NewRegistry()
+	reg.Add(first)
+	reg.Add(second)
+	h.SetExtensions(reg)
+
+	res := h.Resolve(context.Background(), "a.forever.", dns.TypeA)
+	if res.Err != nil {
+		t.Fatalf("got err = %v, want nil", res.Err)
+	}
+	if res.Extension != "_first" {
+		t.Fatalf("got extension = %s, want _first", res.Extension)
+	}
+
+	// disabled extensions are skipped
+	reg.SetEnabled("_first", false)
+	res = h.Resolve(context.Background(), "a.forever.", dns.TypeA)
+	if res.Err != nil {
+		t.Fatalf("got err = %v, want nil", res.Err)
+	}
+	if res.Extension != "_second" {
+		t.Fatalf("got extension = %s, want _second", res.Extension)
+	}
+	if len(res.Records) != 1 || res.Records[0].Header().Ttl != 60 {
+		t.Fatalf("got records = %v, want a single record with ttl 60", res.Records)
+	}
+
+	reg.SetEnabled("_second", false)
+	res = h.Resolve(context.Background(), "a.forever.", dns.TypeA)
+	if !errors.Is(res.Err, resolver.ErrServFail) {
+		t.Fatalf("got err = %v, want %v", res.Err, resolver.ErrServFail)
+	}
+	if res.Extension != "" {
+		t.Fatalf("got extension = %s, want none", res.Extension)
+	}
+}
@@ -0,0 +1,93 @@
+package resolvers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/miekg/dns"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ExchangeFunc sends a query to a resolver and returns its reply
+type ExchangeFunc func(ctx context.Context, m *dns.Msg) (*dns.Msg, error)
+
+// NewForwarder exchanges queries with the recursive resolver
+// at addr a host:port, udp:// or tcp:// address or a
+// DNS-over-HTTPS url
+func NewForwarder(addr string) (ExchangeFunc, error) {
+	network := "udp"
+	if strings.Contains(addr, "://") {
+		u, err := url.Parse(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		switch u.Scheme {
+		case "https", "http":
+			return newDoHForwarder(u), nil
+		case "udp", "tcp":
+			network, addr = u.Scheme, u.Host
+		default:
+			return nil, fmt.Errorf("unsupported scheme %s", u.Scheme)
+		}
+	}
+
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "53")
+	}
+
+	client := &dns.Client{Net: network, Timeout: 4 * time.Second}
+	tcp := &dns.Client{Net: "tcp", Timeout: 4 * time.Second}
+
+	return func(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+		r, _, err := client.ExchangeContext(ctx, m, addr)
+		if err == nil && r.Truncated && network == "udp" {
+			r, _, err = tcp.ExchangeContext(ctx, m, addr)
+		}
+		return r, err
+	}, nil
+}
+
+func newDoHForwarder(u *url.URL) ExchangeFunc {
+	endpoint := *u
+	if endpoint.Path == "" || endpoint.Path == "/" {
+		endpoint.Path = "/dns-query"
+	}
+
+	return func(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+		buf, err := m.Pack()
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.String(), bytes.NewReader(buf))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", dohMediaType)
+		req.Header.Set("Accept", dohMediaType)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("doh: got status %s", resp.Status)
+		}
+
+		b, err := io.ReadAll(io.LimitReader(resp.Body, dns.MaxMsgSize))
+		if err != nil {
+			return nil, err
+		}
+
+		r := new(dns.Msg)
+		return r, r.Unpack(b)
+	}
+}
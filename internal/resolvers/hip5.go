@@ -21,7 +21,7 @@ type hip5Handler func(ctx context.Context, qname string, qtype uint16, ns *dns.N
 type QueryMiddlewareFunc func(qname string, qtype uint16) (bool, *resolver.DNSResult)
 
 type HIP5Resolver struct {
-	handlers      map[string]hip5Handler
+	extensions    *Registry
 	onBeforeQuery QueryMiddlewareFunc
 
 	// for sending queries to a trusted root
@@ -31,6 +31,17 @@ type HIP5Resolver struct {
 	syncCheck  func() bool
 	tldCache   *cache
 	keyCache   *cache
+	// content lookups by the proxy
+	contentCache *cache
+	// whether a tld has a content extension
+	contentTLDs *cache
+	// persists tld and key lookups across restarts
+	disk *DiskCache
+	// records queries with their trace if set
+	queryLog *QueryLog
+
+	// metricsNames label mode of names in metrics
+	metricsNames string
 
 	// stub resolver with no hip-5 support
 	stubQuery func(ctx context.Context, name string, qtype uint16) *resolver.DNSResult
@@ -48,9 +59,11 @@ func NewHIP5Resolver(stub *resolver.Stub, rootAddr string, syncCheck func() bool
 	h := &HIP5Resolver{}
 	h.Stub = stub
 	h.syncCheck = syncCheck
-	h.handlers = make(map[string]hip5Handler)
+	h.extensions = NewRegistry()
 	h.tldCache = newCache(30)
 	h.keyCache = newCache(200)
+	h.contentCache = newCache(500)
+	h.contentTLDs = newCache(500)
 
 	// using the same query function used by stub
 	// to benefit from caching
@@ -76,43 +89,171 @@ func NewHIP5Resolver(stub *resolver.Stub, rootAddr string, syncCheck func() bool
 }
 
 func (h *HIP5Resolver) RegisterHandler(extension string, handler hip5Handler) {
-	h.handlers[extension] = handler
+	h.extensions.Add(&handlerExtension{name: extension, handler: handler})
+}
+
+// SetExtensions replaces the hip-5 extensions
+// used by the resolver
+func (h *HIP5Resolver) SetExtensions(r *Registry) {
+	h.extensions = r
+}
+
+// SetDiskCache persists hip-5 tld and
+// DNSKEY lookups in d
+func (h *HIP5Resolver) SetDiskCache(d *DiskCache) {
+	h.disk = d
+}
+
+// CacheStats returns counters of the resolver
+// caches and those of its extensions
+func (h *HIP5Resolver) CacheStats() map[string]CacheStats {
+	stats := map[string]CacheStats{
+		"tld":         h.tldCache.stats(),
+		"dnskey":      h.keyCache.stats(),
+		"content":     h.contentCache.stats(),
+		"content_tld": h.contentTLDs.stats(),
+	}
+
+	for name, s := range h.extensions.CacheStats() {
+		stats[name] = s
+	}
+
+	return stats
+}
+
+func (h *HIP5Resolver) Extensions() *Registry {
+	return h.extensions
 }
 
 func (h *HIP5Resolver) SetQueryMiddleware(m QueryMiddlewareFunc) {
 	h.onBeforeQuery = m
 }
 
+// SetQueryLog records every query and
+// the path taken to resolve it in l
+func (h *HIP5Resolver) SetQueryLog(l *QueryLog) {
+	h.queryLog = l
+}
+
+// SetMetricsNames sets how queried names are labeled
+// in metrics omitted by default
+func (h *HIP5Resolver) SetMetricsNames(mode string) {
+	h.metricsNames = mode
+}
+
+func (h *HIP5Resolver) observe(name string, start time.Time, res *DNSResult) {
+	path := queryPath(res.Extension)
+	queriesTotal.Inc(path, queryResult(res))
+	queryDuration.Observe(time.Since(start).Seconds(), path)
+
+	if label := metricsName(h.metricsNames, name); label != "" {
+		namesTotal.Inc(label)
+	}
+}
+
 func (h *HIP5Resolver) query(ctx context.Context, name string, qtype uint16) *resolver.DNSResult {
+	return &h.Resolve(ctx, name, qtype).DNSResult
+}
+
+// Resolve looks up name similar to Query
+// reporting the hip-5 extension used if any
+func (h *HIP5Resolver) Resolve(ctx context.Context, name string, qtype uint16) *DNSResult {
 	if h.onBeforeQuery != nil {
 		if ok, res := h.onBeforeQuery(name, qtype); ok {
-			return res
+			return &DNSResult{DNSResult: *res}
 		}
 	}
 
-	return h.queryInternal(ctx, name, qtype, 0)
+	if h.queryLog == nil {
+		start := time.Now()
+		res := h.queryInternal(ctx, name, qtype, 0)
+		h.observe(name, start, res)
+		return res
+	}
+
+	// lookups made while resolving another
+	// name are part of its trace
+	if traceFrom(ctx) != nil {
+		start := time.Now()
+		res := h.queryInternal(ctx, name, qtype, 0)
+		h.observe(name, start, res)
+		traceStep(ctx, "lookup", res.Err, "%s %s", name, dns.TypeToString[qtype])
+		return res
+	}
+
+	t := &queryTrace{}
+	start := time.Now()
+	res := h.queryInternal(withTrace(ctx, t), name, qtype, 0)
+	h.observe(name, start, res)
+
+	r := QueryRecord{
+		Time:      start,
+		Name:      dns.CanonicalName(name),
+		Type:      dns.TypeToString[qtype],
+		Extension: res.Extension,
+		Secure:    res.Secure,
+		Records:   len(res.Records),
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+
+	if res.Err != nil {
+		r.Error = res.Err.Error()
+	}
+
+	t.Lock()
+	r.Trace, r.CNAMEs = t.steps, t.cnames
+	t.Unlock()
+
+	h.queryLog.Add(r)
+	return res
 }
 
 func (h *HIP5Resolver) checkTLDCache(tld string) ([]*dns.NS, bool) {
-	e, ok := h.tldCache.get(tld)
+	if e, ok := h.tldCache.get(tld); ok {
+		return h.filterEnabled(e.msg.([]*dns.NS)), true
+	}
+
+	d, ok := h.disk.Get("tld;" + tld)
 	if !ok {
 		return nil, false
 	}
 
-	if time.Now().After(e.ttl) {
-		h.tldCache.remove(tld)
-		return nil, false
+	var rrs []*dns.NS
+	for _, rr := range d.RRs {
+		if ns, ok := rr.(*dns.NS); ok {
+			rrs = append(rrs, ns)
+		}
 	}
 
-	return e.msg.([]*dns.NS), true
+	h.tldCache.set(tld, &entry{
+		msg: rrs,
+		ttl: d.Expires,
+	})
+
+	return h.filterEnabled(rrs), true
 }
 
-func (h *HIP5Resolver) queryInternal(ctx context.Context, name string, qtype uint16, depth int) *resolver.DNSResult {
+// filterEnabled returns NS records
+// using an enabled extension
+func (h *HIP5Resolver) filterEnabled(rrs []*dns.NS) []*dns.NS {
+	var enabled []*dns.NS
+	for _, rr := range rrs {
+		if _, ok := h.extensions.Get(LastNLabels(rr.Ns, 1)); ok {
+			enabled = append(enabled, rr)
+		}
+	}
+
+	return enabled
+}
+
+func (h *HIP5Resolver) queryInternal(ctx context.Context, name string, qtype uint16, depth int) *DNSResult {
 	if synced := h.syncCheck(); !synced {
-		return &resolver.DNSResult{
-			Records: nil,
-			Secure:  false,
-			Err:     errNotSynced,
+		return &DNSResult{
+			DNSResult: resolver.DNSResult{
+				Records: nil,
+				Secure:  false,
+				Err:     errNotSynced,
+			},
 		}
 	}
 
@@ -122,7 +263,7 @@ func (h *HIP5Resolver) queryInternal(ctx context.Context, name string, qtype uin
 
 	known := false
 	if tld == "eth." {
-		known = true
+		known = len(h.filterEnabled(ethNS)) > 0
 	} else {
 		rrs, ok := h.checkTLDCache(tld)
 		known = ok && len(rrs) > 0
@@ -130,61 +271,76 @@ func (h *HIP5Resolver) queryInternal(ctx context.Context, name string, qtype uin
 
 	if !known {
 		res = h.stubQuery(ctx, name, qtype)
+		traceStep(ctx, "stub", res.Err, "%s secure=%v", name, res.Secure)
 		if res.Err == nil || !errors.Is(res.Err, resolver.ErrServFail) {
-			return res
+			return &DNSResult{DNSResult: *res}
 		}
 	}
 
 	// Either its a known HIP-5 tld
 	// or stub couldn't resolve it
-	rrs, secure, errHip5 := h.attemptHIP5Resolution(ctx, tld, name, qtype, depth)
+	hip5Res, errHip5 := h.attemptHIP5Resolution(ctx, tld, name, qtype, depth)
 	if errHip5 == nil {
-		return &resolver.DNSResult{
-			Records: rrs,
-			Secure:  secure,
-			Err:     nil,
-		}
+		return hip5Res
 	}
 
 	// return the original failed response
 	// from the stub unmodified
 	if res != nil && errHip5 == errHIP5NotSupported {
-		return res
+		return &DNSResult{DNSResult: *res}
+	}
+
+	var ext string
+	if hip5Res != nil {
+		ext = hip5Res.Extension
 	}
 
 	// name uses a hip5 ns but failed to resolve
-	return &resolver.DNSResult{
-		Records: nil,
-		Secure:  false,
-		Err:     errHip5,
+	return &DNSResult{
+		DNSResult: resolver.DNSResult{
+			Records: nil,
+			Secure:  false,
+			Err:     errHip5,
+		},
+		Extension: ext,
 	}
 }
 
-func (h *HIP5Resolver) attemptHIP5Resolution(ctx context.Context, tld, qname string, qtype uint16, depth int) ([]dns.RR, bool, error) {
+// attemptHIP5Resolution returns a non nil result on errors
+// if an extension was used to resolve qname
+func (h *HIP5Resolver) attemptHIP5Resolution(ctx context.Context, tld, qname string, qtype uint16, depth int) (*DNSResult, error) {
 	if tld == "." {
-		return nil, false, fmt.Errorf("no hip-5 records in root zone apex")
+		return nil, fmt.Errorf("no hip-5 records in root zone apex")
 	}
 
 	hip5Res, err := h.lookupExtensions(ctx, tld)
 	if err != nil {
-		return nil, false, fmt.Errorf("checking for hip-5 records failed: %w", err)
+		return nil, fmt.Errorf("checking for hip-5 records failed: %w", err)
 	}
 
 	if len(hip5Res) > 0 {
-		rrs, err := h.runHandlers(ctx, hip5Res, qname, qtype)
+		res, err := h.runHandlers(ctx, hip5Res, qname, qtype)
 		if err != nil {
-			return nil, false, fmt.Errorf("hip-5 resolution failed: %w", err)
+			return res, fmt.Errorf("hip-5 resolution failed: %w", err)
 		}
 
-		secure := true
-		if rrs, secure, err = h.flatten(ctx, rrs, nil, true, qname, qtype, depth); err != nil {
-			return nil, false, err
+		// content has no records to flatten
+		if res.Content != nil {
+			return res, nil
 		}
 
-		return filterType(rrs, qtype), secure, nil
+		rrs, secure, err := h.flatten(ctx, res.Records, nil, res.Secure, qname, qtype, depth)
+		if err != nil {
+			res.Records = nil
+			return res, err
+		}
+
+		res.Records = filterType(rrs, qtype)
+		res.Secure = secure
+		return res, nil
 	}
 
-	return nil, false, errHIP5NotSupported
+	return nil, errHIP5NotSupported
 }
 
 func filterType(rrs []dns.RR, qtype uint16) []dns.RR {
@@ -248,6 +404,8 @@ func (h *HIP5Resolver) resolveCNAME(ctx context.Context, rrs []*dns.CNAME, qname
 			return nil, false, errBadCNAMETarget
 		}
 
+		traceCNAME(ctx, target)
+
 		res := h.queryInternal(ctx, rr.Target, qtype, depth+1)
 		if res.Err != nil {
 			lastErr = res.Err
@@ -342,14 +500,19 @@ func (h *HIP5Resolver) resolveNS(ctx context.Context, rrs []*dns.NS, ds []dns.RR
 	}
 
 	if msg == nil {
-		return nil, false, fmt.Errorf("failed to read message")
+		err = fmt.Errorf("failed to read message")
+		traceStep(ctx, "delegation", err, "%s", delegatedName)
+		return nil, false, err
 	}
 
 	var keys map[uint16]*dns.DNSKEY
 
 	if len(ds) > 0 {
 		if keys, err = h.queryDNSKeys(ctx, nsIPs, ds, delegatedName); err != nil {
-			return nil, false, fmt.Errorf("dnskey error: %v", err)
+			err = fmt.Errorf("dnskey error: %v", err)
+			traceStep(ctx, "delegation", err, "%s dnssec=bogus", delegatedName)
+			dnssecTotal.Inc("hip5", "bogus")
+			return nil, false, err
 		}
 	}
 
@@ -358,10 +521,22 @@ func (h *HIP5Resolver) resolveNS(ctx context.Context, rrs []*dns.NS, ds []dns.RR
 
 	if signed {
 		if secure, err = dnssec.Verify(msg, delegatedName, qname, qtype, keys, time.Now(), 2048); err != nil {
-			return nil, false, fmt.Errorf("dnssec verify error: %v", err)
+			err = fmt.Errorf("dnssec verify error: %v", err)
+			traceStep(ctx, "delegation", err, "%s dnssec=bogus", delegatedName)
+			dnssecTotal.Inc("hip5", "bogus")
+			return nil, false, err
 		}
 	}
 
+	dnssecState := "unsigned"
+	if signed && secure {
+		dnssecState = "secure"
+	} else if signed {
+		dnssecState = "insecure"
+	}
+	traceStep(ctx, "delegation", nil, "%s servers=%v dnssec=%s", delegatedName, nsIPs, dnssecState)
+	dnssecTotal.Inc("hip5", dnssecState)
+
 	// limit recursion depth
 	depth++
 
@@ -374,25 +549,53 @@ func (h *HIP5Resolver) resolveNS(ctx context.Context, rrs []*dns.NS, ds []dns.RR
 
 func (h *HIP5Resolver) queryDNSKeys(ctx context.Context, ips []net.IP, ds []dns.RR, delegatedName string) (map[uint16]*dns.DNSKEY, error) {
 	if entry, ok := h.keyCache.get(delegatedName); ok {
-		if time.Now().Before(entry.ttl) {
-			msg := new(dns.Msg)
-			msg.Rcode = dns.RcodeSuccess
-			msg.Answer = entry.msg.([]dns.RR)
+		msg := new(dns.Msg)
+		msg.Rcode = dns.RcodeSuccess
+		msg.Answer = entry.msg.([]dns.RR)
 
-			keys, err := dnssec.VerifyDNSKeys(delegatedName, msg, ds, time.Now(), 2048)
-			if err == nil {
-				return keys, nil
-			}
+		keys, err := dnssec.VerifyDNSKeys(delegatedName, msg, ds, time.Now(), 2048)
+		if err == nil {
+			return keys, nil
 		}
 		h.keyCache.remove(delegatedName)
 	}
 
+	// keys from disk are verified
+	// again against the DS set
+	if d, ok := h.disk.Get("key;" + delegatedName); ok {
+		msg := new(dns.Msg)
+		msg.Rcode = dns.RcodeSuccess
+		msg.Answer = d.RRs
+
+		keys, err := dnssec.VerifyDNSKeys(delegatedName, msg, ds, time.Now(), 2048)
+		if err == nil && len(keys) > 0 {
+			h.keyCache.set(delegatedName, &entry{
+				msg: msg.Answer,
+				ttl: d.Expires,
+			})
+			return keys, nil
+		}
+	}
+
 	msg, err := h.exchangeNS(ctx, ips, delegatedName, dns.TypeDNSKEY)
 	if err != nil {
+		// serve stale keys while the nameservers are
+		// unreachable signatures must still be valid
+		if stale, ok := h.keyCache.getStale(delegatedName); ok {
+			msg = new(dns.Msg)
+			msg.Rcode = dns.RcodeSuccess
+			msg.Answer = stale.msg.([]dns.RR)
+
+			if keys, staleErr := dnssec.VerifyDNSKeys(delegatedName, msg, ds, time.Now(), 2048); staleErr == nil && len(keys) > 0 {
+				return keys, nil
+			}
+		}
+
 		return nil, err
 	}
 
 	keys, err := dnssec.VerifyDNSKeys(delegatedName, msg, ds, time.Now(), 2048)
+	traceStep(ctx, "dnskey", err, "%s ds=%v keys=%v", delegatedName, dsKeyTags(ds), keyTags(keys))
 	if err != nil {
 		return nil, err
 	}
@@ -400,10 +603,12 @@ func (h *HIP5Resolver) queryDNSKeys(ctx context.Context, ips []net.IP, ds []dns.
 		return nil, nil
 	}
 
+	ttl := getTTL(msg.Answer)
 	h.keyCache.set(delegatedName, &entry{
 		msg: msg.Answer,
-		ttl: time.Now().Add(getTTL(msg.Answer)),
+		ttl: time.Now().Add(ttl),
 	})
+	h.disk.Set("key;"+delegatedName, &DiskEntry{RRs: msg.Answer, Secure: true}, ttl)
 
 	return keys, nil
 }
@@ -431,22 +636,127 @@ func (h *HIP5Resolver) exchangeNS(ctx context.Context, ips []net.IP, qname strin
 	return
 }
 
-func (h *HIP5Resolver) runHandlers(ctx context.Context, extensions []*dns.NS, qname string, qtype uint16) ([]dns.RR, error) {
+// runHandlers returns the answer from the first
+// extension able to resolve qname content extensions
+// are asked for content if they have no records
+func (h *HIP5Resolver) runHandlers(ctx context.Context, extensions []*dns.NS, qname string, qtype uint16) (*DNSResult, error) {
 	var lastErr error
-	var res []dns.RR
+	var lastExt string
 
 	for _, rr := range extensions {
 		tld := LastNLabels(rr.Ns, 1)
-		if handler, ok := h.handlers[tld]; ok {
-			res, lastErr = handler(ctx, qname, qtype, rr)
+		ext, ok := h.extensions.Get(tld)
+		if !ok {
+			continue
+		}
+
+		lastExt = tld
+
+		var rrs []dns.RR
+		verified := true
+		if v, ok := ext.(VerifiedExtension); ok {
+			rrs, verified, lastErr = v.VerifiedHandler(ctx, qname, qtype, rr)
+		} else {
+			rrs, lastErr = ext.Handler(ctx, qname, qtype, rr)
+		}
+
+		traceStep(ctx, "extension", lastErr, "%s via %s verified=%v", tld, rr.Ns, verified)
+
+		if lastErr != nil {
+			continue
+		}
+
+		if c, ok := ext.(ContentExtension); ok && len(rrs) == 0 {
+			content, err := c.Content(ctx, qname, rr)
+			if err == nil {
+				return &DNSResult{Extension: tld, Content: content}, nil
+			}
 
-			if lastErr == nil {
-				return res, nil
+			if !errors.Is(err, ErrNoContent) {
+				lastErr = err
+				continue
 			}
 		}
+
+		return &DNSResult{
+			DNSResult: resolver.DNSResult{Records: ext.CachePolicy().apply(rrs), Secure: verified},
+			Extension: tld,
+		}, nil
 	}
 
-	return nil, lastErr
+	return &DNSResult{Extension: lastExt}, lastErr
+}
+
+// LookupContent returns the content a hip-5 content
+// extension serves for host if any
+func (h *HIP5Resolver) LookupContent(ctx context.Context, host string) (*Content, bool) {
+	name := dns.CanonicalName(dns.Fqdn(host))
+	if !h.hasContentExtension(ctx, dns.Fqdn(LastNLabels(name, 1))) {
+		return nil, false
+	}
+
+	if e, ok := h.contentCache.get(name); ok {
+		content := e.msg.(*Content)
+		return content, content != nil
+	}
+
+	res := h.Resolve(ctx, name, dns.TypeA)
+	if res.Err != nil {
+		if e, ok := h.contentCache.getStale(name); ok {
+			content := e.msg.(*Content)
+			return content, content != nil
+		}
+
+		return nil, false
+	}
+
+	// cache names without content as well since
+	// it's checked for every proxied request
+	h.contentCache.set(name, &entry{
+		msg: res.Content,
+		ttl: time.Now().Add(time.Minute),
+	})
+
+	if res.Content == nil {
+		return nil, false
+	}
+
+	return res.Content, true
+}
+
+// hasContentExtension whether an enabled content extension
+// serves names of tld so other names proxied don't need
+// a full lookup
+func (h *HIP5Resolver) hasContentExtension(ctx context.Context, tld string) bool {
+	if e, ok := h.contentTLDs.get(tld); ok {
+		return e.msg.(bool)
+	}
+
+	extensions, err := h.lookupExtensions(ctx, tld)
+	if err != nil {
+		return false
+	}
+
+	found := false
+	for _, rr := range extensions {
+		ext, ok := h.extensions.Get(LastNLabels(rr.Ns, 1))
+		if _, content := ext.(ContentExtension); ok && content {
+			found = true
+			break
+		}
+	}
+
+	ttl := time.Minute
+	if len(extensions) > 0 {
+		ttl = getTTL(nsToRR(extensions))
+	}
+
+	h.contentTLDs.set(tld, &entry{
+		msg: found,
+		ttl: time.Now().Add(ttl),
+	})
+
+	return found
 }
 
 func (h *HIP5Resolver) lookupExtensions(ctx context.Context, tld string) ([]*dns.NS, error) {
@@ -455,13 +765,38 @@ func (h *HIP5Resolver) lookupExtensions(ctx context.Context, tld string) ([]*dns
 	}
 
 	if tld == "eth." {
-		return ethNS, nil
+		return h.filterEnabled(ethNS), nil
 	}
 
 	if rrs, ok := h.checkTLDCache(tld); ok {
+		if h.tldCache.prefetch(tld) {
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), prefetchTimeout)
+				defer cancel()
+
+				h.fetchExtensions(ctx, tld)
+			}()
+		}
+
 		return rrs, nil
 	}
 
+	answer, err := h.fetchExtensions(ctx, tld)
+	if err != nil {
+		// serve stale while the root is failing
+		if e, ok := h.tldCache.getStale(tld); ok {
+			return h.filterEnabled(e.msg.([]*dns.NS)), nil
+		}
+
+		return nil, err
+	}
+
+	return h.filterEnabled(answer), nil
+}
+
+// fetchExtensions asks the root for hip-5
+// NS records of tld caching positive answers
+func (h *HIP5Resolver) fetchExtensions(ctx context.Context, tld string) ([]*dns.NS, error) {
 	m := new(dns.Msg)
 	m.SetQuestion(tld, dns.TypeNS)
 	m.RecursionDesired = false
@@ -486,8 +821,9 @@ func (h *HIP5Resolver) lookupExtensions(ctx context.Context, tld string) ([]*dns
 		if ns, ok := rr.(*dns.NS); ok {
 			ending := LastNLabels(ns.Ns, 1)
 
-			// include supported HIP-5 extensions only
-			if _, ok := h.handlers[ending]; ok {
+			// include HIP-5 extensions only
+			// filtered by the enabled set on read
+			if strings.HasPrefix(ending, "_") {
 				answer = append(answer, ns)
 			}
 		}
@@ -500,6 +836,7 @@ func (h *HIP5Resolver) lookupExtensions(ctx context.Context, tld string) ([]*dns
 			msg: answer,
 			ttl: time.Now().Add(ttl),
 		})
+		h.disk.Set("tld;"+tld, &DiskEntry{RRs: nsToRR(answer)}, ttl)
 	}
 
 	return answer, nil
@@ -0,0 +1,160 @@
+package resolvers
+
+import (
+	"context"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/miekg/dns"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// empty identity cid used to check the gateway
+const ipfsHealthCID = "bafkqaaa"
+
+var errBadCID = errors.New("bad cid")
+
+var cidEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func init() {
+	RegisterExtension("_ipfs", func(setting func(key string) string) (Extension, error) {
+		return NewIPFS("_ipfs", setting("IPFS_GATEWAY"))
+	})
+	RegisterExtension("_ipns", func(setting func(key string) string) (Extension, error) {
+		return NewIPFS("_ipns", setting("IPFS_GATEWAY"))
+	})
+}
+
+// IPFS a content extension serving names delegated
+// to NS records such as <cid>._ipfs. or <key>._ipns.
+// from an IPFS HTTP gateway
+type IPFS struct {
+	name      string
+	namespace string
+	gateway   *url.URL
+	client    *http.Client
+}
+
+func NewIPFS(name, gateway string) (*IPFS, error) {
+	var namespace string
+	switch name {
+	case "_ipfs":
+		namespace = "ipfs"
+	case "_ipns":
+		namespace = "ipns"
+	default:
+		return nil, fmt.Errorf("unknown ipfs extension %s", name)
+	}
+
+	u, err := url.Parse(gateway)
+	if err != nil {
+		return nil, fmt.Errorf("bad ipfs gateway: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("bad ipfs gateway: unsupported scheme %s", u.Scheme)
+	}
+
+	return &IPFS{
+		name:      name,
+		namespace: namespace,
+		gateway:   u,
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (i *IPFS) Name() string {
+	return i.name
+}
+
+// Handler names served by the gateway have no records
+func (i *IPFS) Handler(ctx context.Context, qname string, qtype uint16, ns *dns.NS) ([]dns.RR, error) {
+	return nil, nil
+}
+
+func (i *IPFS) Content(ctx context.Context, qname string, ns *dns.NS) (*Content, error) {
+	id := FirstNLabels(ns.Ns, 1)
+	if err := parseCID(id); err != nil {
+		return nil, fmt.Errorf("%s: %w", id, err)
+	}
+
+	return &Content{URL: i.gateway.JoinPath(i.namespace, id)}, nil
+}
+
+// Health checks the gateway is able to serve content
+func (i *IPFS) Health(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, i.gateway.JoinPath("ipfs", ipfsHealthCID).String(), nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := i.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("ipfs gateway returned status %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+func (i *IPFS) CachePolicy() CachePolicy {
+	return CachePolicy{}
+}
+
+// parseCID checks id is a CIDv1 in a case-insensitive
+// multibase (base32 or base36) since DNS labels are
+// lower cased
+func parseCID(id string) error {
+	if len(id) < 2 {
+		return errBadCID
+	}
+
+	var b []byte
+	switch id[0] {
+	case 'b':
+		var err error
+		if b, err = cidEncoding.DecodeString(strings.ToUpper(id[1:])); err != nil {
+			return errBadCID
+		}
+	case 'k':
+		n, ok := new(big.Int).SetString(id[1:], 36)
+		if !ok {
+			return errBadCID
+		}
+		b = n.Bytes()
+	default:
+		return fmt.Errorf("%w: unsupported multibase", errBadCID)
+	}
+
+	// <version><codec><multihash>
+	version, n := binary.Uvarint(b)
+	if n <= 0 || version != 1 {
+		return fmt.Errorf("%w: unsupported version", errBadCID)
+	}
+	b = b[n:]
+
+	if _, n = binary.Uvarint(b); n <= 0 {
+		return errBadCID
+	}
+	b = b[n:]
+
+	if _, n = binary.Uvarint(b); n <= 0 {
+		return errBadCID
+	}
+	b = b[n:]
+
+	size, n := binary.Uvarint(b)
+	if n <= 0 || uint64(len(b)-n) != size {
+		return fmt.Errorf("%w: bad multihash", errBadCID)
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package resolvers
+
+import (
+	"context"
+	"errors"
+	"github.com/miekg/dns"
+	"github.com/randomlogin/sane/resolver"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testCID = "bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi"
+
+func TestParseCID(t *testing.T) {
+	// libp2p-key cidv1 in base36
+	key := append([]byte{0x01, 0x72, 0x00, 0x24, 0x08, 0x01, 0x12, 0x20}, make([]byte, 32)...)
+	key[len(key)-1] = 1
+	base36 := "k" + new(big.Int).SetBytes(key).Text(36)
+
+	tests := map[string]bool{
+		testCID:                  true,
+		"bafkqaaa":               true,
+		base36:                   true,
+		testCID[:len(testCID)-1]: false,
+		"qmyfoo":                 false,
+		"b":                      false,
+		"bafy!!":                 false,
+	}
+
+	for id, valid := range tests {
+		err := parseCID(id)
+		if valid && err != nil {
+			t.Fatalf("parseCID(%s) got err = %v, want nil", id, err)
+		}
+		if !valid && !errors.Is(err, errBadCID) {
+			t.Fatalf("parseCID(%s) got err = %v, want %v", id, err, errBadCID)
+		}
+	}
+}
+
+func TestIPFSContent(t *testing.T) {
+	gateway := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/ipfs/"+ipfsHealthCID {
+			http.NotFound(rw, req)
+		}
+	}))
+	defer gateway.Close()
+
+	ext, err := NewIPFS("_ipfs", gateway.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ext.Health(context.Background()); err != nil {
+		t.Fatalf("got health err = %v, want nil", err)
+	}
+
+	stub := &resolver.Stub{DefaultResolver: resolver.DefaultResolver{
+		Query: func(ctx context.Context, name string, qtype uint16) *resolver.DNSResult {
+			return &resolver.DNSResult{Err: resolver.ErrServFail}
+		},
+	}}
+
+	h := NewHIP5Resolver(stub, "0.0.0.0", func() bool {
+		return true
+	})
+	h.exchangeRoot = testExchangeRootFunc(t, "forever.",
+		[]dns.RR{testRR("forever. 300 IN NS " + testCID + "._ipfs.")})
+
+	reg := NewRegistry()
+	reg.Add(ext)
+	h.SetExtensions(reg)
+
+	content, ok := h.LookupContent(context.Background(), "www.forever")
+	if !ok {
+		t.Fatal("no content found for www.forever")
+	}
+
+	want := gateway.URL + "/ipfs/" + testCID
+	if content.URL.String() != want {
+		t.Fatalf("got url = %s, want %s", content.URL, want)
+	}
+
+	// content names have no records
+	res := h.Resolve(context.Background(), "forever.", dns.TypeA)
+	if res.Err != nil || len(res.Records) != 0 || res.Extension != "_ipfs" {
+		t.Fatalf("got result = %v, %v, %s, want no records from _ipfs", res.Records, res.Err, res.Extension)
+	}
+
+	h.exchangeRoot = testExchangeRootFunc(t, "bad.",
+		[]dns.RR{testRR("bad. 300 IN NS notacid._ipfs.")})
+	if _, ok := h.LookupContent(context.Background(), "bad"); ok {
+		t.Fatal("got content for a bad cid")
+	}
+
+	// names without a content extension
+	// aren't resolved
+	h.exchangeRoot = testExchangeRootFunc(t, "com.",
+		[]dns.RR{testRR("com. 300 IN NS a.gtld-servers.net.")})
+	h.SetQueryMiddleware(func(name string, qtype uint16) (bool, *resolver.DNSResult) {
+		t.Fatalf("got %s resolved, want no lookup", name)
+		return false, nil
+	})
+	if _, ok := h.LookupContent(context.Background(), "example.com"); ok {
+		t.Fatal("got content for example.com")
+	}
+}
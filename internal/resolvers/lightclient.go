@@ -0,0 +1,309 @@
+package resolvers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// how long a header from a trusted endpoint is used
+const trustedHeaderTTL = 12 * time.Second
+
+// max size of a bytes value read from storage
+const maxStorageBytes = 64 * 1024
+
+var errNotVerifiable = errors.New("not verifiable")
+
+// resolverLayout storage slots used by resolver profiles
+type resolverLayout struct {
+	// mapping(bytes32 => uint64) recordVersions
+	versions uint64
+	// mapping(uint64 => mapping(bytes32 => mapping(bytes32 => mapping(uint16 => bytes)))) versionable_records
+	records uint64
+}
+
+// resolvers with a known storage layout whose
+// records can be read through proofs names using
+// other resolvers are answered with calls and
+// aren't secure
+var verifiableResolvers = map[common.Address]resolverLayout{
+	// ENS PublicResolver
+	common.HexToAddress("0x231b0Ee14048e9dCcD1d247744d114a4EB5E8E63"): {versions: 0, records: 5},
+}
+
+// HeaderSource provides block headers the user trusts
+// storage proofs are verified against their state root
+type HeaderSource interface {
+	TrustedHeader(ctx context.Context) (*types.Header, error)
+}
+
+type headerReader interface {
+	HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+}
+
+// checkpointHeaders a single header pinned by its hash
+// which may be fetched from an untrusted endpoint records
+// are read at that block so later changes aren't seen
+type checkpointHeaders struct {
+	client headerReader
+	hash   common.Hash
+
+	sync.Mutex
+	header *types.Header
+}
+
+// NewCheckpointHeaders trusts the block with the given hash
+// the endpoint must be able to serve proofs for that block
+// which pruned nodes only keep for recent blocks so an
+// archive endpoint is needed in practice
+func NewCheckpointHeaders(client headerReader, hash string) (HeaderSource, error) {
+	b, err := hexutil.Decode(hash)
+	if err != nil || len(b) != common.HashLength {
+		return nil, fmt.Errorf("bad checkpoint %s", hash)
+	}
+
+	return &checkpointHeaders{client: client, hash: common.BytesToHash(b)}, nil
+}
+
+func (c *checkpointHeaders) TrustedHeader(ctx context.Context) (*types.Header, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.header != nil {
+		return c.header, nil
+	}
+
+	header, err := c.client.HeaderByHash(ctx, c.hash)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch checkpoint header: %v", err)
+	}
+
+	if header.Hash() != c.hash {
+		return nil, fmt.Errorf("checkpoint header hash mismatch got %s", header.Hash())
+	}
+
+	c.header = header
+	return header, nil
+}
+
+// endpointHeaders latest headers from an endpoint the user
+// trusts such as their own node or a local light client
+type endpointHeaders struct {
+	client headerReader
+
+	sync.Mutex
+	header  *types.Header
+	fetched time.Time
+}
+
+func NewEndpointHeaders(rawurl string) (HeaderSource, error) {
+	pool, err := newEndpointPool([]string{rawurl}, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return &endpointHeaders{client: pool}, nil
+}
+
+func (e *endpointHeaders) TrustedHeader(ctx context.Context) (*types.Header, error) {
+	e.Lock()
+	defer e.Unlock()
+
+	if e.header != nil && time.Since(e.fetched) < trustedHeaderTTL {
+		return e.header, nil
+	}
+
+	header, err := e.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch trusted header: %v", err)
+	}
+
+	e.header = header
+	e.fetched = time.Now()
+	return header, nil
+}
+
+// accountResult an eth_getProof response
+type accountResult struct {
+	AccountProof []hexutil.Bytes `json:"accountProof"`
+	StorageProof []struct {
+		Key   string          `json:"key"`
+		Proof []hexutil.Bytes `json:"proof"`
+	} `json:"storageProof"`
+}
+
+type proofBackend interface {
+	GetProof(ctx context.Context, addr common.Address, slots []common.Hash, block *big.Int) (*accountResult, error)
+}
+
+type rpcProofs struct {
+	client *rpc.Client
+}
+
+func (p *rpcProofs) GetProof(ctx context.Context, addr common.Address, slots []common.Hash, block *big.Int) (*accountResult, error) {
+	var res accountResult
+	if err := p.client.CallContext(ctx, &res, "eth_getProof", addr, slots, hexutil.EncodeBig(block)); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// lightClient reads contract storage through
+// proofs verified against trusted headers
+type lightClient struct {
+	proofs  proofBackend
+	headers HeaderSource
+}
+
+func proofBytes(proof []hexutil.Bytes) [][]byte {
+	out := make([][]byte, len(proof))
+	for i, p := range proof {
+		out[i] = p
+	}
+
+	return out
+}
+
+// storage returns the verified values of slots
+func (l *lightClient) storage(ctx context.Context, addr common.Address, slots ...common.Hash) ([]common.Hash, error) {
+	header, err := l.headers.TrustedHeader(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := l.proofs.GetProof(ctx, addr, slots, header.Number)
+	if err != nil {
+		if _, ok := l.headers.(*checkpointHeaders); ok {
+			return nil, fmt.Errorf("eth_getProof failed at checkpoint block %s (needs an archive endpoint): %v", header.Number, err)
+		}
+		return nil, fmt.Errorf("eth_getProof failed: %v", err)
+	}
+
+	storageRoot, err := verifyAccount(header.Root, addr, proofBytes(res.AccountProof))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res.StorageProof) != len(slots) {
+		return nil, fmt.Errorf("%w: got %d storage proofs, want %d", errBadProof, len(res.StorageProof), len(slots))
+	}
+
+	values := make([]common.Hash, len(slots))
+	for i, slot := range slots {
+		sp := res.StorageProof[i]
+		if common.HexToHash(sp.Key) != slot {
+			return nil, fmt.Errorf("%w: unexpected storage key %s", errBadProof, sp.Key)
+		}
+
+		if values[i], err = verifyStorage(storageRoot, slot, proofBytes(sp.Proof)); err != nil {
+			return nil, err
+		}
+	}
+
+	return values, nil
+}
+
+// readBytes reads a solidity bytes value stored at slot
+// https://docs.soliditylang.org/en/latest/internals/layout_in_storage.html#bytes-and-string
+func (l *lightClient) readBytes(ctx context.Context, addr common.Address, slot common.Hash) ([]byte, error) {
+	values, err := l.storage(ctx, addr, slot)
+	if err != nil {
+		return nil, err
+	}
+
+	v := values[0]
+
+	// short values are stored with their length * 2
+	if v[31]&1 == 0 {
+		n := int(v[31] / 2)
+		if n > 31 {
+			return nil, fmt.Errorf("%w: bad bytes length", errBadProof)
+		}
+
+		return v[:n:n], nil
+	}
+
+	length := new(big.Int).Rsh(v.Big(), 1)
+	if length.Cmp(big.NewInt(maxStorageBytes)) > 0 {
+		return nil, fmt.Errorf("stored value too large")
+	}
+
+	n := int(length.Int64())
+	start := crypto.Keccak256Hash(slot[:]).Big()
+	slots := make([]common.Hash, (n+31)/32)
+	for i := range slots {
+		slots[i] = common.BigToHash(new(big.Int).Add(start, big.NewInt(int64(i))))
+	}
+
+	if values, err = l.storage(ctx, addr, slots...); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 0, len(values)*32)
+	for _, v := range values {
+		data = append(data, v[:]...)
+	}
+
+	return data[:n], nil
+}
+
+func uintSlot(v uint64) common.Hash {
+	return common.BigToHash(new(big.Int).SetUint64(v))
+}
+
+// mappingSlot the storage slot of key in
+// a solidity mapping declared at slot
+func mappingSlot(key, slot common.Hash) common.Hash {
+	return crypto.Keccak256Hash(key[:], slot[:])
+}
+
+// registryResolver reads the resolver of node from an ENS registry
+// names only found in the registry fallback aren't verifiable
+func (l *lightClient) registryResolver(ctx context.Context, registry common.Address, node common.Hash) (common.Address, error) {
+	// mapping(bytes32 => Record) records
+	// struct Record { address owner; address resolver; uint64 ttl; }
+	record := mappingSlot(node, uintSlot(0))
+	resolverSlot := common.BigToHash(new(big.Int).Add(record.Big(), common.Big1))
+
+	values, err := l.storage(ctx, registry, record, resolverSlot)
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	if values[0] == (common.Hash{}) {
+		return common.Address{}, errNotVerifiable
+	}
+
+	return common.BytesToAddress(values[1][:]), nil
+}
+
+// dnsRecord reads a DNSResolver rrset for name
+func (l *lightClient) dnsRecord(ctx context.Context, resolver common.Address, node, name [32]byte, resource uint16) ([]byte, error) {
+	layout, ok := verifiableResolvers[resolver]
+	if !ok {
+		return nil, errNotVerifiable
+	}
+
+	versions, err := l.storage(ctx, resolver, mappingSlot(node, uintSlot(layout.versions)))
+	if err != nil {
+		return nil, err
+	}
+
+	version := versions[0].Big().Uint64()
+	slot := mappingSlot(uintSlot(version), uintSlot(layout.records))
+	slot = mappingSlot(node, slot)
+	slot = mappingSlot(name, slot)
+	slot = mappingSlot(uintSlot(uint64(resource)), slot)
+
+	return l.readBytes(ctx, resolver, slot)
+}
@@ -0,0 +1,417 @@
+package resolvers
+
+import (
+	"bytes"
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/miekg/dns"
+	"github.com/randomlogin/sane/resolver"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+)
+
+type testTriePair struct {
+	path  []byte
+	value []byte
+}
+
+// testTrie builds a secure merkle patricia trie holding
+// kv and returns its root and hashed nodes
+func testTrie(kv map[string][]byte) (common.Hash, [][]byte) {
+	if len(kv) == 0 {
+		return emptyTrieRoot, nil
+	}
+
+	var pairs []testTriePair
+	for k, v := range kv {
+		pairs = append(pairs, testTriePair{path: keyNibbles(crypto.Keccak256([]byte(k))), value: v})
+	}
+
+	var nodes [][]byte
+	root := testTrieNode(pairs, &nodes)
+	nodes = append(nodes, root)
+	return crypto.Keccak256Hash(root), nodes
+}
+
+func testTrieNode(pairs []testTriePair, nodes *[][]byte) []byte {
+	if len(pairs) == 1 {
+		return testRLP(testCompact(pairs[0].path, true), pairs[0].value)
+	}
+
+	prefix := pairs[0].path
+	for _, p := range pairs[1:] {
+		n := 0
+		for n < len(prefix) && prefix[n] == p.path[n] {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+
+	if len(prefix) > 0 {
+		rest := make([]testTriePair, len(pairs))
+		for i, p := range pairs {
+			rest[i] = testTriePair{path: p.path[len(prefix):], value: p.value}
+		}
+
+		child := testTrieNode(rest, nodes)
+		return testRLP(testCompact(prefix, false), rlp.RawValue(testTrieRef(child, nodes)))
+	}
+
+	items := make([]interface{}, 17)
+	for i := range items {
+		items[i] = []byte{}
+	}
+
+	for nibble := byte(0); nibble < 16; nibble++ {
+		var group []testTriePair
+		for _, p := range pairs {
+			if p.path[0] == nibble {
+				group = append(group, testTriePair{path: p.path[1:], value: p.value})
+			}
+		}
+
+		if len(group) > 0 {
+			items[nibble] = rlp.RawValue(testTrieRef(testTrieNode(group, nodes), nodes))
+		}
+	}
+
+	return testRLP(items...)
+}
+
+func testTrieRef(node []byte, nodes *[][]byte) []byte {
+	if len(node) < 32 {
+		return node
+	}
+
+	*nodes = append(*nodes, node)
+	b, _ := rlp.EncodeToBytes(crypto.Keccak256(node))
+	return b
+}
+
+func testCompact(nibbles []byte, leaf bool) []byte {
+	var flag byte
+	if leaf {
+		flag = 2
+	}
+
+	if len(nibbles)%2 == 1 {
+		nibbles = append([]byte{flag | 1}, nibbles...)
+	} else {
+		nibbles = append([]byte{flag, 0}, nibbles...)
+	}
+
+	out := make([]byte, len(nibbles)/2)
+	for i := range out {
+		out[i] = nibbles[i*2]<<4 | nibbles[i*2+1]
+	}
+
+	return out
+}
+
+func testRLP(items ...interface{}) []byte {
+	b, err := rlp.EncodeToBytes(items)
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
+
+// testProofs serves proofs for a state
+// held in memory
+type testProofs struct {
+	state map[common.Address]map[common.Hash]common.Hash
+	// tamper modifies storage after the
+	// state root was computed
+	tamper func(storage map[common.Hash]common.Hash)
+}
+
+func (p *testProofs) tries() (common.Hash, map[common.Address][][]byte, map[common.Address][][]byte) {
+	accounts := make(map[string][]byte)
+	storageNodes := make(map[common.Address][][]byte)
+	for addr, storage := range p.state {
+		kv := make(map[string][]byte)
+		for slot, v := range storage {
+			kv[string(slot[:])], _ = rlp.EncodeToBytes(bytes.TrimLeft(v[:], "\x00"))
+		}
+
+		root, nodes := testTrie(kv)
+		storageNodes[addr] = nodes
+		accounts[string(addr[:])], _ = rlp.EncodeToBytes(&proofAccount{
+			Balance:  big.NewInt(0),
+			Root:     root,
+			CodeHash: crypto.Keccak256(nil),
+		})
+	}
+
+	stateRoot, accountNodes := testTrie(accounts)
+	nodes := make(map[common.Address][][]byte)
+	for addr := range p.state {
+		nodes[addr] = accountNodes
+	}
+
+	return stateRoot, nodes, storageNodes
+}
+
+func (p *testProofs) header() *types.Header {
+	root, _, _ := p.tries()
+	return &types.Header{Number: big.NewInt(1), Root: root, Difficulty: big.NewInt(0)}
+}
+
+func (p *testProofs) GetProof(ctx context.Context, addr common.Address, slots []common.Hash, block *big.Int) (*accountResult, error) {
+	if p.tamper != nil {
+		p.tamper(p.state[addr])
+	}
+
+	_, accountNodes, storageNodes := p.tries()
+
+	res := &accountResult{}
+	for _, n := range accountNodes[addr] {
+		res.AccountProof = append(res.AccountProof, n)
+	}
+
+	for _, slot := range slots {
+		sp := struct {
+			Key   string          `json:"key"`
+			Proof []hexutil.Bytes `json:"proof"`
+		}{Key: slot.Hex()}
+
+		for _, n := range storageNodes[addr] {
+			sp.Proof = append(sp.Proof, n)
+		}
+
+		res.StorageProof = append(res.StorageProof, sp)
+	}
+
+	return res, nil
+}
+
+// testStoreBytes stores data at slot using
+// the solidity bytes layout
+func testStoreBytes(storage map[common.Hash]common.Hash, slot common.Hash, data []byte) {
+	if len(data) < 32 {
+		var v common.Hash
+		copy(v[:], data)
+		v[31] = byte(len(data) * 2)
+		storage[slot] = v
+		return
+	}
+
+	storage[slot] = common.BigToHash(big.NewInt(int64(len(data)*2 + 1)))
+	start := crypto.Keccak256Hash(slot[:]).Big()
+	for i := 0; i*32 < len(data); i++ {
+		var v common.Hash
+		copy(v[:], data[i*32:])
+		storage[common.BigToHash(new(big.Int).Add(start, big.NewInt(int64(i))))] = v
+	}
+}
+
+func TestVerifyProof(t *testing.T) {
+	kv := make(map[string][]byte)
+	for i := 0; i < 50; i++ {
+		kv[string(rune(i))] = bytes.Repeat([]byte{byte(i + 1)}, i%40+1)
+	}
+
+	root, nodes := testTrie(kv)
+	for k, v := range kv {
+		got, err := verifyProof(root, crypto.Keccak256([]byte(k)), nodes)
+		if err != nil || !bytes.Equal(got, v) {
+			t.Fatalf("got value = %x, %v, want %x", got, err, v)
+		}
+	}
+
+	// absent keys
+	got, err := verifyProof(root, crypto.Keccak256([]byte("missing")), nodes)
+	if err != nil || got != nil {
+		t.Fatalf("got value = %x, %v, want nil", got, err)
+	}
+
+	// proofs must match the root
+	if _, err = verifyProof(crypto.Keccak256Hash([]byte("root")), crypto.Keccak256([]byte("missing")), nodes); err == nil {
+		t.Fatal("got nil err for a proof with a wrong root")
+	}
+}
+
+func TestEthereumVerified(t *testing.T) {
+	registryAddr := common.HexToAddress(FirstNLabels(ethNS[0].Ns, 1))
+	resolverAddr := common.HexToAddress("0x231b0Ee14048e9dCcD1d247744d114a4EB5E8E63")
+	layout := verifiableResolvers[resolverAddr]
+
+	node := EnsNode("vitalik.eth")
+	record := mappingSlot(node, uintSlot(0))
+
+	// long enough to span storage slots
+	rrs := []dns.RR{testRR("vitalik.eth. 300 IN A 127.0.0.1"), testRR("vitalik.eth. 300 IN A 127.0.0.2")}
+	raw := make([]byte, 128)
+	off := 0
+	for _, rr := range rrs {
+		var err error
+		if off, err = dns.PackRR(rr, raw, off, nil, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	raw = raw[:off]
+
+	name, _ := hashDnsName("vitalik.eth.")
+	slot := mappingSlot(uintSlot(1), uintSlot(layout.records))
+	slot = mappingSlot(node, slot)
+	slot = mappingSlot(name, slot)
+	slot = mappingSlot(uintSlot(uint64(dns.TypeA)), slot)
+
+	resolverStorage := map[common.Hash]common.Hash{
+		mappingSlot(node, uintSlot(layout.versions)): uintSlot(1),
+	}
+	testStoreBytes(resolverStorage, slot, raw)
+
+	proofs := &testProofs{state: map[common.Address]map[common.Hash]common.Hash{
+		registryAddr: {
+			record: common.BytesToHash(common.HexToAddress("0x01").Bytes()),
+			common.BigToHash(new(big.Int).Add(record.Big(), common.Big1)): common.BytesToHash(resolverAddr.Bytes()),
+		},
+		resolverAddr: resolverStorage,
+	}}
+
+	_, none := testMethod(t, ENSRegistryABI, "resolver", common.Address{})
+	backend := &testBackend{
+		header: proofs.header(),
+		calls: map[common.Address]func([]byte) ([]byte, error){
+			registryAddr: func(data []byte) ([]byte, error) {
+				return none, nil
+			},
+		},
+	}
+
+	newVerified := func(checkpoint string) *Ethereum {
+		e := newEthereum(backend)
+		e.proofs = proofs
+
+		headers, err := NewCheckpointHeaders(backend, checkpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = e.SetHeaderSource(headers); err != nil {
+			t.Fatal(err)
+		}
+
+		return e
+	}
+
+	stub := &resolver.Stub{DefaultResolver: resolver.DefaultResolver{
+		Query: func(ctx context.Context, name string, qtype uint16) *resolver.DNSResult {
+			t.Fatalf("unexpected stub query %s", name)
+			return nil
+		},
+	}}
+
+	h := NewHIP5Resolver(stub, "0.0.0.0", func() bool {
+		return true
+	})
+
+	reg := NewRegistry()
+	reg.Add(newVerified(backend.header.Hash().Hex()))
+	h.SetExtensions(reg)
+
+	res := h.Resolve(context.Background(), "vitalik.eth.", dns.TypeA)
+	if res.Err != nil || !res.Secure || len(res.Records) != 2 || res.Records[1].String() != rrs[1].String() {
+		t.Fatalf("got %v, secure = %v, err = %v, want secure %v", res.Records, res.Secure, res.Err, rrs)
+	}
+
+	// names not in the registry fall back to calls
+	res = h.Resolve(context.Background(), "other.eth.", dns.TypeA)
+	if res.Err != nil || res.Secure {
+		t.Fatalf("got secure = %v, err = %v, want insecure answer", res.Secure, res.Err)
+	}
+
+	// headers must match the checkpoint
+	e := newVerified(crypto.Keccak256Hash([]byte("other")).Hex())
+	if _, _, err := e.VerifiedHandler(context.Background(), "vitalik.eth.", dns.TypeA, ethNS[0]); err == nil {
+		t.Fatal("got nil err for a header not matching the checkpoint")
+	}
+
+	// storage changed after the trusted header
+	proofs.tamper = func(storage map[common.Hash]common.Hash) {
+		if _, ok := storage[record]; ok {
+			storage[record] = common.BytesToHash(common.HexToAddress("0x02").Bytes())
+		}
+	}
+
+	e = newVerified(backend.header.Hash().Hex())
+	if _, _, err := e.VerifiedHandler(context.Background(), "vitalik.eth.", dns.TypeA, ethNS[0]); err == nil {
+		t.Fatal("got nil err for a proof not matching the trusted header")
+	}
+}
+
+// TestVerifiedLayoutLive checks verifiableResolvers against real contract
+// state comparing records read through proofs with the resolver's own
+// dnsRecord calls set FINGERTIP_TEST_ETHEREUM_ENDPOINT to a mainnet
+// endpoint serving eth_getProof to run it and FINGERTIP_TEST_ENS_NAMES
+// to names with dns records in a verifiable resolver
+func TestVerifiedLayoutLive(t *testing.T) {
+	endpoint := os.Getenv("FINGERTIP_TEST_ETHEREUM_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("FINGERTIP_TEST_ETHEREUM_ENDPOINT not set")
+	}
+
+	names := splitEndpoints(os.Getenv("FINGERTIP_TEST_ENS_NAMES"))
+	if len(names) == 0 {
+		t.Skip("FINGERTIP_TEST_ENS_NAMES not set")
+	}
+
+	calls, err := NewEthereum([]string{endpoint}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proofs, err := NewEthereum([]string{endpoint}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headers, err := NewEndpointHeaders(endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = proofs.SetHeaderSource(headers); err != nil {
+		t.Fatal(err)
+	}
+
+	found := 0
+	for _, name := range names {
+		qname := dns.Fqdn(strings.TrimSpace(name))
+		for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeTXT, dns.TypeNS} {
+			want, _, err := calls.VerifiedHandler(context.Background(), qname, qtype, ethNS[0])
+			if err != nil {
+				t.Fatalf("%s %s call: %v", qname, dns.TypeToString[qtype], err)
+			}
+
+			got, verified, err := proofs.VerifiedHandler(context.Background(), qname, qtype, ethNS[0])
+			if err != nil {
+				t.Fatalf("%s %s proof: %v", qname, dns.TypeToString[qtype], err)
+			}
+			if !verified {
+				t.Fatalf("got %s not verified, want a name using a verifiable resolver", qname)
+			}
+
+			if len(got) != len(want) {
+				t.Fatalf("got %s %s = %v, want %v", qname, dns.TypeToString[qtype], got, want)
+			}
+			for i := range got {
+				if got[i].String() != want[i].String() {
+					t.Fatalf("got %s %s = %v, want %v", qname, dns.TypeToString[qtype], got, want)
+				}
+			}
+			found += len(got)
+		}
+	}
+
+	if found == 0 {
+		t.Fatal("got no records, want names with dns records to compare")
+	}
+}
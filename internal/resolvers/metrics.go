@@ -0,0 +1,72 @@
+package resolvers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fingertip/internal/metrics"
+)
+
+// label modes of queried names in metrics
+const (
+	MetricsNamesOmit   = ""
+	MetricsNamesHashed = "hashed"
+	MetricsNamesPlain  = "plain"
+)
+
+var (
+	queriesTotal = metrics.Default.NewCounterVec("fingertip_queries_total",
+		"Queries resolved by path (stub, hip5, eth) and result", "path", "result")
+
+	queryDuration = metrics.Default.NewHistogramVec("fingertip_query_duration_seconds",
+		"Query latency by path", metrics.DefaultBuckets, "path")
+
+	dnssecTotal = metrics.Default.NewCounterVec("fingertip_dnssec_total",
+		"DNSSEC validation outcomes (secure, insecure, unsigned, bogus) by resolver", "resolver", "outcome")
+
+	ethRPCDuration = metrics.Default.NewHistogramVec("fingertip_eth_rpc_duration_seconds",
+		"Ethereum rpc call latency by endpoint", metrics.DefaultBuckets, "endpoint")
+
+	ethRPCErrors = metrics.Default.NewCounterVec("fingertip_eth_rpc_errors_total",
+		"Failed ethereum rpc calls by endpoint", "endpoint")
+
+	namesTotal = metrics.Default.NewCounterVec("fingertip_tld_queries_total",
+		"Queries by tld only recorded if METRICS_NAMES is hashed or plain", "tld")
+)
+
+// queryPath the path taken to resolve a query
+func queryPath(extension string) string {
+	switch extension {
+	case "":
+		return "stub"
+	case "_eth":
+		return "eth"
+	}
+
+	return "hip5"
+}
+
+func queryResult(res *DNSResult) string {
+	switch {
+	case res.Err != nil:
+		return "error"
+	case res.Secure:
+		return "secure"
+	}
+
+	return "insecure"
+}
+
+// metricsName the tld label of name
+// empty if names are omitted
+func metricsName(mode, name string) string {
+	tld := LastNLabels(name, 1)
+	switch mode {
+	case MetricsNamesPlain:
+		return tld
+	case MetricsNamesHashed:
+		sum := sha256.Sum256([]byte(tld))
+		return hex.EncodeToString(sum[:8])
+	}
+
+	return ""
+}
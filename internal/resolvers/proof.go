@@ -0,0 +1,203 @@
+package resolvers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"math/big"
+)
+
+// merkle patricia trie proofs as returned by eth_getProof
+// https://ethereum.org/en/developers/docs/data-structures-and-encoding/patricia-merkle-trie/
+
+var errBadProof = errors.New("bad proof")
+
+// root of an empty trie keccak256(rlp(""))
+var emptyTrieRoot = crypto.Keccak256Hash([]byte{0x80})
+
+// proofAccount the state account rlp
+// stored in the account trie
+type proofAccount struct {
+	Nonce    uint64
+	Balance  *big.Int
+	Root     common.Hash
+	CodeHash []byte
+}
+
+// verifyProof checks proof against root and returns the
+// value stored at key a nil value proves key is absent
+func verifyProof(root common.Hash, key []byte, proof [][]byte) ([]byte, error) {
+	if root == emptyTrieRoot {
+		return nil, nil
+	}
+
+	nodes := make(map[common.Hash][]byte, len(proof))
+	for _, n := range proof {
+		nodes[crypto.Keccak256Hash(n)] = n
+	}
+
+	path := keyNibbles(key)
+	node, ok := nodes[root]
+	if !ok {
+		return nil, fmt.Errorf("%w: missing root node", errBadProof)
+	}
+
+	for {
+		items, err := splitNode(node)
+		if err != nil {
+			return nil, err
+		}
+
+		var ref []byte
+		switch len(items) {
+		case 17:
+			if len(path) == 0 {
+				return nodeValue(items[16])
+			}
+
+			ref, path = items[path[0]], path[1:]
+		case 2:
+			_, compact, _, err := rlp.Split(items[0])
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", errBadProof, err)
+			}
+
+			nibbles, leaf := compactNibbles(compact)
+			if !bytes.HasPrefix(path, nibbles) {
+				return nil, nil
+			}
+
+			path = path[len(nibbles):]
+			if leaf {
+				if len(path) != 0 {
+					return nil, nil
+				}
+
+				return nodeValue(items[1])
+			}
+
+			ref = items[1]
+		default:
+			return nil, fmt.Errorf("%w: unexpected node", errBadProof)
+		}
+
+		kind, content, _, err := rlp.Split(ref)
+		switch {
+		case err != nil:
+			return nil, fmt.Errorf("%w: %v", errBadProof, err)
+		case kind == rlp.List:
+			// small nodes are embedded in their parent
+			node = ref
+		case len(content) == 0:
+			return nil, nil
+		case len(content) == common.HashLength:
+			if node, ok = nodes[common.BytesToHash(content)]; !ok {
+				return nil, fmt.Errorf("%w: missing node", errBadProof)
+			}
+		default:
+			return nil, fmt.Errorf("%w: bad node reference", errBadProof)
+		}
+	}
+}
+
+// splitNode returns the raw encoded items of a trie node
+func splitNode(node []byte) ([][]byte, error) {
+	content, _, err := rlp.SplitList(node)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errBadProof, err)
+	}
+
+	var items [][]byte
+	for len(content) > 0 {
+		_, _, rest, err := rlp.Split(content)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errBadProof, err)
+		}
+
+		items = append(items, content[:len(content)-len(rest)])
+		content = rest
+	}
+
+	return items, nil
+}
+
+func nodeValue(item []byte) ([]byte, error) {
+	kind, content, _, err := rlp.Split(item)
+	if err != nil || kind == rlp.List {
+		return nil, fmt.Errorf("%w: unexpected value", errBadProof)
+	}
+
+	if len(content) == 0 {
+		return nil, nil
+	}
+
+	return content, nil
+}
+
+func keyNibbles(key []byte) []byte {
+	nibbles := make([]byte, len(key)*2)
+	for i, b := range key {
+		nibbles[i*2] = b >> 4
+		nibbles[i*2+1] = b & 0x0f
+	}
+
+	return nibbles
+}
+
+// compactNibbles decodes a hex prefix encoded path
+// and reports if it belongs to a leaf node
+func compactNibbles(compact []byte) ([]byte, bool) {
+	if len(compact) == 0 {
+		return nil, false
+	}
+
+	nibbles := keyNibbles(compact)
+	leaf := nibbles[0]&2 != 0
+
+	// odd paths store their first nibble in the prefix
+	if nibbles[0]&1 != 0 {
+		return nibbles[1:], leaf
+	}
+
+	return nibbles[2:], leaf
+}
+
+// verifyAccount returns the storage root of addr
+// proven against the state root
+func verifyAccount(stateRoot common.Hash, addr common.Address, proof [][]byte) (common.Hash, error) {
+	value, err := verifyProof(stateRoot, crypto.Keccak256(addr[:]), proof)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	// accounts that don't exist have no storage
+	if value == nil {
+		return emptyTrieRoot, nil
+	}
+
+	var account proofAccount
+	if err := rlp.DecodeBytes(value, &account); err != nil {
+		return common.Hash{}, fmt.Errorf("%w: bad account: %v", errBadProof, err)
+	}
+
+	return account.Root, nil
+}
+
+// verifyStorage returns the value of slot
+// proven against the storage root
+func verifyStorage(storageRoot, slot common.Hash, proof [][]byte) (common.Hash, error) {
+	value, err := verifyProof(storageRoot, crypto.Keccak256(slot[:]), proof)
+	if err != nil || value == nil {
+		return common.Hash{}, err
+	}
+
+	var b []byte
+	if err := rlp.DecodeBytes(value, &b); err != nil || len(b) > common.HashLength {
+		return common.Hash{}, fmt.Errorf("%w: bad storage value", errBadProof)
+	}
+
+	return common.BytesToHash(b), nil
+}
@@ -0,0 +1,223 @@
+package resolvers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/miekg/dns"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// max size of the log file before it's rotated
+const maxQueryLogSize = 5 << 20
+
+// rotated log files kept as <path>.1 ... <path>.n
+const queryLogBackups = 3
+
+// TraceStep a step taken to resolve a name
+type TraceStep struct {
+	// Path stub, extension, delegation, cname or lookup
+	Path   string `json:"path"`
+	Detail string `json:"detail"`
+	Error  string `json:"error,omitempty"`
+}
+
+// QueryRecord a resolved query and how it was resolved
+type QueryRecord struct {
+	Time      time.Time   `json:"time"`
+	Name      string      `json:"name"`
+	Type      string      `json:"type"`
+	Extension string      `json:"extension,omitempty"`
+	Trace     []TraceStep `json:"trace"`
+	CNAMEs    []string    `json:"cnames,omitempty"`
+	Secure    bool        `json:"secure"`
+	Records   int         `json:"records"`
+	LatencyMs float64     `json:"latencyMs"`
+	Error     string      `json:"error,omitempty"`
+}
+
+type traceKey struct{}
+
+// queryTrace collects steps of a query and
+// the lookups it depends on
+type queryTrace struct {
+	sync.Mutex
+	steps  []TraceStep
+	cnames []string
+}
+
+func withTrace(ctx context.Context, t *queryTrace) context.Context {
+	return context.WithValue(ctx, traceKey{}, t)
+}
+
+func traceFrom(ctx context.Context) *queryTrace {
+	t, _ := ctx.Value(traceKey{}).(*queryTrace)
+	return t
+}
+
+// traceStep adds a step to the trace in ctx if any
+func traceStep(ctx context.Context, path string, err error, format string, args ...interface{}) {
+	t := traceFrom(ctx)
+	if t == nil {
+		return
+	}
+
+	step := TraceStep{Path: path, Detail: fmt.Sprintf(format, args...)}
+	if err != nil {
+		step.Error = err.Error()
+	}
+
+	t.Lock()
+	t.steps = append(t.steps, step)
+	t.Unlock()
+}
+
+func traceCNAME(ctx context.Context, target string) {
+	t := traceFrom(ctx)
+	if t == nil {
+		return
+	}
+
+	t.Lock()
+	t.cnames = append(t.cnames, target)
+	t.Unlock()
+}
+
+// QueryLog keeps recent queries in memory and
+// optionally appends them to a rotated jsonl file
+type QueryLog struct {
+	path string
+
+	sync.Mutex
+	records []QueryRecord
+	next    int
+	full    bool
+	file    *os.File
+	size    int64
+}
+
+// NewQueryLog keeps the last maxN records logging
+// them to path as well unless path is empty
+func NewQueryLog(path string, maxN int) (*QueryLog, error) {
+	l := &QueryLog{path: path, records: make([]QueryRecord, maxN)}
+	if path == "" {
+		return l, nil
+	}
+
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *QueryLog) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	l.file = f
+	l.size = fi.Size()
+	return nil
+}
+
+// rotate moves <path> to <path>.1 dropping the oldest file
+func (l *QueryLog) rotate() error {
+	l.file.Close()
+	l.file = nil
+
+	for i := queryLogBackups - 1; i > 0; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+	}
+
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		return err
+	}
+
+	return l.open()
+}
+
+func (l *QueryLog) Add(r QueryRecord) {
+	l.Lock()
+	defer l.Unlock()
+
+	if len(l.records) > 0 {
+		l.records[l.next] = r
+		l.next = (l.next + 1) % len(l.records)
+		l.full = l.full || l.next == 0
+	}
+
+	if l.file == nil {
+		return
+	}
+
+	b, err := json.Marshal(&r)
+	if err != nil {
+		return
+	}
+	b = append(b, '\n')
+
+	if l.size+int64(len(b)) > maxQueryLogSize {
+		if err := l.rotate(); err != nil {
+			return
+		}
+	}
+
+	n, _ := l.file.Write(b)
+	l.size += int64(n)
+}
+
+// Recent returns up to limit records newest first
+// matching name if not empty
+func (l *QueryLog) Recent(name string, limit int) []QueryRecord {
+	l.Lock()
+	defer l.Unlock()
+
+	if name != "" {
+		name = dns.CanonicalName(name)
+	}
+
+	n := l.next
+	if l.full {
+		n = len(l.records)
+	}
+
+	out := make([]QueryRecord, 0)
+	for i := 1; i <= n && (limit <= 0 || len(out) < limit); i++ {
+		r := l.records[(l.next-i+len(l.records))%len(l.records)]
+		if name != "" && !strings.EqualFold(r.Name, name) {
+			continue
+		}
+
+		out = append(out, r)
+	}
+
+	return out
+}
+
+func (l *QueryLog) Close() error {
+	if l == nil {
+		return nil
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
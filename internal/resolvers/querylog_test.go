@@ -0,0 +1,137 @@
+package resolvers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/miekg/dns"
+	"github.com/randomlogin/sane/resolver"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestQueryLogTrace(t *testing.T) {
+	stub := &resolver.Stub{DefaultResolver: resolver.DefaultResolver{
+		Query: func(ctx context.Context, name string, qtype uint16) *resolver.DNSResult {
+			if name == "example.com." {
+				return &resolver.DNSResult{Records: []dns.RR{testRR("example.com. 300 IN A 127.0.0.1")}}
+			}
+
+			return &resolver.DNSResult{Err: resolver.ErrServFail}
+		},
+	}}
+
+	h := NewHIP5Resolver(stub, "0.0.0.0", func() bool {
+		return true
+	})
+
+	h.exchangeRoot = testExchangeRootFunc(t, "forever.",
+		[]dns.RR{testRR("forever. 300 IN NS data._example.")})
+
+	h.RegisterHandler("_example", func(ctx context.Context, qname string, qtype uint16, ns *dns.NS) ([]dns.RR, error) {
+		switch qname {
+		case "www.forever.":
+			return []dns.RR{testRR("www.forever. 300 IN CNAME example.com.")}, nil
+		case "broken.forever.":
+			return nil, errors.New("broken")
+		}
+
+		return nil, nil
+	})
+
+	path := filepath.Join(t.TempDir(), "queries.jsonl")
+	l, err := NewQueryLog(path, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.SetQueryLog(l)
+
+	h.Resolve(context.Background(), "www.forever.", dns.TypeA)
+	h.Resolve(context.Background(), "broken.forever.", dns.TypeA)
+
+	recent := l.Recent("", 0)
+	if len(recent) != 2 {
+		t.Fatalf("got %d records, want 2", len(recent))
+	}
+
+	broken := recent[0]
+	if broken.Name != "broken.forever." || broken.Error == "" || broken.Extension != "_example" {
+		t.Fatalf("got record = %+v, want an error from _example", broken)
+	}
+
+	www := recent[1]
+	if www.Error != "" || www.Records != 1 || len(www.CNAMEs) != 1 || www.CNAMEs[0] != "example.com." {
+		t.Fatalf("got record = %+v, want cname to example.com.", www)
+	}
+
+	var paths []string
+	for _, step := range www.Trace {
+		paths = append(paths, step.Path)
+	}
+
+	if got, want := strings.Join(paths, ","), "stub,extension,stub"; got != want {
+		t.Fatalf("got trace paths = %s, want %s", got, want)
+	}
+
+	if got := l.Recent("WWW.forever", 0); len(got) != 1 {
+		t.Fatalf("got %d records for www.forever, want 1", len(got))
+	}
+
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r QueryRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		lines++
+	}
+
+	if lines != 2 {
+		t.Fatalf("got %d logged lines, want 2", lines)
+	}
+}
+
+func TestQueryLogRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.jsonl")
+	l, err := NewQueryLog(path, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	detail := strings.Repeat("x", 1<<16)
+	for i := 0; i < maxQueryLogSize/len(detail)*(queryLogBackups+2); i++ {
+		l.Add(QueryRecord{Name: "example.", Trace: []TraceStep{{Path: "stub", Detail: detail}}})
+	}
+
+	if _, err := os.Stat(path + ".1"); err != nil {
+		t.Fatalf("got err = %v, want rotated file", err)
+	}
+
+	if _, err := os.Stat(path + ".4"); !os.IsNotExist(err) {
+		t.Fatalf("got err = %v, want at most %d rotated files", err, queryLogBackups)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil || fi.Size() > maxQueryLogSize {
+		t.Fatalf("got size = %v, %v, want at most %d", fi, err, maxQueryLogSize)
+	}
+
+	if got := len(l.Recent("", 0)); got != 5 {
+		t.Fatalf("got %d recent records, want 5", got)
+	}
+}
@@ -0,0 +1,513 @@
+package resolvers
+
+import (
+	"context"
+	"errors"
+	"fingertip/internal/resolvers/dnssec"
+	"fmt"
+	"github.com/miekg/dns"
+	"github.com/randomlogin/sane/resolver"
+	"net"
+	"strings"
+	"time"
+)
+
+// HandshakeRootDS the trust anchor for the
+// handshake root zone served by hnsd
+const HandshakeRootDS = ". 3600 IN DS 35215 13 2 7C50EA94A63AEECB65B510D1EAC1846C973A89D4AB292287D5A4D715136B57A3"
+
+const (
+	maxReferrals      = 20
+	maxRecursionDepth = 8
+)
+
+var errBogus = errors.New("bogus response")
+var errNoNSAddr = errors.New("no reachable nameservers")
+var errNXDomain = errors.New("name does not exist")
+
+// recursiveResult a cached answer and
+// whether the name exists
+type recursiveResult struct {
+	res      *resolver.DNSResult
+	nxdomain bool
+}
+
+// delegation a zone cut and its
+// nameserver addresses
+type delegation struct {
+	zone    string
+	servers []string
+	ds      []dns.RR
+	secure  bool
+}
+
+// Recursive is an iterative DNSSEC validating resolver
+// starting from the handshake root zone
+type Recursive struct {
+	rootAddr string
+	anchors  []dns.RR
+
+	client    *dns.Client
+	tcpClient *dns.Client
+
+	zoneCache *cache
+	keyCache  *cache
+	ansCache  *cache
+
+	// needed for tests
+	exchange func(ctx context.Context, m *dns.Msg, a string) (r *dns.Msg, rtt time.Duration, err error)
+
+	resolver.DefaultResolver
+}
+
+func NewRecursive(rootAddr string) *Recursive {
+	r := &Recursive{
+		rootAddr:  rootAddr,
+		anchors:   []dns.RR{mustRR(HandshakeRootDS)},
+		zoneCache: newCache(500),
+		keyCache:  newCache(500),
+		ansCache:  newCache(5000),
+	}
+
+	r.client = &dns.Client{
+		Net:            "udp",
+		Timeout:        4 * time.Second,
+		SingleInflight: true,
+	}
+	r.tcpClient = &dns.Client{
+		Net:     "tcp",
+		Timeout: 4 * time.Second,
+	}
+	r.exchange = r.exchangeWithFallback
+	r.DefaultResolver = resolver.DefaultResolver{
+		Query: r.lookup,
+	}
+
+	return r
+}
+
+// CacheStats returns counters of the resolver caches
+func (r *Recursive) CacheStats() map[string]CacheStats {
+	return map[string]CacheStats{
+		"answer": r.ansCache.stats(),
+		"zone":   r.zoneCache.stats(),
+		"dnskey": r.keyCache.stats(),
+	}
+}
+
+// SetTrustAnchors replaces the root DS set
+func (r *Recursive) SetTrustAnchors(ds []dns.RR) {
+	r.anchors = ds
+}
+
+func mustRR(s string) dns.RR {
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		panic(err)
+	}
+	return rr
+}
+
+func servFail(format string, args ...interface{}) error {
+	return fmt.Errorf("recursive: %w: %s", resolver.ErrServFail, fmt.Sprintf(format, args...))
+}
+
+// bogus a servfail caused by a response
+// failing DNSSEC validation
+func bogus(format string, args ...interface{}) error {
+	return fmt.Errorf("recursive: %w: %w: %s", resolver.ErrServFail, errBogus, fmt.Sprintf(format, args...))
+}
+
+func (r *Recursive) lookup(ctx context.Context, name string, qtype uint16) *resolver.DNSResult {
+	return r.query(ctx, name, qtype).res
+}
+
+// Exchange answers a query the way a recursive
+// server would including NXDOMAIN
+func (r *Recursive) Exchange(ctx context.Context, req *dns.Msg) (*dns.Msg, error) {
+	if len(req.Question) != 1 {
+		return nil, errors.New("recursive: expected one question")
+	}
+
+	q := req.Question[0]
+	result := r.query(ctx, q.Name, q.Qtype)
+	if result.res.Err != nil {
+		return nil, result.res.Err
+	}
+
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.Answer = result.res.Records
+	m.AuthenticatedData = result.res.Secure
+	if result.nxdomain {
+		m.Rcode = dns.RcodeNameError
+	}
+
+	return m, nil
+}
+
+func (r *Recursive) query(ctx context.Context, name string, qtype uint16) recursiveResult {
+	name = dns.CanonicalName(name)
+	key := fmt.Sprintf("%s;%d", name, qtype)
+
+	if e, ok := r.ansCache.get(key); ok {
+		if r.ansCache.prefetch(key) {
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), prefetchTimeout)
+				defer cancel()
+
+				r.refresh(ctx, key, name, qtype)
+			}()
+		}
+
+		return e.msg.(recursiveResult)
+	}
+
+	result := r.refresh(ctx, key, name, qtype)
+	if result.res.Err != nil && !errors.Is(result.res.Err, errBogus) {
+		// serve stale while authoritative servers are
+		// unreachable but never after a bogus answer
+		if e, ok := r.ansCache.getStale(key); ok {
+			stale := e.msg.(recursiveResult)
+			res := *stale.res
+			res.Records = staleRRs(res.Records)
+			stale.res = &res
+			return stale
+		}
+	}
+
+	return result
+}
+
+// refresh resolves name caching the answer
+func (r *Recursive) refresh(ctx context.Context, key, name string, qtype uint16) recursiveResult {
+	rrs, secure, err := r.resolve(ctx, name, qtype, 0)
+	nxdomain := errors.Is(err, errNXDomain)
+	if err != nil && !nxdomain {
+		if errors.Is(err, errBogus) {
+			dnssecTotal.Inc("recursive", "bogus")
+		}
+		return recursiveResult{res: &resolver.DNSResult{Err: err}}
+	}
+
+	if secure {
+		dnssecTotal.Inc("recursive", "secure")
+	} else {
+		dnssecTotal.Inc("recursive", "insecure")
+	}
+
+	result := recursiveResult{
+		res:      &resolver.DNSResult{Records: rrs, Secure: secure},
+		nxdomain: nxdomain,
+	}
+	ttl := time.Minute
+	if len(rrs) > 0 {
+		ttl = getTTL(rrs)
+	}
+
+	r.ansCache.set(key, &entry{
+		msg: result,
+		ttl: time.Now().Add(ttl),
+	})
+
+	return result
+}
+
+func (r *Recursive) rootDelegation() *delegation {
+	return &delegation{
+		zone:    ".",
+		servers: []string{r.rootAddr},
+		ds:      r.anchors,
+		secure:  len(r.anchors) > 0,
+	}
+}
+
+// closestDelegation finds the deepest cached
+// zone cut for qname
+func (r *Recursive) closestDelegation(qname string, qtype uint16) *delegation {
+	off, end := 0, false
+
+	// DS records are served by the parent zone
+	if qtype == dns.TypeDS {
+		off, end = dns.NextLabel(qname, off)
+	}
+
+	for ; !end; off, end = dns.NextLabel(qname, off) {
+		zone := qname[off:]
+		if e, ok := r.zoneCache.get(zone); ok {
+			return e.msg.(*delegation)
+		}
+	}
+
+	return r.rootDelegation()
+}
+
+func (r *Recursive) resolve(ctx context.Context, qname string, qtype uint16, depth int) ([]dns.RR, bool, error) {
+	if depth > maxRecursionDepth {
+		return nil, false, servFail("%v", errMaxDepthReached)
+	}
+
+	d := r.closestDelegation(qname, qtype)
+
+	for i := 0; i < maxReferrals; i++ {
+		var keys map[uint16]*dns.DNSKEY
+		var err error
+
+		if d.secure {
+			if keys, err = r.zoneKeys(ctx, d); err != nil {
+				return nil, false, bogus("dnskey error for zone %s: %v", d.zone, err)
+			}
+		}
+
+		msg, err := r.exchangeServers(ctx, d.servers, qname, qtype)
+		if err != nil {
+			return nil, false, servFail("zone %s: %v", d.zone, err)
+		}
+
+		// verification removes unsigned glue
+		glue := msg.Extra
+		secure := len(keys) > 0
+
+		if secure {
+			if secure, err = dnssec.Verify(msg, d.zone, qname, qtype, keys, time.Now(), dnssec.DefaultMinRSAKeySize); err != nil {
+				return nil, false, bogus("%s: %v", qname, err)
+			}
+		}
+
+		switch {
+		case msg.Rcode == dns.RcodeNameError:
+			return nil, secure, errNXDomain
+		case msg.Rcode != dns.RcodeSuccess:
+			return nil, false, servFail("zone %s: got rcode %s", d.zone, dns.RcodeToString[msg.Rcode])
+		case len(msg.Answer) > 0:
+			return r.answer(ctx, msg.Answer, qname, qtype, secure, depth)
+		}
+
+		ns := referral(msg.Ns, d.zone, qname)
+		if len(ns) == 0 {
+			// no data
+			return nil, secure, nil
+		}
+
+		next := &delegation{zone: dns.CanonicalName(ns[0].Header().Name)}
+		if secure {
+			next.ds = extractType(msg.Ns, next.zone, dns.TypeDS)
+			next.secure = len(next.ds) > 0
+		}
+
+		if next.servers, err = r.nsAddrs(ctx, ns, glue, d.zone, depth); err != nil {
+			return nil, false, servFail("zone %s: %v", next.zone, err)
+		}
+
+		r.zoneCache.set(next.zone, &entry{
+			msg: next,
+			ttl: time.Now().Add(getTTL(nsToRR(ns))),
+		})
+
+		d = next
+	}
+
+	return nil, false, servFail("too many referrals for %s", qname)
+}
+
+// answer picks records owned by qname
+// following any CNAMEs
+func (r *Recursive) answer(ctx context.Context, rrs []dns.RR, qname string, qtype uint16, secure bool, depth int) ([]dns.RR, bool, error) {
+	var answer []dns.RR
+	var cname *dns.CNAME
+
+	for _, rr := range rrs {
+		if !strings.EqualFold(rr.Header().Name, qname) {
+			continue
+		}
+
+		switch t := rr.(type) {
+		case *dns.CNAME:
+			if qtype != dns.TypeCNAME {
+				cname = t
+				continue
+			}
+		case *dns.RRSIG:
+			continue
+		}
+
+		if rr.Header().Rrtype == qtype {
+			answer = append(answer, rr)
+		}
+	}
+
+	if len(answer) > 0 || cname == nil {
+		return answer, secure, nil
+	}
+
+	target := dns.CanonicalName(cname.Target)
+	if target == qname {
+		return nil, false, servFail("%v", errBadCNAMETarget)
+	}
+
+	rrs, targetSecure, err := r.resolve(ctx, target, qtype, depth+1)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return append([]dns.RR{cname}, rrs...), secure && targetSecure, nil
+}
+
+// referral returns NS records delegating
+// qname to a child of zone
+func referral(ns []dns.RR, zone, qname string) []*dns.NS {
+	var out []*dns.NS
+	var owner string
+
+	for _, rr := range ns {
+		t, ok := rr.(*dns.NS)
+		if !ok {
+			continue
+		}
+
+		name := dns.CanonicalName(t.Header().Name)
+		if !dnssec.IsSubDomainStrict(zone, name) || !dns.IsSubDomain(name, qname) {
+			continue
+		}
+
+		if owner == "" {
+			owner = name
+		}
+		if owner == name {
+			out = append(out, t)
+		}
+	}
+
+	return out
+}
+
+func extractType(rrs []dns.RR, owner string, qtype uint16) []dns.RR {
+	var out []dns.RR
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == qtype && strings.EqualFold(rr.Header().Name, owner) {
+			out = append(out, rr)
+		}
+	}
+	return out
+}
+
+// nsAddrs finds addresses for a set of nameservers
+// using in bailiwick glue or by resolving their names
+func (r *Recursive) nsAddrs(ctx context.Context, ns []*dns.NS, glue []dns.RR, zone string, depth int) ([]string, error) {
+	var addrs []string
+	var unresolved []string
+
+	for _, rr := range ns {
+		found := false
+		if dns.IsSubDomain(zone, rr.Ns) {
+			for _, g := range glue {
+				if !strings.EqualFold(g.Header().Name, rr.Ns) {
+					continue
+				}
+
+				switch t := g.(type) {
+				case *dns.A:
+					addrs = append(addrs, net.JoinHostPort(t.A.String(), "53"))
+					found = true
+				case *dns.AAAA:
+					addrs = append(addrs, net.JoinHostPort(t.AAAA.String(), "53"))
+					found = true
+				}
+			}
+		}
+
+		if !found {
+			unresolved = append(unresolved, dns.CanonicalName(rr.Ns))
+		}
+	}
+
+	if len(addrs) > 0 {
+		return addrs, nil
+	}
+
+	var lastErr error = errNoNSAddr
+	for _, name := range unresolved {
+		rrs, _, err := r.resolve(ctx, name, dns.TypeA, depth+1)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		for _, rr := range rrs {
+			if a, ok := rr.(*dns.A); ok {
+				addrs = append(addrs, net.JoinHostPort(a.A.String(), "53"))
+			}
+		}
+
+		if len(addrs) > 0 {
+			return addrs, nil
+		}
+	}
+
+	return nil, lastErr
+}
+
+func (r *Recursive) zoneKeys(ctx context.Context, d *delegation) (map[uint16]*dns.DNSKEY, error) {
+	if e, ok := r.keyCache.get(d.zone); ok {
+		msg := new(dns.Msg)
+		msg.Answer = e.msg.([]dns.RR)
+
+		keys, err := dnssec.VerifyDNSKeys(d.zone, msg, d.ds, time.Now(), dnssec.DefaultMinRSAKeySize)
+		if err == nil {
+			return keys, nil
+		}
+		r.keyCache.remove(d.zone)
+	}
+
+	msg, err := r.exchangeServers(ctx, d.servers, d.zone, dns.TypeDNSKEY)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := dnssec.VerifyDNSKeys(d.zone, msg, d.ds, time.Now(), dnssec.DefaultMinRSAKeySize)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) > 0 {
+		r.keyCache.set(d.zone, &entry{
+			msg: msg.Answer,
+			ttl: time.Now().Add(getTTL(msg.Answer)),
+		})
+	}
+
+	return keys, nil
+}
+
+func (r *Recursive) exchangeServers(ctx context.Context, servers []string, qname string, qtype uint16) (res *dns.Msg, err error) {
+	m := new(dns.Msg)
+	m.SetQuestion(qname, qtype)
+	m.RecursionDesired = false
+	m.CheckingDisabled = true
+	m.SetEdns0(4096, true)
+
+	err = errNoNSAddr
+	for _, addr := range servers {
+		if res, _, err = r.exchange(ctx, m, addr); err != nil {
+			continue
+		}
+
+		if res.Truncated {
+			err = errors.New("response truncated")
+			continue
+		}
+
+		return res, nil
+	}
+
+	return nil, err
+}
+
+func (r *Recursive) exchangeWithFallback(ctx context.Context, m *dns.Msg, addr string) (*dns.Msg, time.Duration, error) {
+	res, rtt, err := r.client.ExchangeContext(ctx, m, addr)
+	if err != nil || !res.Truncated {
+		return res, rtt, err
+	}
+
+	return r.tcpClient.ExchangeContext(ctx, m, addr)
+}
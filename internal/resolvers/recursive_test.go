@@ -0,0 +1,271 @@
+package resolvers
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"github.com/miekg/dns"
+	"github.com/randomlogin/sane/resolver"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeZone an in-process authoritative server
+// signing answers on the fly
+type fakeZone struct {
+	origin string
+	key    *dns.DNSKEY
+	priv   crypto.Signer
+	rrs    []dns.RR
+
+	// answers for this name are modified after signing
+	tamper string
+	// referrals to this cut have their DS replaced
+	// by the parent's NSEC of the delegation
+	stripDS string
+}
+
+func newFakeZone(t *testing.T, origin string, signed bool, data string) *fakeZone {
+	z := &fakeZone{origin: origin}
+	zp := dns.NewZoneParser(strings.NewReader(data), origin, "")
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		z.rrs = append(z.rrs, rr)
+	}
+	if err := zp.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !signed {
+		return z
+	}
+
+	z.key = &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: origin, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     257,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+
+	priv, err := z.key.Generate(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	z.priv = priv.(crypto.Signer)
+	return z
+}
+
+func (z *fakeZone) ds() dns.RR {
+	return z.key.ToDS(dns.SHA256)
+}
+
+func (z *fakeZone) sign(rrs []dns.RR) []dns.RR {
+	if z.key == nil || len(rrs) == 0 {
+		return rrs
+	}
+
+	sig := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Name: rrs[0].Header().Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: 3600},
+		KeyTag:     z.key.KeyTag(),
+		SignerName: z.origin,
+		Algorithm:  z.key.Algorithm,
+		Inception:  uint32(time.Now().Add(-time.Hour).Unix()),
+		Expiration: uint32(time.Now().Add(time.Hour).Unix()),
+	}
+	if err := sig.Sign(z.priv, rrs); err != nil {
+		panic(err)
+	}
+
+	return append(rrs, sig)
+}
+
+func (z *fakeZone) find(name string, qtype uint16) []dns.RR {
+	return extractType(z.rrs, name, qtype)
+}
+
+func (z *fakeZone) exists(name string) bool {
+	for _, rr := range z.rrs {
+		if strings.EqualFold(rr.Header().Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (z *fakeZone) serve(req *dns.Msg) *dns.Msg {
+	q := req.Question[0]
+	qname := dns.CanonicalName(q.Name)
+
+	m := new(dns.Msg)
+	m.SetReply(req)
+
+	if q.Qtype == dns.TypeDNSKEY && qname == z.origin && z.key != nil {
+		m.Answer = z.sign([]dns.RR{z.key})
+		return m
+	}
+
+	// referrals
+	for _, rr := range z.rrs {
+		cut := dns.CanonicalName(rr.Header().Name)
+		if rr.Header().Rrtype != dns.TypeNS || cut == z.origin || !dns.IsSubDomain(cut, qname) {
+			continue
+		}
+		if q.Qtype == dns.TypeDS && cut == qname {
+			break
+		}
+
+		ns := z.find(cut, dns.TypeNS)
+		m.Ns = append(m.Ns, ns...)
+		if ds := z.find(cut, dns.TypeDS); len(ds) > 0 && cut != z.stripDS {
+			m.Ns = append(m.Ns, z.sign(ds)...)
+		} else {
+			m.Ns = append(m.Ns, z.sign(z.find(cut, dns.TypeNSEC))...)
+		}
+
+		for _, n := range ns {
+			m.Extra = append(m.Extra, z.find(n.(*dns.NS).Ns, dns.TypeA)...)
+		}
+		return m
+	}
+
+	ans := z.find(qname, q.Qtype)
+	if len(ans) == 0 {
+		ans = z.find(qname, dns.TypeCNAME)
+	}
+	m.Answer = z.sign(ans)
+
+	// only unsigned zones answer NXDOMAIN
+	// signed ones would need an NSEC proof
+	if len(ans) == 0 && z.key == nil && !z.exists(qname) {
+		m.Rcode = dns.RcodeNameError
+	}
+
+	if qname == z.tamper {
+		m.Answer[0].(*dns.A).A[3]++
+	}
+
+	return m
+}
+
+func testRecursive(t *testing.T) (*Recursive, *fakeZone) {
+	insecure := newFakeZone(t, "insecure.", false, `
+www.insecure. 300 IN A 127.0.0.3
+`)
+
+	forever := newFakeZone(t, "forever.", true, `
+www.forever. 300 IN A 127.0.0.1
+bad.forever. 300 IN A 127.0.0.2
+alias.forever. 300 IN CNAME www.insecure.
+`)
+	forever.tamper = "bad.forever."
+
+	root := newFakeZone(t, ".", true, `
+forever. 3600 IN NS ns.forever.
+ns.forever. 3600 IN A 10.0.0.1
+forever. 3600 IN NSEC insecure. NS DS RRSIG NSEC
+insecure. 3600 IN NS ns.insecure.
+insecure. 3600 IN NSEC zzz. NS RRSIG NSEC
+ns.insecure. 3600 IN A 10.0.0.2
+`)
+	root.rrs = append(root.rrs, forever.ds())
+
+	servers := map[string]*fakeZone{
+		"127.0.0.1:9591": root,
+		"10.0.0.1:53":    forever,
+		"10.0.0.2:53":    insecure,
+	}
+
+	r := NewRecursive("127.0.0.1:9591")
+	r.SetTrustAnchors([]dns.RR{root.ds()})
+	r.exchange = func(ctx context.Context, m *dns.Msg, a string) (*dns.Msg, time.Duration, error) {
+		z, ok := servers[a]
+		if !ok {
+			return nil, 0, fmt.Errorf("unreachable server %s", a)
+		}
+		return z.serve(m), 0, nil
+	}
+
+	return r, root
+}
+
+func TestRecursive(t *testing.T) {
+	r, _ := testRecursive(t)
+
+	tests := []struct {
+		qname   string
+		records int
+		secure  bool
+		err     error
+	}{
+		{qname: "www.forever.", records: 1, secure: true},
+		{qname: "www.insecure.", records: 1},
+		{qname: "alias.forever.", records: 2},
+		{qname: "bad.forever.", err: resolver.ErrServFail},
+	}
+
+	for _, test := range tests {
+		t.Run(test.qname, func(t *testing.T) {
+			res := r.Query(context.Background(), test.qname, dns.TypeA)
+			if test.err != nil {
+				if !errors.Is(res.Err, test.err) {
+					t.Fatalf("got err = %v, want %v", res.Err, test.err)
+				}
+				return
+			}
+
+			if res.Err != nil {
+				t.Fatal(res.Err)
+			}
+			if len(res.Records) != test.records {
+				t.Fatalf("got records = %d, want %d", len(res.Records), test.records)
+			}
+			if res.Secure != test.secure {
+				t.Fatalf("got secure = %v, want %v", res.Secure, test.secure)
+			}
+		})
+	}
+
+	// exchange tells NXDOMAIN from NODATA
+	for name, rcode := range map[string]int{
+		"missing.insecure.": dns.RcodeNameError,
+		"www.insecure.":     dns.RcodeSuccess,
+	} {
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeMX)
+		m, err := r.Exchange(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Rcode != rcode || len(m.Answer) != 0 {
+			t.Fatalf("got %s rcode = %d answers = %d, want %d and none", name, m.Rcode, len(m.Answer), rcode)
+		}
+
+		// cached
+		if m, _ = r.Exchange(context.Background(), req); m.Rcode != rcode {
+			t.Fatalf("got cached %s rcode = %d, want %d", name, m.Rcode, rcode)
+		}
+	}
+
+	// the trust anchor must match the root key
+	r, _ = testRecursive(t)
+	r.SetTrustAnchors([]dns.RR{testRR(". 3600 IN DS 1234 13 2 7C50EA94A63AEECB65B510D1EAC1846C973A89D4AB292287D5A4D715136B57A3")})
+	if res := r.Query(context.Background(), "www.forever.", dns.TypeA); !errors.Is(res.Err, resolver.ErrServFail) {
+		t.Fatalf("got err = %v, want %v", res.Err, resolver.ErrServFail)
+	}
+}
+
+func TestRecursiveStrippedDS(t *testing.T) {
+	// a referral without the DS of a signed zone and the
+	// parent's NSEC of the delegation instead must not
+	// make the zone insecure
+	r, root := testRecursive(t)
+	root.stripDS = "forever."
+
+	for _, qname := range []string{"www.forever.", "bad.forever."} {
+		res := r.Query(context.Background(), qname, dns.TypeA)
+		if !errors.Is(res.Err, resolver.ErrServFail) {
+			t.Fatalf("got %s err = %v secure = %v, want %v", qname, res.Err, res.Secure, resolver.ErrServFail)
+		}
+	}
+}
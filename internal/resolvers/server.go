@@ -0,0 +1,298 @@
+package resolvers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/miekg/dns"
+	"github.com/randomlogin/sane/resolver"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const serverQueryTimeout = 10 * time.Second
+
+const dohMediaType = "application/dns-message"
+
+// ErrDNSServerClosed is returned by DNSServer.ListenAndServe
+// after a call to Close
+var ErrDNSServerClosed = errors.New("dns: server closed")
+
+type QueryFunc func(ctx context.Context, name string, qtype uint16) *resolver.DNSResult
+
+// the stub resolver used for non hip-5 names
+// only supports caching these types others
+// are forwarded with the handler's exchange
+var supportedQueryTypes = map[uint16]struct{}{
+	dns.TypeA:    {},
+	dns.TypeAAAA: {},
+	dns.TypeTLSA: {},
+}
+
+// DNSHandler answers DNS messages using
+// a resolver query function such as HIP5Resolver.Query
+type DNSHandler struct {
+	query    QueryFunc
+	exchange ExchangeFunc
+}
+
+func NewDNSHandler(query QueryFunc) *DNSHandler {
+	return &DNSHandler{query: query}
+}
+
+// SetExchange sets the resolver unsupported query types are
+// forwarded to it's also asked whether a name without
+// records exists since DNSResult doesn't tell NXDOMAIN
+// from NODATA without it both get an empty NOERROR
+func (h *DNSHandler) SetExchange(exchange ExchangeFunc) {
+	h.exchange = exchange
+}
+
+// Answer creates a reply for the specified request
+func (h *DNSHandler) Answer(ctx context.Context, req *dns.Msg) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.RecursionAvailable = true
+
+	do := false
+	if opt := req.IsEdns0(); opt != nil {
+		do = opt.Do()
+		m.SetEdns0(4096, do)
+	}
+
+	if req.Opcode != dns.OpcodeQuery {
+		m.Rcode = dns.RcodeNotImplemented
+		return m
+	}
+
+	if len(req.Question) != 1 {
+		m.Rcode = dns.RcodeFormatError
+		return m
+	}
+
+	q := req.Question[0]
+	if q.Qclass != dns.ClassINET {
+		m.Rcode = dns.RcodeNotImplemented
+		return m
+	}
+
+	if _, ok := supportedQueryTypes[q.Qtype]; !ok {
+		if h.exchange == nil {
+			m.Rcode = dns.RcodeNotImplemented
+			return m
+		}
+
+		return h.forward(ctx, req, m, do)
+	}
+
+	res := h.query(ctx, dns.CanonicalName(q.Name), q.Qtype)
+	if res.Err != nil {
+		m.Rcode = dns.RcodeServerFailure
+		return m
+	}
+
+	if len(res.Records) == 0 && h.exchange != nil {
+		if r, err := h.exchange(ctx, forwardQuery(q, do)); err == nil && r.Rcode == dns.RcodeNameError {
+			m.Rcode = dns.RcodeNameError
+			m.Ns = r.Ns
+		}
+	}
+
+	// records may be shared with caches
+	// copy them before adjusting TTLs
+	ttl := uint32(getTTL(res.Records).Seconds())
+	for _, rr := range res.Records {
+		rr = dns.Copy(rr)
+		rr.Header().Ttl = ttl
+		m.Answer = append(m.Answer, rr)
+	}
+
+	// RFC6840 5.7 only set the AD bit
+	// if the client asked for it
+	m.AuthenticatedData = res.Secure && (req.AuthenticatedData || do)
+	return m
+}
+
+// forward answers req with the reply
+// of the handler's exchange
+func (h *DNSHandler) forward(ctx context.Context, req, m *dns.Msg, do bool) *dns.Msg {
+	r, err := h.exchange(ctx, forwardQuery(req.Question[0], do))
+	if err != nil {
+		m.Rcode = dns.RcodeServerFailure
+		return m
+	}
+
+	m.Rcode = r.Rcode
+	m.Answer = r.Answer
+	m.Ns = r.Ns
+	m.AuthenticatedData = r.AuthenticatedData && (req.AuthenticatedData || do)
+	return m
+}
+
+func forwardQuery(q dns.Question, do bool) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(q.Name, q.Qtype)
+	m.SetEdns0(4096, do)
+	m.RecursionDesired = true
+	m.AuthenticatedData = true
+	return m
+}
+
+func (h *DNSHandler) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	ctx, cancel := context.WithTimeout(context.Background(), serverQueryTimeout)
+	defer cancel()
+
+	m := h.Answer(ctx, req)
+
+	if _, ok := w.RemoteAddr().(*net.UDPAddr); ok {
+		size := dns.MinMsgSize
+		if opt := req.IsEdns0(); opt != nil && int(opt.UDPSize()) > size {
+			size = int(opt.UDPSize())
+		}
+		m.Truncate(size)
+	}
+
+	_ = w.WriteMsg(m)
+}
+
+// ServeHTTP implements RFC8484 DNS-over-HTTPS
+// for GET and POST requests
+func (h *DNSHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	var raw []byte
+	var err error
+
+	switch req.Method {
+	case http.MethodGet:
+		raw, err = base64.RawURLEncoding.DecodeString(req.URL.Query().Get("dns"))
+		if err != nil {
+			http.Error(rw, "bad dns parameter", http.StatusBadRequest)
+			return
+		}
+	case http.MethodPost:
+		if mt, _, err := mime.ParseMediaType(req.Header.Get("Content-Type")); err != nil || mt != dohMediaType {
+			http.Error(rw, "unsupported content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		if raw, err = io.ReadAll(io.LimitReader(req.Body, dns.MaxMsgSize)); err != nil {
+			http.Error(rw, "failed reading request body", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	msg := new(dns.Msg)
+	if err = msg.Unpack(raw); err != nil {
+		http.Error(rw, "bad dns message", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), serverQueryTimeout)
+	defer cancel()
+
+	m := h.Answer(ctx, msg)
+	out, err := m.Pack()
+	if err != nil {
+		http.Error(rw, "failed packing dns message", http.StatusInternalServerError)
+		return
+	}
+
+	// RFC8484 5.1 freshness lifetime should
+	// not exceed the smallest TTL in the answer
+	switch {
+	case m.Rcode != dns.RcodeSuccess:
+		rw.Header().Set("Cache-Control", "no-store")
+	case len(m.Answer) == 0:
+		rw.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(time.Minute.Seconds())))
+	default:
+		rw.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", m.Answer[0].Header().Ttl))
+	}
+
+	rw.Header().Set("Content-Type", dohMediaType)
+	rw.Write(out)
+}
+
+// DNSServer serves DNSHandler over udp and tcp
+type DNSServer struct {
+	addr    string
+	handler *DNSHandler
+
+	closed bool
+	pc     net.PacketConn
+	l      net.Listener
+	sync.Mutex
+}
+
+func NewDNSServer(addr string, handler *DNSHandler) *DNSServer {
+	return &DNSServer{addr: addr, handler: handler}
+}
+
+func (s *DNSServer) ListenAndServe() error {
+	s.Lock()
+	if s.closed {
+		s.Unlock()
+		return ErrDNSServerClosed
+	}
+
+	var err error
+	if s.pc, err = net.ListenPacket("udp", s.addr); err != nil {
+		s.Unlock()
+		return err
+	}
+	if s.l, err = net.Listen("tcp", s.addr); err != nil {
+		s.pc.Close()
+		s.Unlock()
+		return err
+	}
+
+	udp := &dns.Server{PacketConn: s.pc, Handler: s.handler}
+	tcp := &dns.Server{Listener: s.l, Handler: s.handler}
+	s.Unlock()
+
+	errCh := make(chan error, 2)
+	go func() {
+		errCh <- udp.ActivateAndServe()
+	}()
+	go func() {
+		errCh <- tcp.ActivateAndServe()
+	}()
+
+	// the first failure stops both listeners
+	err = <-errCh
+
+	s.Lock()
+	closed := s.closed
+	s.Unlock()
+
+	s.Close()
+	<-errCh
+
+	if closed {
+		return ErrDNSServerClosed
+	}
+
+	return err
+}
+
+func (s *DNSServer) Close() {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	s.closed = true
+	if s.pc != nil {
+		s.pc.Close()
+	}
+	if s.l != nil {
+		s.l.Close()
+	}
+}
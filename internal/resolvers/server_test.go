@@ -0,0 +1,258 @@
+package resolvers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"github.com/miekg/dns"
+	"github.com/randomlogin/sane/resolver"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDNSHandler_Answer(t *testing.T) {
+	data := map[string]*resolver.DNSResult{
+		"secure.forever.": {
+			Records: []dns.RR{testRR("secure.forever. 300 IN A 127.0.0.1")},
+			Secure:  true,
+		},
+		"insecure.forever.": {
+			Records: []dns.RR{testRR("insecure.forever. 300 IN A 127.0.0.2")},
+		},
+		"fail.forever.": {
+			Err: errors.New("lookup failed"),
+		},
+	}
+
+	h := NewDNSHandler(func(ctx context.Context, name string, qtype uint16) *resolver.DNSResult {
+		if res, ok := data[name]; ok {
+			return res
+		}
+		return &resolver.DNSResult{}
+	})
+
+	tests := []struct {
+		name    string
+		qname   string
+		qtype   uint16
+		do      bool
+		rcode   int
+		answers int
+		ad      bool
+	}{
+		{name: "secure with do bit", qname: "SECURE.forever.", qtype: dns.TypeA, do: true, answers: 1, ad: true},
+		{name: "secure without do bit", qname: "secure.forever.", qtype: dns.TypeA, answers: 1},
+		{name: "insecure", qname: "insecure.forever.", qtype: dns.TypeA, do: true, answers: 1},
+		{name: "no data", qname: "nodata.forever.", qtype: dns.TypeAAAA, do: true},
+		{name: "failure", qname: "fail.forever.", qtype: dns.TypeA, rcode: dns.RcodeServerFailure},
+		{name: "unsupported type", qname: "secure.forever.", qtype: dns.TypeMX, rcode: dns.RcodeNotImplemented},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := new(dns.Msg)
+			req.SetQuestion(test.qname, test.qtype)
+			if test.do {
+				req.SetEdns0(4096, true)
+			}
+
+			m := h.Answer(context.Background(), req)
+			if m.Rcode != test.rcode {
+				t.Fatalf("got rcode = %d, want %d", m.Rcode, test.rcode)
+			}
+			if m.Id != req.Id {
+				t.Fatalf("got id = %d, want %d", m.Id, req.Id)
+			}
+			if len(m.Answer) != test.answers {
+				t.Fatalf("got answers = %d, want %d", len(m.Answer), test.answers)
+			}
+			if m.AuthenticatedData != test.ad {
+				t.Fatalf("got ad = %v, want %v", m.AuthenticatedData, test.ad)
+			}
+		})
+	}
+}
+
+func TestDNSHandler_Exchange(t *testing.T) {
+	// upstream knows mx records and which names exist
+	upstream := NewDNSHandler(func(ctx context.Context, name string, qtype uint16) *resolver.DNSResult {
+		return &resolver.DNSResult{}
+	})
+	upstream.SetExchange(func(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+		r := new(dns.Msg)
+		r.SetReply(m)
+		switch m.Question[0].Name {
+		case "mail.forever.":
+			r.Answer = []dns.RR{testRR("mail.forever. 300 IN MX 10 mx.mail.forever.")}
+			r.AuthenticatedData = true
+		case "nodata.forever.":
+		default:
+			r.Rcode = dns.RcodeNameError
+		}
+		return r, nil
+	})
+
+	srv := httptest.NewServer(upstream)
+	defer srv.Close()
+
+	exchange, err := NewForwarder(srv.URL + "/dns-query")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewDNSHandler(func(ctx context.Context, name string, qtype uint16) *resolver.DNSResult {
+		return &resolver.DNSResult{}
+	})
+	h.SetExchange(exchange)
+
+	tests := []struct {
+		name    string
+		qname   string
+		qtype   uint16
+		rcode   int
+		answers int
+		ad      bool
+	}{
+		{name: "forwarded type", qname: "mail.forever.", qtype: dns.TypeMX, answers: 1, ad: true},
+		{name: "forwarded nxdomain", qname: "missing.forever.", qtype: dns.TypeTXT, rcode: dns.RcodeNameError},
+		{name: "nxdomain", qname: "missing.forever.", qtype: dns.TypeA, rcode: dns.RcodeNameError},
+		{name: "no data", qname: "nodata.forever.", qtype: dns.TypeA},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := new(dns.Msg)
+			req.SetQuestion(test.qname, test.qtype)
+			req.SetEdns0(4096, true)
+
+			m := h.Answer(context.Background(), req)
+			if m.Rcode != test.rcode {
+				t.Fatalf("got rcode = %d, want %d", m.Rcode, test.rcode)
+			}
+			if len(m.Answer) != test.answers {
+				t.Fatalf("got answers = %d, want %d", len(m.Answer), test.answers)
+			}
+			if m.AuthenticatedData != test.ad {
+				t.Fatalf("got ad = %v, want %v", m.AuthenticatedData, test.ad)
+			}
+		})
+	}
+}
+
+func TestDNSHandler_ServeHTTP(t *testing.T) {
+	h := NewDNSHandler(func(ctx context.Context, name string, qtype uint16) *resolver.DNSResult {
+		return &resolver.DNSResult{
+			Records: []dns.RR{
+				testRR(name + " 600 IN A 127.0.0.1"),
+				testRR(name + " 300 IN A 127.0.0.2"),
+			},
+			Secure: true,
+		}
+	})
+
+	q := new(dns.Msg)
+	q.SetQuestion("example.forever.", dns.TypeA)
+	q.SetEdns0(4096, true)
+	raw, err := q.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := httptest.NewRequest(http.MethodGet, "/dns-query?dns="+base64.RawURLEncoding.EncodeToString(raw), nil)
+	post := httptest.NewRequest(http.MethodPost, "/dns-query", bytes.NewReader(raw))
+	post.Header.Set("Content-Type", dohMediaType)
+	// media type parameters are allowed
+	postParams := httptest.NewRequest(http.MethodPost, "/dns-query", bytes.NewReader(raw))
+	postParams.Header.Set("Content-Type", "Application/DNS-Message; charset=binary")
+
+	for _, req := range []*http.Request{get, post, postParams} {
+		t.Run(req.Method, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			res := rec.Result()
+			if res.StatusCode != http.StatusOK {
+				t.Fatalf("got status = %d, want %d", res.StatusCode, http.StatusOK)
+			}
+			if ct := res.Header.Get("Content-Type"); ct != dohMediaType {
+				t.Fatalf("got content type = %s, want %s", ct, dohMediaType)
+			}
+			if cc := res.Header.Get("Cache-Control"); cc != "max-age=300" {
+				t.Fatalf("got cache control = %s, want max-age=300", cc)
+			}
+
+			body, _ := io.ReadAll(res.Body)
+			m := new(dns.Msg)
+			if err := m.Unpack(body); err != nil {
+				t.Fatal(err)
+			}
+			if !m.AuthenticatedData {
+				t.Fatal("want ad bit")
+			}
+			for _, rr := range m.Answer {
+				if rr.Header().Ttl != 300 {
+					t.Fatalf("got ttl = %d, want 300", rr.Header().Ttl)
+				}
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/dns-query", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("got status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+
+	rec = httptest.NewRecorder()
+	badType := httptest.NewRequest(http.MethodPost, "/dns-query", bytes.NewReader(raw))
+	badType.Header.Set("Content-Type", "application/json")
+	h.ServeHTTP(rec, badType)
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("got status = %d, want %d", rec.Code, http.StatusUnsupportedMediaType)
+	}
+}
+
+func TestDNSServer(t *testing.T) {
+	h := NewDNSHandler(func(ctx context.Context, name string, qtype uint16) *resolver.DNSResult {
+		return &resolver.DNSResult{
+			Records: []dns.RR{testRR(name + " 300 IN A 127.0.0.1")},
+		}
+	})
+
+	s := NewDNSServer("127.0.0.1:0", h)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.ListenAndServe()
+	}()
+
+	// wait for the listeners
+	var addr string
+	for addr == "" {
+		s.Lock()
+		if s.l != nil {
+			addr = s.l.Addr().String()
+		}
+		s.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion("example.forever.", dns.TypeA)
+	c := &dns.Client{Net: "tcp"}
+	r, _, err := c.Exchange(req, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Answer) != 1 {
+		t.Fatalf("got answers = %d, want 1", len(r.Answer))
+	}
+
+	s.Close()
+	if err := <-errCh; !errors.Is(err, ErrDNSServerClosed) {
+		t.Fatalf("got err = %v, want %v", err, ErrDNSServerClosed)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/miekg/dns"
 	"golang.org/x/crypto/sha3"
 	"golang.org/x/net/idna"
+	"sort"
 	"strings"
 	"time"
 )
@@ -197,3 +198,44 @@ func getTTL(rrs []dns.RR) time.Duration {
 
 	return time.Duration(ttl) * time.Second
 }
+
+// dnsEncode returns name in DNS wire format
+// as expected by ENSIP-10 resolve(bytes,bytes)
+func dnsEncode(name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+
+	var b []byte
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			if len(label) == 0 || len(label) > 255 {
+				return nil, fmt.Errorf("error encoding name `%s`: bad label length", name)
+			}
+
+			b = append(b, byte(len(label)))
+			b = append(b, label...)
+		}
+	}
+
+	return append(b, 0), nil
+}
+
+func dsKeyTags(ds []dns.RR) []uint16 {
+	var tags []uint16
+	for _, rr := range ds {
+		if d, ok := rr.(*dns.DS); ok {
+			tags = append(tags, d.KeyTag)
+		}
+	}
+
+	return tags
+}
+
+func keyTags(keys map[uint16]*dns.DNSKEY) []uint16 {
+	tags := make([]uint16, 0, len(keys))
+	for tag := range keys {
+		tags = append(tags, tag)
+	}
+
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+	return tags
+}
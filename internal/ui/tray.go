@@ -19,16 +19,19 @@ var (
 	OnStop          func()
 	OnReady         func()
 	OnBackendChoice func(backend string)
+	OnRegenerateCA  func()
 	Data            State
-
-	LetsdaneHandler func()
-	SaneHandler     func()
 )
 
 func Loop() {
 	systray.Run(Data.initMenu, OnExit)
 }
 
+// Quit exits Loop calling OnExit
+func Quit() {
+	systray.Quit()
+}
+
 type State struct {
 	started     bool
 	runToggle   *systray.MenuItem
@@ -37,8 +40,9 @@ type State struct {
 	backend     *systray.MenuItem
 	quit        *systray.MenuItem
 
-	autoConfig *systray.MenuItem
-	openSetup  *systray.MenuItem
+	autoConfig   *systray.MenuItem
+	regenerateCA *systray.MenuItem
+	openSetup    *systray.MenuItem
 
 	sync.RWMutex
 }
@@ -137,6 +141,7 @@ func (s *State) initMenu() {
 	letsdaneChoice := s.backend.AddSubMenuItemCheckbox("Letsdane", "", false)
 	saneChoice := s.backend.AddSubMenuItemCheckbox("Stateless DANE", "", false)
 
+	s.regenerateCA = s.options.AddSubMenuItem("Regenerate certificate", "")
 	s.openSetup = s.options.AddSubMenuItem("Help", "")
 
 	s.quit = systray.AddMenuItem("Quit", "")
@@ -166,23 +171,15 @@ func (s *State) initMenu() {
 			case <-s.autoConfig.ClickedCh:
 				s.SetAutoConfig(OnConfigureOS(s.autoConfig.Checked()))
 			case <-letsdaneChoice.ClickedCh:
-				started := s.Started()
 				letsdaneChoice.Check()
 				saneChoice.Uncheck()
 				OnBackendChoice("letsdane")
-				OnStart = LetsdaneHandler
-				if started {
-					OnStart()
-				}
 			case <-saneChoice.ClickedCh:
-				started := s.Started()
 				saneChoice.Check()
 				letsdaneChoice.Uncheck()
 				OnBackendChoice("sane")
-				OnStart = SaneHandler
-				if started {
-					OnStart()
-				}
+			case <-s.regenerateCA.ClickedCh:
+				OnRegenerateCA()
 			case <-s.openSetup.ClickedCh:
 				OnOpenHelp()
 				continue
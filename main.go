@@ -5,11 +5,10 @@ import (
 	"errors"
 	"fingertip/internal/config"
 	"fingertip/internal/config/auto"
+	"fingertip/internal/metrics"
 	"fingertip/internal/resolvers"
 	"fingertip/internal/resolvers/proc"
 	"flag"
-
-	"fingertip/internal/ui"
 	"fmt"
 	"log"
 	"net/http"
@@ -19,7 +18,6 @@ import (
 	"time"
 
 	"github.com/emersion/go-autostart"
-	"github.com/pkg/browser"
 	"github.com/randomlogin/sane"
 	"github.com/randomlogin/sane/resolver"
 	"github.com/randomlogin/sane/sync"
@@ -30,18 +28,27 @@ const Version = "0.0.4-beta2"
 type App struct {
 	proc             *proc.HNSProc
 	server           *http.Server
+	dnsServer        *resolvers.DNSServer
 	config           *config.App
 	usrConfig        *config.User
 	proxyURL         string
 	autostart        *autostart.App
 	autostartEnabled bool
 	cancel           func()
+	// optional resolver cache kept across
+	// restarts nil if disabled
+	cache      *resolvers.DiskCache
+	run        runState
+	autoConfig autoConfigState
 }
 
 var (
 	appPath          string
 	fileLogger       *log.Logger
 	fileLoggerHandle *os.File
+
+	hnsdRestarts = metrics.Default.NewCounterVec("fingertip_hnsd_restarts_total",
+		"Restarts of the hnsd process after a crash")
 )
 
 func setupApp() *App {
@@ -71,88 +78,42 @@ func onBoardingSeen(name string) bool {
 	return false
 }
 
-func (app *App) setRecursiveAddress() {
-	if app.config.Store.Backend == "sane" {
-		app.usrConfig.RecursiveAddr = config.DefaultDOHUrl
-	} else {
-		app.usrConfig.RecursiveAddr = config.DefaultRecursiveAddr
+// setRecursiveAddress creates the hnsd process and proxy
+// server for the configured backend
+func (app *App) setRecursiveAddress() error {
+	// the built-in resolver doesn't need a doh server
+	recursiveAddr := config.DefaultRecursiveAddr
+	if app.config.Store.Backend == "sane" && !app.usrConfig.NativeRecursion {
+		recursiveAddr = config.DefaultDOHUrl
 	}
-	serv, err := app.newProxyServer()
+
+	hnsProc, err := proc.NewHNSProc(app.config.DNSProcPath, app.usrConfig.RootAddr, recursiveAddr)
 	if err != nil {
-		log.Fatal(err)
-	}
-	app.server = serv
-	var hnsProc *proc.HNSProc
-	if hnsProc, err = proc.NewHNSProc(app.config.DNSProcPath, app.usrConfig.RootAddr, app.usrConfig.RecursiveAddr); err != nil {
-		log.Fatal(err)
+		return err
 	}
 	hnsProc.SetUserAgent("fingertip:" + Version)
-	app.proc = hnsProc
-}
-
-func autoConfigure(app *App, checked, onBoarded bool) bool {
-	// TODO: delete once linux is supported
-	if !auto.Supported() {
-		if !onBoarded {
-			browser.OpenURL(app.proxyURL + "/setup")
-		}
-		return false
-	}
 
-	autoURL := app.proxyURL + "/proxy.pac"
-
-	if checked {
-		confirm := ui.ShowYesNoDlg("Remove Fingertip configuration settings?")
-		if confirm {
-			auto.UninstallAutoProxy(autoURL)
-			auto.UndoFirefoxConfiguration()
-			_ = auto.UninstallCert(app.config.CertPath)
-			return false
-		}
-
-		return checked
-	}
-
-	confirm := ui.ShowYesNoDlg("Would you like to automatically configure Fingertip?")
-	if !confirm {
-		// if this is the first time show
-		// manual setup instructions instead
-		if !onBoarded {
-			browser.OpenURL(app.proxyURL + "/setup")
-		}
-		return false
-	}
-
-	if err := auto.InstallAutoProxy(autoURL); err != nil {
-		ui.ShowErrorDlg(err.Error())
-		return false
-	}
-
-	_ = auto.ConfigureFirefox()
-
-	if err := auto.InstallCert(app.config.CertPath); err != nil {
-		// revert proxy settings
-		auto.UninstallAutoProxy(autoURL)
-		auto.UndoFirefoxConfiguration()
-
-		ui.ShowErrorDlg(err.Error())
-		return false
-	}
-
-	// Enable open at login
-	if !ui.Data.OpenAtLogin() {
-		enable := ui.OnAutostart(false)
-		ui.Data.SetOpenAtLogin(enable)
+	prevAddr := app.usrConfig.RecursiveAddr
+	app.usrConfig.RecursiveAddr = recursiveAddr
+	serv, err := app.newProxyServer()
+	if err != nil {
+		app.usrConfig.RecursiveAddr = prevAddr
+		return err
 	}
 
-	if time.Since(app.config.Debug.GetLastPing()) > 5*time.Second {
-		browser.OpenURL(app.proxyURL)
-	}
-	return true
+	app.server = serv
+	app.proc = hnsProc
+	return nil
 }
 
 func main() {
 	showVersion := flag.Bool("version", false, "Print the version and exit")
+	headless := flag.Bool("headless", false, "Run without the system tray logging to stdout")
+	flag.Usage = func() {
+		commandUsage()
+		fmt.Fprintf(os.Stderr, "\nFlags:\n")
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
 	if *showVersion {
@@ -160,6 +121,11 @@ func main() {
 		os.Exit(0)
 	}
 
+	// subcommands query a running instance
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(flag.Args()))
+	}
+
 	var err error
 	app := setupApp()
 	if fileLoggerHandle, err = os.OpenFile(path.Join(app.config.Path, "fingertip.logs"),
@@ -180,243 +146,38 @@ func main() {
 		app.autostartEnabled = true
 	}
 
-	serverErrCh := make(chan error)
-	onBoardingFilename := path.Join(app.config.Path, "init")
-	onBoarded := onBoardingSeen(onBoardingFilename)
-
-	ui.InitializeTray = func() string {
-		backend := app.config.Store.Backend
-		if backend == "" {
-			return "sane"
-		}
-		return backend
-	}
-
-	hnsdPath, err := getProcPath()
-	if err != nil {
-		log.Fatal(err)
-	}
-	hnsdPath = path.Join(hnsdPath, "/hnsd")
-
 	app.config.Debug.SetCheckBackend(func() string { return app.config.Store.Backend })
-
-	saneHandler := func() {
-		ui.Data.SetOptionsEnabled(true)
-		ui.Data.SetStarted(true)
-
-		ctx, cancel := context.WithCancel(context.Background())
-		app.cancel = cancel
-		go func() {
-			serverErrCh <- app.listen()
-		}()
-
-		go func() {
-			if onBoarded {
-				return
-			}
-
-			autoConf := autoConfigure(app, false, false)
-			ui.Data.SetAutoConfig(autoConf)
-
-			app.config.Store.AutoConfig = autoConf
-			go app.config.Store.Save()
-
-			onBoarded = true
-		}()
-
-		//TODO check sync state gracefully
-		go func() {
-			app.config.Debug.SetCheckSynced(func() bool { return false }) //perhaps not the best way to show syncing status correctly
-			sync.GetRoots(ctx, hnsdPath, app.config.Path, app.config.Path)
-			app.config.Debug.SetCheckSynced(func() bool { return true })
-			go func() {
-				for {
-					time.Sleep(24 * time.Hour)
-					sync.GetRoots(ctx, hnsdPath, app.config.Path, app.config.Path)
-				}
-			}()
-		}()
-	}
-
-	hnsErrCh := make(chan error)
-	handleLetsdaneProcesses := func() {
-		ticker := time.NewTicker(150 * time.Millisecond)
-		for {
-			select {
-			case err := <-serverErrCh:
-				if errors.Is(err, http.ErrServerClosed) {
-					continue
-				}
-
-				ui.ShowErrorDlg(err.Error())
-				log.Printf("[ERR] app: proxy server failed: %v", err)
-
-				app.stop()
-				ui.Data.SetStarted(false)
-			case err := <-hnsErrCh:
-				if !app.proc.Started() {
-					continue
-				}
-
-				// hns process crashed attempt to restart
-				// TODO: check if port is already in use
-				attempts := app.proc.Retries()
-				if attempts > 9 {
-					err := fmt.Errorf("[ERR] app: fatal error hnsd process keeps crashing err: %v", err)
-					ui.ShowErrorDlg(err.Error())
-					app.stop()
-					log.Fatal(err)
-				}
-
-				// log to a file could be useful for debugging
-				line := fmt.Sprintf("[ERR] app: hnsd process crashed restart attempt #%d err: %v", attempts, err)
-				// log.Printf(line)
-				fileLogger.Printf(line)
-
-				// increment retries and restart process
-				app.proc.IncrementRetries()
-				app.proc.Stop()
-				app.proc.Start(hnsErrCh)
-
-			case <-ticker.C:
-				if !app.proc.Started() {
-					ui.Data.SetBlockHeight("--")
-					app.config.Debug.SetBlockHeight(0)
-					continue
-				}
-
-				height := app.proc.GetHeight()
-				ui.Data.SetBlockHeight(fmt.Sprintf("#%d", height))
-				app.config.Debug.SetBlockHeight(height)
-			}
-
-		}
-	}
-
-	letsdaneHandler := func() {
-		log.Print("app proc in letsdane handler", app.proc)
-		app.proc.Start(hnsErrCh)
-		app.config.Debug.SetCheckSynced(app.proc.Synced)
-		ui.Data.SetOptionsEnabled(true)
-		ui.Data.SetStarted(true)
-
-		go handleLetsdaneProcesses()
-		go func() {
-			serverErrCh <- app.listen()
-		}()
-
-		go func() {
-			if onBoarded {
-				return
-			}
-
-			autoConf := autoConfigure(app, false, false)
-			ui.Data.SetAutoConfig(autoConf)
-
-			app.config.Store.AutoConfig = autoConf
-			go app.config.Store.Save()
-
-			onBoarded = true
-		}()
-
-	}
-
-	ui.LetsdaneHandler = letsdaneHandler
-	ui.SaneHandler = saneHandler
-
-	setBackend := func() {
-		if app.config.Store.Backend == "letsdane" {
-			ui.OnStart = letsdaneHandler
-		} else {
-			ui.OnStart = saneHandler
-		}
-	}
-
-	setBackend()
-
-	// setRecursiveAddress := func() {
-	// 	if app.config.Store.Backend == "sane" {
-	// 		app.usrConfig.RecursiveAddr = config.DefaultDOHUrl
-	// 	} else {
-	// 		app.usrConfig.RecursiveAddr = config.DefaultRecursiveAddr
-	// 	}
-	//
-	// }
-	// setRecursiveAddress()
-
-	ui.OnBackendChoice = func(backend string) {
-		ui.OnStop()
-		app.config.Store.Backend = backend
-		app.config.Store.Save()
-		setBackend()
-		app.setRecursiveAddress()
-	}
-
-	ui.OnConfigureOS = func(checked bool) bool {
-		res := autoConfigure(app, checked, onBoarded)
-		app.config.Store.AutoConfig = res
-		go app.config.Store.Save()
-
-		return res
-	}
-
-	ui.OnOpenHelp = func() {
-		browser.OpenURL(app.proxyURL)
-	}
-
-	ui.OnAutostart = func(checked bool) bool {
-		if checked {
-			if err := app.autostart.Disable(); err != nil {
-				ui.ShowErrorDlg(fmt.Sprintf("error disabling open at login: %v", err))
-				return checked
-			}
-			return false
-		}
-
-		if err = app.autostart.Enable(); err != nil {
-			ui.ShowErrorDlg(fmt.Sprintf("error enabling open at login: %v", err))
-			return false
-		}
-
-		return true
-	}
-
-	ui.OnStop = func() {
-		app.stop()
-		// ui.Data.SetOptionsEnabled(false)
-		ui.Data.SetStarted(false)
-	}
-
-	ui.OnReady = func() {
-		ui.Data.SetAutoConfigEnabled(auto.Supported())
-		ui.Data.SetOptionsEnabled(false)
-		app.config.Debug.SetCheckCert(func() bool {
-			return auto.VerifyCert(app.config.CertPath) == nil
-		})
-		// update initial state
-		ui.Data.SetOpenAtLogin(app.autostartEnabled || ui.Data.OpenAtLogin())
-
-		autoConfig := auto.Supported() &&
-			app.config.Store.AutoConfig
-
-		ui.Data.SetAutoConfig(autoConfig)
-
-		// start fingertip
-		if app.config.Store.Backend == "letsdane" {
-			letsdaneHandler()
-		} else {
-			saneHandler()
-		}
+	app.config.Debug.SetCheckCert(func() bool {
+		return auto.VerifyCert(app.config.CertPath) == nil
+	})
+
+	// the CA is only replaced once an unfinished
+	// auto configuration has been reverted
+	app.recoverAutoConfig()
+	go app.watchCA()
+
+	app.run.serverErrCh = make(chan error, 1)
+	app.run.hnsErrCh = make(chan error)
+	fatal := make(chan error, 1)
+	go func() {
+		fatal <- app.supervise()
+	}()
+
+	// keep running without the api if it
+	// can't be served
+	controlServer, err := app.serveControl()
+	if err != nil {
+		log.Printf("[ERR] app: control api unavailable: %v", err)
+	} else {
+		defer controlServer.Close()
 	}
 
-	ui.OnExit = func() {
-		if fileLoggerHandle != nil {
-			fileLoggerHandle.Close()
-		}
-		app.stop()
+	if *headless {
+		runHeadless(app, fatal)
+		return
 	}
 
-	ui.Loop()
+	runTray(app, controlServer != nil, fatal)
 }
 
 func NewApp(appConfig *config.App) (*App, error) {
@@ -439,59 +200,177 @@ func NewApp(appConfig *config.App) (*App, error) {
 
 	app.proxyURL = config.GetProxyURL(usrConfig.ProxyAddr)
 	app.usrConfig = &usrConfig
-	app.setRecursiveAddress()
+	auto.UseSystemTrustStore = usrConfig.SystemTrustStore
+	auto.UseBrowserPolicies = usrConfig.BrowserPolicies
 
-	app.server, err = app.newProxyServer()
-	if err != nil {
+	if usrConfig.PersistentCache {
+		cachePath := path.Join(appConfig.Path, "resolver_cache.json")
+		if app.cache, err = resolvers.OpenDiskCache(cachePath, resolvers.DefaultDiskCacheSize); err != nil {
+			log.Printf("app: resolver cache disabled: %v", err)
+		}
+	}
+
+	if usrConfig.QueryLog {
+		logPath := path.Join(appConfig.Path, "queries.jsonl")
+		if app.config.QueryLog, err = resolvers.NewQueryLog(logPath, 1000); err != nil {
+			log.Printf("app: query log disabled: %v", err)
+		}
+	}
+
+	if err := app.setRecursiveAddress(); err != nil {
 		return nil, err
 	}
 
 	return app, nil
 }
 
-func (a *App) NewResolver() (resolver.Resolver, error) {
-	rs, err := resolver.NewStub(a.usrConfig.RecursiveAddr)
-	if err != nil {
-		return nil, err
+// NewResolver creates the resolver used by the proxy and the exchange
+// function dns clients' other query types are forwarded to
+func (a *App) NewResolver() (*resolvers.HIP5Resolver, resolvers.ExchangeFunc, error) {
+	var rs *resolver.Stub
+	var rec *resolvers.Recursive
+	var exchange resolvers.ExchangeFunc
+	var err error
+
+	if a.usrConfig.NativeRecursion {
+		rec = resolvers.NewRecursive(a.usrConfig.RootAddr)
+		rs = &resolver.Stub{DefaultResolver: rec.DefaultResolver}
+		exchange = rec.Exchange
+	} else if rs, err = resolver.NewStub(a.usrConfig.RecursiveAddr); err != nil {
+		return nil, nil, err
+	} else if exchange, err = resolvers.NewForwarder(a.usrConfig.RecursiveAddr); err != nil {
+		return nil, nil, err
 	}
 
 	hip5 := resolvers.NewHIP5Resolver(rs, a.usrConfig.RootAddr, func() bool { return true })
-	ethExt, err := resolvers.NewEthereum(a.usrConfig.EthereumEndpoint)
+	extensions, err := resolvers.LoadRegistry(a.usrConfig.Extensions, config.Setting)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	// Register HIP-5 handlers
-	hip5.RegisterHandler("_eth", ethExt.Handler)
+	// Register HIP-5 extensions
+	hip5.SetExtensions(extensions)
+
+	// cached answers depend on the backend
+	// used to resolve them
+	if a.cache != nil {
+		a.cache.SetBackend(fmt.Sprintf("%s;%s;%v", a.config.Store.Backend, a.usrConfig.RecursiveAddr, a.usrConfig.NativeRecursion))
+		hip5.SetDiskCache(a.cache)
+		extensions.SetDiskCache(a.cache)
+	}
+	a.config.Debug.SetCheckExtensions(extensions.Health)
+	a.config.Debug.SetCacheStats(func() map[string]resolvers.CacheStats {
+		stats := hip5.CacheStats()
+		if rec != nil {
+			for name, s := range rec.CacheStats() {
+				stats["recursive."+name] = s
+			}
+		}
+		return stats
+	})
 	hip5.SetQueryMiddleware(a.config.Debug.GetDNSProbeMiddleware())
+	hip5.SetMetricsNames(a.usrConfig.MetricsNames)
+	if a.config.QueryLog != nil {
+		hip5.SetQueryLog(a.config.QueryLog)
+	}
 
-	return hip5, nil
+	return hip5, exchange, nil
 }
 
-func (a *App) listen() error {
-	return a.server.ListenAndServe()
+func listen(server *http.Server, dnsServer *resolvers.DNSServer) error {
+	if dnsServer == nil {
+		return server.ListenAndServe()
+	}
+
+	errCh := make(chan error, 2)
+	go func() {
+		errCh <- server.ListenAndServe()
+	}()
+	go func() {
+		if err := dnsServer.ListenAndServe(); !errors.Is(err, resolvers.ErrDNSServerClosed) {
+			errCh <- fmt.Errorf("dns server failed: %w", err)
+		}
+	}()
+
+	return <-errCh
 }
 
-func (a *App) stop() {
+// halt stops hnsd and the proxy
+func (a *App) halt() {
 	a.proc.Stop()
 	a.server.Close()
+	if a.dnsServer != nil {
+		a.dnsServer.Close()
+	}
 	a.cancel()
+}
 
-	// on stop create a new server
-	// to reset any state like old cache ... etc.
-	var err error
-	if a.server, err = a.newProxyServer(); err != nil {
-		log.Fatalf("app: error creating a new proxy server: %v", err)
+// closeStorage saves the resolver cache
+// and closes the query log on exit
+func (a *App) closeStorage() {
+	if err := a.cache.Close(); err != nil {
+		log.Printf("app: error saving resolver cache: %v", err)
 	}
+	a.config.QueryLog.Close()
 }
 
-func (a *App) newProxyServer() (*http.Server, error) {
-	var err error
+// restartHNSD restarts a crashed hnsd process
+// failing once it keeps crashing
+func (a *App) restartHNSD(err error, errCh chan error) error {
+	// TODO: check if port is already in use
+	attempts := a.proc.Retries()
+	if attempts > 9 {
+		return fmt.Errorf("[ERR] app: fatal error hnsd process keeps crashing err: %v", err)
+	}
+
+	// log to a file could be useful for debugging
+	line := fmt.Sprintf("[ERR] app: hnsd process crashed restart attempt #%d err: %v", attempts, err)
+	fileLogger.Printf(line)
 
+	// increment retries and restart process
+	a.proc.IncrementRetries()
+	hnsdRestarts.Inc()
+	a.proc.Stop()
+	a.proc.Start(errCh)
+	return nil
+}
+
+// syncRoots syncs sane tree roots then
+// again every day until ctx is canceled
+func (a *App) syncRoots(ctx context.Context) {
+	a.syncRootsOnce(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(24 * time.Hour):
+			sync.GetRoots(ctx, a.config.DNSProcPath, a.config.Path, a.config.Path)
+		}
+	}
+}
+
+func (a *App) syncRootsOnce(ctx context.Context) {
+	//TODO check sync state gracefully
+	a.config.Debug.SetCheckSynced(func() bool { return false }) //perhaps not the best way to show syncing status correctly
+	sync.GetRoots(ctx, a.config.DNSProcPath, a.config.Path, a.config.Path)
+	a.config.Debug.SetCheckSynced(func() bool { return true })
+}
+
+func (a *App) newProxyServer() (*http.Server, error) {
 	// add a new resolver to the proxy config
-	if a.config.Proxy.Resolver, err = a.NewResolver(); err != nil {
+	hip5, exchange, err := a.NewResolver()
+	if err != nil {
 		return nil, err
 	}
+	a.config.Proxy.Resolver = hip5
+	a.config.DNSHandler = resolvers.NewDNSHandler(hip5.Query)
+	a.config.DNSHandler.SetExchange(exchange)
+
+	// optional dns server using the same resolver
+	a.dnsServer = nil
+	if a.usrConfig.DNSAddr != "" {
+		a.dnsServer = resolvers.NewDNSServer(a.usrConfig.DNSAddr, a.config.DNSHandler)
+	}
 
 	// initialize a new handler
 	h, err := a.config.Proxy.NewHandler()
@@ -499,9 +378,15 @@ func (a *App) newProxyServer() (*http.Server, error) {
 		return nil, err
 	}
 
+	// serve names answered by content extensions
+	ch, err := a.config.NewContentProxy(h, hip5.LookupContent)
+	if err != nil {
+		return nil, err
+	}
+
 	// copy proxy address from user specified config
 	a.config.ProxyAddr = a.usrConfig.ProxyAddr
-	server := &http.Server{Addr: a.config.ProxyAddr, Handler: h}
+	server := &http.Server{Addr: a.config.ProxyAddr, Handler: ch}
 	return server, nil
 }
 
@@ -0,0 +1,272 @@
+//go:build !headless
+
+package main
+
+import (
+	"fingertip/internal/config/auto"
+	"fingertip/internal/control"
+	"fingertip/internal/ui"
+	"fmt"
+	"log"
+	"path"
+	"time"
+
+	"github.com/pkg/browser"
+)
+
+// trayClient the control api operations used by the tray
+type trayClient interface {
+	Status() (control.Status, error)
+	Start() (control.Status, error)
+	Stop() (control.Status, error)
+	SetBackend(backend string) (control.Status, error)
+	ConfigureOS(enable bool) (control.Status, error)
+	RegenerateCA() (control.Status, error)
+}
+
+// localClient calls the app directly when
+// the control api isn't served
+type localClient struct {
+	app *App
+}
+
+func (c localClient) do(err error) (control.Status, error) {
+	return c.app.Status(), err
+}
+
+func (c localClient) Status() (control.Status, error) {
+	return c.app.Status(), nil
+}
+
+func (c localClient) Start() (control.Status, error) {
+	return c.do(c.app.Start())
+}
+
+func (c localClient) Stop() (control.Status, error) {
+	return c.do(c.app.Stop())
+}
+
+func (c localClient) SetBackend(backend string) (control.Status, error) {
+	return c.do(c.app.SetBackend(backend))
+}
+
+func (c localClient) ConfigureOS(enable bool) (control.Status, error) {
+	return c.do(c.app.ConfigureOS(enable))
+}
+
+func (c localClient) RegenerateCA() (control.Status, error) {
+	return c.do(c.app.RegenerateCA())
+}
+
+// newTrayClient a client of the control api
+// or the app itself if it isn't served
+func newTrayClient(app *App, served bool) trayClient {
+	if !served {
+		return localClient{app}
+	}
+
+	client, err := control.NewClient(app.config.Path)
+	if err != nil {
+		log.Printf("[ERR] app: tray not using the control api: %v", err)
+		return localClient{app}
+	}
+
+	return client
+}
+
+func autoConfigure(app *App, client trayClient, checked, onBoarded bool) bool {
+	if !auto.Supported() {
+		if !onBoarded {
+			browser.OpenURL(app.proxyURL + "/setup")
+		}
+		return false
+	}
+
+	if checked {
+		confirm := ui.ShowYesNoDlg("Remove Fingertip configuration settings?")
+		if confirm {
+			if _, err := client.ConfigureOS(false); err != nil {
+				ui.ShowErrorDlg(err.Error())
+			}
+			return false
+		}
+
+		return checked
+	}
+
+	confirm := ui.ShowYesNoDlg("Would you like to automatically configure Fingertip?")
+	if !confirm {
+		// if this is the first time show
+		// manual setup instructions instead
+		if !onBoarded {
+			browser.OpenURL(app.proxyURL + "/setup")
+		}
+		return false
+	}
+
+	if _, err := client.ConfigureOS(true); err != nil {
+		ui.ShowErrorDlg(err.Error())
+		return false
+	}
+
+	// Enable open at login
+	if !ui.Data.OpenAtLogin() {
+		enable := ui.OnAutostart(false)
+		ui.Data.SetOpenAtLogin(enable)
+	}
+
+	if time.Since(app.config.Debug.GetLastPing()) > 5*time.Second {
+		browser.OpenURL(app.proxyURL)
+	}
+	return true
+}
+
+// watchStatus keeps the tray in sync with
+// changes made by other control api clients
+func watchStatus(client trayClient) {
+	warned := ""
+	for range time.Tick(time.Second) {
+		st, err := client.Status()
+		if err != nil {
+			continue
+		}
+
+		if st.CAWarning != "" && st.CAWarning != warned {
+			warned = st.CAWarning
+			go ui.ShowErrorDlg(st.CAWarning)
+		}
+
+		ui.Data.SetStarted(st.Started)
+		if st.BlockHeight == 0 {
+			ui.Data.SetBlockHeight("--")
+			continue
+		}
+
+		ui.Data.SetBlockHeight(fmt.Sprintf("#%d", st.BlockHeight))
+	}
+}
+
+// runTray runs fingertip from the system tray
+// a client of the control api if served until
+// quit or a fatal error
+func runTray(app *App, served bool, fatal <-chan error) {
+	onBoardingFilename := path.Join(app.config.Path, "init")
+	onBoarded := onBoardingSeen(onBoardingFilename)
+
+	client := newTrayClient(app, served)
+
+	app.setOnError(func(err error) {
+		ui.ShowErrorDlg(err.Error())
+	})
+
+	ui.InitializeTray = func() string {
+		st, err := client.Status()
+		if err != nil || st.Backend == "" {
+			return "sane"
+		}
+		return st.Backend
+	}
+
+	ui.OnStart = func() {
+		if _, err := client.Start(); err != nil {
+			ui.ShowErrorDlg(err.Error())
+			ui.Data.SetStarted(false)
+			return
+		}
+
+		ui.Data.SetOptionsEnabled(true)
+		ui.Data.SetStarted(true)
+
+		go func() {
+			if onBoarded {
+				return
+			}
+
+			autoConf := autoConfigure(app, client, false, false)
+			ui.Data.SetAutoConfig(autoConf)
+
+			onBoarded = true
+		}()
+	}
+
+	ui.OnBackendChoice = func(backend string) {
+		if _, err := client.SetBackend(backend); err != nil {
+			ui.ShowErrorDlg(err.Error())
+		}
+	}
+
+	ui.OnConfigureOS = func(checked bool) bool {
+		return autoConfigure(app, client, checked, onBoarded)
+	}
+
+	ui.OnRegenerateCA = func() {
+		confirm := ui.ShowYesNoDlg("Regenerate the Fingertip certificate? Browsers may need a restart to trust the new one.")
+		if !confirm {
+			return
+		}
+
+		if _, err := client.RegenerateCA(); err != nil {
+			ui.ShowErrorDlg(err.Error())
+		}
+	}
+
+	ui.OnOpenHelp = func() {
+		browser.OpenURL(app.proxyURL)
+	}
+
+	ui.OnAutostart = func(checked bool) bool {
+		if checked {
+			if err := app.autostart.Disable(); err != nil {
+				ui.ShowErrorDlg(fmt.Sprintf("error disabling open at login: %v", err))
+				return checked
+			}
+			return false
+		}
+
+		if err := app.autostart.Enable(); err != nil {
+			ui.ShowErrorDlg(fmt.Sprintf("error enabling open at login: %v", err))
+			return false
+		}
+
+		return true
+	}
+
+	ui.OnStop = func() {
+		if _, err := client.Stop(); err != nil {
+			ui.ShowErrorDlg(err.Error())
+		}
+		ui.Data.SetStarted(false)
+	}
+
+	ui.OnReady = func() {
+		ui.Data.SetAutoConfigEnabled(auto.Supported())
+		ui.Data.SetOptionsEnabled(false)
+		// update initial state
+		ui.Data.SetOpenAtLogin(app.autostartEnabled || ui.Data.OpenAtLogin())
+
+		st, _ := client.Status()
+		ui.Data.SetAutoConfig(auto.Supported() && st.AutoConfig)
+
+		// start fingertip
+		ui.OnStart()
+		go watchStatus(client)
+	}
+
+	go func() {
+		err := <-fatal
+		ui.ShowErrorDlg(err.Error())
+		ui.Quit()
+	}()
+
+	ui.OnExit = func() {
+		if fileLoggerHandle != nil {
+			fileLoggerHandle.Close()
+		}
+		if _, err := client.Stop(); err != nil {
+			log.Printf("app: error stopping: %v", err)
+		}
+		app.closeStorage()
+	}
+
+	ui.Loop()
+}
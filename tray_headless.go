@@ -0,0 +1,9 @@
+//go:build headless
+
+package main
+
+// runTray built without the system tray
+// always runs headless
+func runTray(app *App, _ bool, fatal <-chan error) {
+	runHeadless(app, fatal)
+}